@@ -0,0 +1,282 @@
+// Package abr adapts a real-time x264 encode to network conditions.  A
+// Controller consumes receiver feedback (estimated bandwidth, loss, RTT)
+// and drives the encoder bitrate and VBV through x264_encoder_reconfig,
+// and triggers intra refreshes or keyframes after heavy loss.  Simulation
+// runs the controller against a synthetic link for offline testing.
+package abr
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/moonfdd/x264-go/libx264"
+)
+
+// Encoder is the part of *libx264.Encoder the controller drives.
+type Encoder interface {
+	SetBitrate(bitrate, maxBitrate, bufferSize int) error
+	IntraRefresh() error
+}
+
+var _ Encoder = (*libx264.Encoder)(nil)
+
+// Feedback is one receiver report.
+type Feedback struct {
+	At        time.Duration /* stream time of the report, must not decrease */
+	Bandwidth int           /* estimated available bandwidth in kbit/s, 0 if unknown */
+	Loss      float64       /* fraction of packets lost since the last report */
+	RTT       time.Duration /* 0 if unknown */
+}
+
+// Config tunes the controller.  Zero fields take the defaults noted.
+type Config struct {
+	MinBitrate   int /* kbit/s, default 100 */
+	MaxBitrate   int /* kbit/s, required */
+	StartBitrate int /* kbit/s, default MaxBitrate/2 */
+
+	/* VBV buffer as a duration at the target bitrate, default 1s */
+	Buffer time.Duration
+	/* fraction of the estimated bandwidth used as the target, default 0.85 */
+	Headroom float64
+
+	/* loss above LossHigh backs off, below LossLow allows probing up;
+	 * defaults 0.10 and 0.02 */
+	LossHigh float64
+	LossLow  float64
+	/* RTT above RTTFactor times the smallest RTT seen is treated as
+	 * queueing and backs off, default 1.5 */
+	RTTFactor float64
+	/* multiplicative increase per second while probing, default 1.08 */
+	Increase float64
+	/* smallest change in percent worth a reconfig when increasing, default 5 */
+	MinChange int
+	/* minimum time between increases, default 1s; decreases apply at once */
+	HoldTime time.Duration
+
+	/* loss at or above which the decoder is assumed to have lost
+	 * references, default 0.2 */
+	RecoveryLoss float64
+	/* minimum time between recoveries, default 1s */
+	RecoveryInterval time.Duration
+	/* recover with x264_encoder_intra_refresh (encoder opened with
+	 * b_intra_refresh) instead of a forced IDR */
+	UseIntraRefresh bool
+}
+
+// Action reports what Update did.
+type Action struct {
+	Bitrate      int /* target after the update, kbit/s */
+	Reconfigured bool
+	IntraRefresh bool
+	Keyframe     bool /* an IDR will be forced by the next Apply */
+}
+
+// Stats are cumulative controller counters.
+type Stats struct {
+	Updates       int
+	Reconfigs     int
+	Decreases     int
+	IntraRefresh  int
+	Keyframes     int
+	ReconfigFails int
+}
+
+var ErrConfig = errors.New("abr: MaxBitrate must be set")
+
+// Controller adapts the encoder bitrate to Feedback.  It is not safe for
+// concurrent use; call Update and Apply from the encoding goroutine.
+type Controller struct {
+	cfg Config
+	enc Encoder
+
+	bitrate      int
+	target       float64 /* unrounded target, accumulates probing */
+	minRTT       time.Duration
+	lastAt       time.Duration
+	lastIncrease time.Duration
+	lastDecrease time.Duration
+	decreased    bool
+	lastRecovery time.Duration
+	recovered    bool
+	keyframe     bool
+	stats        Stats
+}
+
+// NewController returns a controller driving enc and applies the start
+// bitrate.
+func NewController(enc Encoder, cfg Config) (*Controller, error) {
+	if cfg.MaxBitrate <= 0 {
+		return nil, ErrConfig
+	}
+	if cfg.MinBitrate <= 0 {
+		cfg.MinBitrate = 100
+	}
+	if cfg.MinBitrate > cfg.MaxBitrate {
+		cfg.MinBitrate = cfg.MaxBitrate
+	}
+	if cfg.StartBitrate <= 0 {
+		cfg.StartBitrate = cfg.MaxBitrate / 2
+	}
+	if cfg.Buffer <= 0 {
+		cfg.Buffer = time.Second
+	}
+	if cfg.Headroom <= 0 {
+		cfg.Headroom = 0.85
+	}
+	if cfg.LossHigh <= 0 {
+		cfg.LossHigh = 0.10
+	}
+	if cfg.LossLow <= 0 {
+		cfg.LossLow = 0.02
+	}
+	if cfg.RTTFactor <= 1 {
+		cfg.RTTFactor = 1.5
+	}
+	if cfg.Increase <= 1 {
+		cfg.Increase = 1.08
+	}
+	if cfg.MinChange <= 0 {
+		cfg.MinChange = 5
+	}
+	if cfg.HoldTime <= 0 {
+		cfg.HoldTime = time.Second
+	}
+	if cfg.RecoveryLoss <= 0 {
+		cfg.RecoveryLoss = 0.2
+	}
+	if cfg.RecoveryInterval <= 0 {
+		cfg.RecoveryInterval = time.Second
+	}
+	c := &Controller{cfg: cfg, enc: enc}
+	if err := c.setBitrate(c.clamp(cfg.StartBitrate)); err != nil {
+		return nil, err
+	}
+	c.target = float64(c.bitrate)
+	return c, nil
+}
+
+// Bitrate returns the current target in kbit/s.
+func (c *Controller) Bitrate() int {
+	return c.bitrate
+}
+
+// Stats returns the counters.
+func (c *Controller) Stats() Stats {
+	return c.stats
+}
+
+// Update folds one report into the target bitrate and reconfigures the
+// encoder when it changed enough.
+func (c *Controller) Update(fb Feedback) (Action, error) {
+	c.stats.Updates++
+	dt := fb.At - c.lastAt
+	if dt < 0 {
+		dt = 0
+	}
+	c.lastAt = fb.At
+	if fb.RTT > 0 && (c.minRTT == 0 || fb.RTT < c.minRTT) {
+		c.minRTT = fb.RTT
+	}
+
+	/* loss and delay reports lag the decrease that answers them, so they
+	 * are ignored for a while after one */
+	hold := 2 * fb.RTT
+	if hold < 500*time.Millisecond {
+		hold = 500 * time.Millisecond
+	}
+	holding := c.decreased && fb.At-c.lastDecrease < hold
+	congested := fb.RTT > 0 && float64(fb.RTT) > float64(c.minRTT)*c.cfg.RTTFactor
+	switch {
+	case fb.Loss > c.cfg.LossHigh:
+		if !holding {
+			c.target = float64(c.bitrate) * (1 - fb.Loss/2)
+		}
+	case congested:
+		if !holding {
+			c.target = float64(c.bitrate) * 0.85
+		}
+	case fb.Loss < c.cfg.LossLow:
+		c.target *= math.Pow(c.cfg.Increase, dt.Seconds())
+	}
+	if fb.Bandwidth > 0 && c.target > float64(fb.Bandwidth)*c.cfg.Headroom {
+		c.target = float64(fb.Bandwidth) * c.cfg.Headroom
+	}
+	c.target = float64(c.clamp(int(c.target)))
+	next := int(c.target)
+
+	var act Action
+	var err error
+	switch {
+	case next < c.bitrate:
+		/* a failed reconfig leaves the encoder at its rate, so it neither
+		 * counts as a decrease nor starts the hold */
+		if err = c.setBitrate(next); err == nil {
+			c.stats.Decreases++
+			c.decreased = true
+			c.lastDecrease = fb.At
+			act.Reconfigured = true
+		}
+	case next > c.bitrate && (next-c.bitrate)*100 >= c.bitrate*c.cfg.MinChange &&
+		fb.At-c.lastIncrease >= c.cfg.HoldTime:
+		c.lastIncrease = fb.At
+		err = c.setBitrate(next)
+		act.Reconfigured = err == nil
+	}
+
+	if fb.Loss >= c.cfg.RecoveryLoss && (!c.recovered || fb.At-c.lastRecovery >= c.cfg.RecoveryInterval) {
+		c.recovered = true
+		c.lastRecovery = fb.At
+		if c.cfg.UseIntraRefresh {
+			if rerr := c.enc.IntraRefresh(); rerr == nil {
+				c.stats.IntraRefresh++
+				act.IntraRefresh = true
+			} else if err == nil {
+				err = rerr
+			}
+		} else {
+			c.keyframe = true
+		}
+	}
+	act.Bitrate = c.bitrate
+	act.Keyframe = c.keyframe
+	return act, err
+}
+
+// Apply forces an IDR on the next input picture when a keyframe was
+// requested and reports whether it did.  Otherwise the picture type is
+// left alone, so types forced elsewhere survive; reused pictures must be
+// reset by the caller.
+func (c *Controller) Apply(pic *libx264.X264PictureT) bool {
+	if !c.keyframe {
+		return false
+	}
+	c.keyframe = false
+	c.stats.Keyframes++
+	pic.SetType(libx264.X264_TYPE_IDR)
+	return true
+}
+
+func (c *Controller) setBitrate(kbps int) error {
+	bufsize := int(int64(kbps) * int64(c.cfg.Buffer) / int64(time.Second))
+	if bufsize < 1 {
+		bufsize = 1
+	}
+	if err := c.enc.SetBitrate(kbps, kbps, bufsize); err != nil {
+		c.stats.ReconfigFails++
+		return err
+	}
+	c.stats.Reconfigs++
+	c.bitrate = kbps
+	return nil
+}
+
+func (c *Controller) clamp(kbps int) int {
+	if kbps < c.cfg.MinBitrate {
+		return c.cfg.MinBitrate
+	}
+	if kbps > c.cfg.MaxBitrate {
+		return c.cfg.MaxBitrate
+	}
+	return kbps
+}
@@ -0,0 +1,135 @@
+package abr
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/moonfdd/ffmpeg-go/ffcommon"
+	"github.com/moonfdd/x264-go/libx264"
+)
+
+type fakeEncoder struct {
+	bitrates     []int
+	buffers      []int
+	intraRefresh int
+	err          error
+}
+
+func (e *fakeEncoder) SetBitrate(bitrate, maxBitrate, bufferSize int) error {
+	if e.err != nil {
+		return e.err
+	}
+	e.bitrates = append(e.bitrates, bitrate)
+	e.buffers = append(e.buffers, bufferSize)
+	return nil
+}
+
+func (e *fakeEncoder) IntraRefresh() error {
+	e.intraRefresh++
+	return nil
+}
+
+func TestController(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		name      string
+		cfg       Config
+		feedback  []Feedback
+		want      []int /* target after each report */
+		keyframe  bool
+		refreshes int
+	}{
+		{"probe up on a clean link", Config{MaxBitrate: 4000, StartBitrate: 1000},
+			[]Feedback{{At: 1000 * ms}, {At: 2000 * ms}, {At: 2500 * ms}, {At: 3000 * ms}},
+			[]int{1080, 1166, 1166, 1258}, false, 0},
+		{"loss backs off once per hold", Config{MaxBitrate: 4000, StartBitrate: 2000},
+			[]Feedback{{At: 100 * ms, Loss: 0.2}, {At: 200 * ms, Loss: 0.2}, {At: 700 * ms, Loss: 0.2}},
+			[]int{1800, 1800, 1620}, true, 0},
+		{"bandwidth caps the target", Config{MaxBitrate: 4000, StartBitrate: 2000},
+			[]Feedback{{At: 100 * ms, Bandwidth: 1000}},
+			[]int{850}, false, 0},
+		{"queueing delay backs off", Config{MaxBitrate: 4000, StartBitrate: 2000},
+			[]Feedback{{At: 100 * ms, RTT: 50 * ms}, {At: 200 * ms, RTT: 100 * ms}},
+			[]int{2000, 1700}, false, 0},
+		{"clamped to min", Config{MaxBitrate: 4000, MinBitrate: 500, StartBitrate: 600},
+			[]Feedback{{At: 100 * ms, Bandwidth: 100}},
+			[]int{500}, false, 0},
+		{"intra refresh recovery", Config{MaxBitrate: 4000, StartBitrate: 2000, UseIntraRefresh: true},
+			[]Feedback{{At: 100 * ms, Loss: 0.3}, {At: 200 * ms, Loss: 0.3}, {At: 1200 * ms, Loss: 0.3}},
+			[]int{1700, 1700, 1445}, false, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc := &fakeEncoder{}
+			c, err := NewController(enc, tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, fb := range tt.feedback {
+				act, err := c.Update(fb)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if act.Bitrate != tt.want[i] || c.Bitrate() != tt.want[i] {
+					t.Errorf("report %d: bitrate %d, want %d", i, act.Bitrate, tt.want[i])
+				}
+			}
+			last := len(enc.bitrates) - 1
+			if enc.bitrates[last] != c.Bitrate() || enc.buffers[last] != c.Bitrate() {
+				t.Errorf("encoder at %d/%d, controller at %d", enc.bitrates[last], enc.buffers[last], c.Bitrate())
+			}
+			if enc.intraRefresh != tt.refreshes {
+				t.Errorf("%d intra refreshes, want %d", enc.intraRefresh, tt.refreshes)
+			}
+			var pic libx264.X264PictureT
+			pic.SetType(libx264.X264_TYPE_I)
+			if c.Apply(&pic) != tt.keyframe {
+				t.Errorf("Apply forced a keyframe: %v", !tt.keyframe)
+			}
+			want := ffcommon.FInt(libx264.X264_TYPE_I)
+			if tt.keyframe {
+				want = libx264.X264_TYPE_IDR
+			}
+			if pic.Type() != want {
+				t.Errorf("picture type %d, want %d", pic.Type(), want)
+			}
+			if c.Apply(&pic) {
+				t.Error("keyframe forced twice")
+			}
+		})
+	}
+}
+
+func TestControllerErrors(t *testing.T) {
+	if _, err := NewController(&fakeEncoder{}, Config{}); err != ErrConfig {
+		t.Errorf("no MaxBitrate: %v", err)
+	}
+	fail := errors.New("reconfig failed")
+	if _, err := NewController(&fakeEncoder{err: fail}, Config{MaxBitrate: 1000}); err != fail {
+		t.Errorf("failing encoder: %v", err)
+	}
+
+	enc := &fakeEncoder{}
+	c, err := NewController(enc, Config{MaxBitrate: 4000, StartBitrate: 2000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc.err = fail
+	act, err := c.Update(Feedback{At: time.Second, Loss: 0.5})
+	if err != fail || act.Reconfigured || c.Bitrate() != 2000 {
+		t.Errorf("failed reconfig: %v %+v at %d", err, act, c.Bitrate())
+	}
+	if s := c.Stats(); s.ReconfigFails != 1 || s.Reconfigs != 1 || s.Decreases != 0 {
+		t.Errorf("stats %+v", s)
+	}
+	/* the failed decrease started no hold, so the next report retries it */
+	enc.err = nil
+	act, err = c.Update(Feedback{At: time.Second + 100*time.Millisecond, Loss: 0.5})
+	if err != nil || !act.Reconfigured || c.Bitrate() != 1500 {
+		t.Errorf("retried decrease: %v %+v at %d", err, act, c.Bitrate())
+	}
+	if s := c.Stats(); s.Decreases != 1 || s.Reconfigs != 2 {
+		t.Errorf("stats after retry %+v", s)
+	}
+}
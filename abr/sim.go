@@ -0,0 +1,239 @@
+package abr
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/moonfdd/x264-go/libx264"
+)
+
+var ErrFrameRate = errors.New("abr: FrameRate must be positive")
+
+// Link models a bottleneck with a drop-tail queue.  Feedback is delivered
+// without delay, which keeps runs deterministic for a given Seed.
+type Link struct {
+	Capacity   func(t time.Duration) int /* kbit/s at time t */
+	BaseRTT    time.Duration
+	Queue      time.Duration /* queue size as delay at the current capacity, default 200ms */
+	RandomLoss float64       /* independent packet loss besides queue drops */
+	Seed       int64
+}
+
+// SimEncoder stands in for *libx264.Encoder in a Simulation.  SetBitrate
+// takes the same path as the real encoder: the change is checked and
+// applied to a copy of Param with ReconfigBitrate, and like
+// x264_encoder_reconfig it takes effect with the next frame.  Frame sizes
+// follow the bitrate of Param; keyframes cost KeyframeFactor times an
+// average frame (capped by the VBV buffer) and intra refresh spreads a
+// smaller overhead over one second of frames.
+type SimEncoder struct {
+	FrameRate      int
+	KeyframeFactor float64 /* default 5 */
+
+	/* parameters of the simulated encoder, ABR or CRF with VBV */
+	Param *libx264.X264ParamT
+
+	Reconfigs      int
+	IntraRefreshes int
+	queued         *libx264.X264ParamT
+	refreshLeft    int
+}
+
+func (e *SimEncoder) SetBitrate(bitrate, maxBitrate, bufferSize int) error {
+	param := *e.Param
+	if err := param.ReconfigBitrate(bitrate, maxBitrate, bufferSize); err != nil {
+		return err
+	}
+	e.queued = &param
+	e.Reconfigs++
+	return nil
+}
+
+func (e *SimEncoder) IntraRefresh() error {
+	e.IntraRefreshes++
+	e.refreshLeft = e.FrameRate
+	return nil
+}
+
+// FrameBits applies a queued reconfig and returns the size of the next
+// frame.
+func (e *SimEncoder) FrameBits(keyframe bool) (int, error) {
+	if e.FrameRate <= 0 {
+		return 0, ErrFrameRate
+	}
+	if e.queued != nil {
+		e.Param, e.queued = e.queued, nil
+	}
+	_, bufferSize := e.Param.VBV()
+	avg := float64(e.Param.Bitrate()) * 1000 / float64(e.FrameRate)
+	switch {
+	case keyframe:
+		factor := e.KeyframeFactor
+		if factor <= 0 {
+			factor = 5
+		}
+		bits := avg * factor
+		if max := float64(bufferSize) * 1000; bufferSize > 0 && bits > max {
+			bits = max
+		}
+		return int(bits), nil
+	case e.refreshLeft > 0:
+		e.refreshLeft--
+		return int(avg * 1.3), nil
+	}
+	return int(avg), nil
+}
+
+// Sample is the state of a Simulation at one feedback report.
+type Sample struct {
+	At        time.Duration
+	Capacity  int /* kbit/s */
+	Bitrate   int /* controller target, kbit/s */
+	SendRate  int /* kbit/s over the interval */
+	Delivered int /* kbit/s over the interval */
+	Loss      float64
+	RTT       time.Duration
+	Action    Action
+}
+
+// Simulation feeds a synthetic encoder through a Link and the link's
+// feedback back into a Controller.
+type Simulation struct {
+	Link       Link
+	Encoder    *SimEncoder
+	Controller *Controller
+
+	FeedbackInterval time.Duration /* default 100ms */
+	KeyframeInterval int           /* frames between periodic keyframes, 0 for none */
+}
+
+const simPacketBits = 1200 * 8
+
+// NewSimulation returns a simulation at frameRate frames per second
+// driving a controller built from cfg.  The simulated encoder is opened in
+// ABR mode with a VBV at cfg.MaxBitrate, as a real encoder must be for the
+// controller to reconfigure it.
+func NewSimulation(link Link, frameRate int, cfg Config) (*Simulation, error) {
+	if frameRate <= 0 {
+		return nil, ErrFrameRate
+	}
+	if link.Queue <= 0 {
+		link.Queue = 200 * time.Millisecond
+	}
+	param := new(libx264.X264ParamT)
+	param.SetBitrate(cfg.MaxBitrate)
+	param.SetVBV(cfg.MaxBitrate, cfg.MaxBitrate)
+	enc := &SimEncoder{FrameRate: frameRate, Param: param}
+	c, err := NewController(enc, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Simulation{Link: link, Encoder: enc, Controller: c, FeedbackInterval: 100 * time.Millisecond}, nil
+}
+
+// Run simulates d of streaming and returns one Sample per feedback report.
+func (s *Simulation) Run(d time.Duration) ([]Sample, error) {
+	if s.Encoder.FrameRate <= 0 {
+		return nil, ErrFrameRate
+	}
+	rng := rand.New(rand.NewSource(s.Link.Seed))
+	frameDur := time.Second / time.Duration(s.Encoder.FrameRate)
+	var pic libx264.X264PictureT
+	var samples []Sample
+	var queue float64 /* bits */
+	var sent, delivered, lost, total float64
+	var saturated bool
+	var rtt time.Duration
+	var nextFeedback = s.FeedbackInterval
+	var last time.Duration
+
+	for i := 0; ; i++ {
+		t := time.Duration(i) * frameDur
+		if t >= d {
+			break
+		}
+		capBits := float64(s.Link.Capacity(t)) * 1000
+
+		/* drain the queue for one frame interval */
+		drain := capBits * frameDur.Seconds()
+		if drain < queue {
+			saturated = true
+		} else {
+			drain = queue
+		}
+		queue -= drain
+		delivered += drain
+		if capBits > 0 {
+			/* delay seen by the frame about to be sent */
+			rtt = s.Link.BaseRTT + time.Duration(queue/capBits*float64(time.Second))
+		}
+
+		pic.ResetControls()
+		keyframe := s.Controller.Apply(&pic) ||
+			(s.KeyframeInterval > 0 && i%s.KeyframeInterval == 0)
+		n, err := s.Encoder.FrameBits(keyframe)
+		if err != nil {
+			return samples, err
+		}
+		bits := float64(n)
+		sent += bits
+		total += bits
+
+		for p := 0.0; p < bits; p += simPacketBits {
+			size := bits - p
+			if size > simPacketBits {
+				size = simPacketBits
+			}
+			if rng.Float64() < s.Link.RandomLoss || queue+size > capBits*s.Link.Queue.Seconds() {
+				lost += size
+				continue
+			}
+			queue += size
+		}
+
+		if t+frameDur < nextFeedback {
+			continue
+		}
+		at := nextFeedback
+		interval := (at - last).Seconds()
+		fb := Feedback{At: at, RTT: rtt}
+		if total > 0 {
+			fb.Loss = lost / total
+		}
+		if saturated {
+			/* the queue did not empty: the delivery rate is the capacity */
+			fb.Bandwidth = int(delivered / interval / 1000)
+		}
+		act, _ := s.Controller.Update(fb)
+		samples = append(samples, Sample{
+			At:        at,
+			Capacity:  int(capBits / 1000),
+			Bitrate:   s.Controller.Bitrate(),
+			SendRate:  int(sent / interval / 1000),
+			Delivered: int(delivered / interval / 1000),
+			Loss:      fb.Loss,
+			RTT:       fb.RTT,
+			Action:    act,
+		})
+		sent, delivered, lost, total = 0, 0, 0, 0
+		saturated = false
+		last = at
+		nextFeedback += s.FeedbackInterval
+	}
+	return samples, nil
+}
+
+// StepCapacity returns a Capacity function switching to rates[i] at
+// times[i]; rates[0] applies before times[1].
+func StepCapacity(times []time.Duration, rates []int) func(t time.Duration) int {
+	return func(t time.Duration) int {
+		r := rates[0]
+		for i := range times {
+			if t >= times[i] {
+				r = rates[i]
+			}
+		}
+		return r
+	}
+}
@@ -0,0 +1,137 @@
+package abr
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/moonfdd/x264-go/libx264"
+)
+
+func TestSimEncoder(t *testing.T) {
+	param := new(libx264.X264ParamT)
+	param.SetBitrate(2000)
+	param.SetVBV(2000, 2000)
+	e := &SimEncoder{FrameRate: 25, Param: param}
+	if bits, err := e.FrameBits(false); err != nil || bits != 80000 {
+		t.Errorf("frame %d bits, want 80000: %v", bits, err)
+	}
+	if err := e.SetBitrate(1000, 1000, 500); err != nil {
+		t.Fatal(err)
+	}
+	/* like x264_encoder_reconfig, the change waits for the next frame */
+	if e.Param.Bitrate() != 2000 {
+		t.Errorf("bitrate %d before the next frame", e.Param.Bitrate())
+	}
+	if bits, _ := e.FrameBits(true); bits != 200000 || e.Param.Bitrate() != 1000 {
+		t.Errorf("keyframe %d bits at %d kbit/s, want 200000 at 1000", bits, e.Param.Bitrate())
+	}
+	if err := e.SetBitrate(3000, 2000, 2000); err == nil {
+		t.Error("bitrate above the VBV max bitrate accepted")
+	}
+	param = new(libx264.X264ParamT)
+	param.SetBitrate(2000)
+	e = &SimEncoder{FrameRate: 25, Param: param}
+	if err := e.SetBitrate(1000, 1000, 1000); !errors.Is(err, libx264.ErrNotReconfigurable) || e.Reconfigs != 0 {
+		t.Errorf("encoder without VBV: %v", err)
+	}
+	for _, rate := range []int{0, -25} {
+		e = &SimEncoder{FrameRate: rate, Param: param}
+		if _, err := e.FrameBits(false); err != ErrFrameRate {
+			t.Errorf("frame rate %d: %v", rate, err)
+		}
+	}
+}
+
+func TestSimulation(t *testing.T) {
+	step := StepCapacity([]time.Duration{0, 10 * time.Second, 20 * time.Second}, []int{3000, 1000, 3000})
+	tests := []struct {
+		name       string
+		link       Link
+		cfg        Config
+		keyframes  bool
+		refreshes  bool
+		settleFrom time.Duration /* from here to the step up the target fits the link */
+	}{
+		{"step down and up", Link{Capacity: step, BaseRTT: 40 * time.Millisecond, Seed: 1},
+			Config{MaxBitrate: 4000}, true, false, 11 * time.Second},
+		{"step with intra refresh", Link{Capacity: step, BaseRTT: 40 * time.Millisecond, Seed: 1},
+			Config{MaxBitrate: 4000, UseIntraRefresh: true}, false, true, 11 * time.Second},
+		{"random loss", Link{Capacity: func(time.Duration) int { return 5000 }, RandomLoss: 0.25, Seed: 7},
+			Config{MaxBitrate: 4000, StartBitrate: 3000}, true, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			run := func() (*Simulation, []Sample) {
+				s, err := NewSimulation(tt.link, 25, tt.cfg)
+				if err != nil {
+					t.Fatal(err)
+				}
+				s.KeyframeInterval = 50
+				samples, err := s.Run(30 * time.Second)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return s, samples
+			}
+			s, samples := run()
+			if len(samples) != 300 {
+				t.Fatalf("%d samples, want 300", len(samples))
+			}
+			if _, again := run(); !reflect.DeepEqual(samples, again) {
+				t.Error("runs with the same seed differ")
+			}
+
+			var atStepUp int
+			for _, x := range samples {
+				if x.Bitrate < tt.cfg.MinBitrate || x.Bitrate > tt.cfg.MaxBitrate {
+					t.Fatalf("%v: bitrate %d outside the configured range", x.At, x.Bitrate)
+				}
+				if tt.settleFrom > 0 && x.At >= tt.settleFrom && x.At < 20*time.Second {
+					if x.Bitrate > x.Capacity || x.Loss > 0 {
+						t.Errorf("%v: bitrate %d loss %.2f on a %d kbit/s link", x.At, x.Bitrate, x.Loss, x.Capacity)
+					}
+				}
+				if x.At == 20*time.Second {
+					atStepUp = x.Bitrate
+				}
+			}
+			if last := samples[len(samples)-1]; tt.settleFrom > 0 && last.Bitrate <= atStepUp {
+				t.Errorf("bitrate %d did not grow from %d after the step up", last.Bitrate, atStepUp)
+			}
+
+			stats := s.Controller.Stats()
+			if s.Encoder.Reconfigs != stats.Reconfigs || stats.ReconfigFails != 0 {
+				t.Errorf("encoder saw %d reconfigs, controller %+v", s.Encoder.Reconfigs, stats)
+			}
+			if _, err := s.Encoder.FrameBits(false); err != nil {
+				t.Fatal(err)
+			}
+			if s.Encoder.Param.Bitrate() != s.Controller.Bitrate() {
+				t.Errorf("encoder at %d kbit/s, controller at %d", s.Encoder.Param.Bitrate(), s.Controller.Bitrate())
+			}
+			if (stats.Keyframes > 0) != tt.keyframes || (s.Encoder.IntraRefreshes > 0) != tt.refreshes {
+				t.Errorf("%d keyframes, %d intra refreshes", stats.Keyframes, s.Encoder.IntraRefreshes)
+			}
+			if stats.Keyframes > 30 {
+				t.Errorf("%d keyframes in 30s despite the recovery interval", stats.Keyframes)
+			}
+		})
+	}
+}
+
+func TestSimulationFrameRate(t *testing.T) {
+	link := Link{Capacity: func(time.Duration) int { return 1000 }}
+	if _, err := NewSimulation(link, 0, Config{MaxBitrate: 1000}); err != ErrFrameRate {
+		t.Errorf("NewSimulation at 0 fps: %v", err)
+	}
+	s, err := NewSimulation(link, 25, Config{MaxBitrate: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Encoder.FrameRate = 0
+	if samples, err := s.Run(time.Second); err != ErrFrameRate || samples != nil {
+		t.Errorf("Run at 0 fps: %d samples, %v", len(samples), err)
+	}
+}
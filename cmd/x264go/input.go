@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/moonfdd/ffmpeg-go/ffcommon"
+	"github.com/moonfdd/x264-go/libx264"
+)
+
+// input reads raw pictures into an x264 picture allocated with
+// x264_picture_alloc.
+type input struct {
+	r      *bufio.Reader
+	f      *os.File
+	y4m    bool
+	width  int
+	height int
+	csp    ffcommon.FInt
+	fpsNum uint64
+	fpsDen uint64
+	frames int /* total frames if known, else 0 */
+}
+
+type planeSize struct {
+	width, height int
+}
+
+var cspNames = map[string]ffcommon.FInt{
+	"i420": libx264.X264_CSP_I420,
+	"i422": libx264.X264_CSP_I422,
+	"i444": libx264.X264_CSP_I444,
+	"nv12": libx264.X264_CSP_NV12,
+}
+
+var y4mCsps = map[string]ffcommon.FInt{
+	"420":      libx264.X264_CSP_I420,
+	"420jpeg":  libx264.X264_CSP_I420,
+	"420mpeg2": libx264.X264_CSP_I420,
+	"420paldv": libx264.X264_CSP_I420,
+	"422":      libx264.X264_CSP_I422,
+	"444":      libx264.X264_CSP_I444,
+}
+
+// openInput opens a Y4M file (by extension) or raw YUV.  For raw input
+// res, csp and fps must be given; for Y4M they default to the header.
+func openInput(path, res, csp, fps string) (*input, error) {
+	var f *os.File
+	if path == "-" {
+		f = os.Stdin
+	} else {
+		var err error
+		if f, err = os.Open(path); err != nil {
+			return nil, err
+		}
+	}
+	in := &input{r: bufio.NewReaderSize(f, 1<<20), f: f, csp: libx264.X264_CSP_I420, fpsNum: 25, fpsDen: 1}
+	in.y4m = strings.HasSuffix(strings.ToLower(path), ".y4m")
+	if in.y4m {
+		if err := in.readY4MHeader(); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	if res != "" {
+		if _, err := fmt.Sscanf(res, "%dx%d", &in.width, &in.height); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("invalid --input-res %q", res)
+		}
+	}
+	if csp != "" {
+		c, ok := cspNames[csp]
+		if !ok {
+			f.Close()
+			return nil, fmt.Errorf("unsupported --input-csp %q", csp)
+		}
+		in.csp = c
+	}
+	if fps != "" {
+		num, den, err := parseRational(fps)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("invalid --fps %q", fps)
+		}
+		in.fpsNum, in.fpsDen = num, den
+	}
+	if in.width <= 0 || in.height <= 0 {
+		f.Close()
+		return nil, errors.New("raw input requires --input-res")
+	}
+	if !in.y4m {
+		if fi, err := f.Stat(); err == nil && fi.Mode().IsRegular() {
+			in.frames = int(fi.Size() / int64(in.frameSize()))
+		}
+	}
+	return in, nil
+}
+
+func (in *input) readY4MHeader() error {
+	line, err := in.r.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("y4m: %v", err)
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 || fields[0] != "YUV4MPEG2" {
+		return errors.New("y4m: bad signature")
+	}
+	for _, p := range fields[1:] {
+		v := p[1:]
+		switch p[0] {
+		case 'W':
+			in.width, _ = strconv.Atoi(v)
+		case 'H':
+			in.height, _ = strconv.Atoi(v)
+		case 'F':
+			num, den, err := parseRational(strings.Replace(v, ":", "/", 1))
+			if err != nil {
+				return fmt.Errorf("y4m: bad frame rate %q", v)
+			}
+			in.fpsNum, in.fpsDen = num, den
+		case 'C':
+			c, ok := y4mCsps[v]
+			if !ok {
+				return fmt.Errorf("y4m: unsupported colorspace %q", v)
+			}
+			in.csp = c
+		}
+	}
+	return nil
+}
+
+func (in *input) planes() []planeSize {
+	w, h := in.width, in.height
+	cw, ch := (w+1)/2, (h+1)/2
+	switch in.csp {
+	case libx264.X264_CSP_I422:
+		return []planeSize{{w, h}, {cw, h}, {cw, h}}
+	case libx264.X264_CSP_I444:
+		return []planeSize{{w, h}, {w, h}, {w, h}}
+	case libx264.X264_CSP_NV12:
+		return []planeSize{{w, h}, {cw * 2, ch}}
+	}
+	return []planeSize{{w, h}, {cw, ch}, {cw, ch}}
+}
+
+func (in *input) frameSize() int {
+	n := 0
+	for _, p := range in.planes() {
+		n += p.width * p.height
+	}
+	return n
+}
+
+// read fills pic with the next picture.  It returns io.EOF at the end of
+// the input.
+func (in *input) read(pic *libx264.X264PictureT) error {
+	if in.y4m {
+		line, err := in.r.ReadSlice('\n')
+		if err == io.EOF && len(line) == 0 {
+			return io.EOF
+		}
+		if err != nil {
+			return fmt.Errorf("y4m: %v", err)
+		}
+		if !bytes.HasPrefix(line, []byte("FRAME")) {
+			return errors.New("y4m: missing FRAME header")
+		}
+	}
+	for i, p := range in.planes() {
+		stride := int(pic.Img.IStride[i])
+		plane := ffcommon.ByteSliceFromByteP(pic.Img.Plane[i], stride*p.height)
+		for y := 0; y < p.height; y++ {
+			if _, err := io.ReadFull(in.r, plane[y*stride:y*stride+p.width]); err != nil {
+				if err == io.EOF && i == 0 && y == 0 && !in.y4m {
+					return io.EOF
+				}
+				return fmt.Errorf("truncated frame: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+func (in *input) Close() error {
+	return in.f.Close()
+}
+
+func parseRational(s string) (num, den uint64, err error) {
+	if i := strings.IndexByte(s, '/'); i >= 0 {
+		if num, err = strconv.ParseUint(s[:i], 10, 32); err != nil {
+			return
+		}
+		den, err = strconv.ParseUint(s[i+1:], 10, 32)
+	} else if strings.ContainsRune(s, '.') {
+		var f float64
+		if f, err = strconv.ParseFloat(s, 64); err != nil {
+			return
+		}
+		num, den = uint64(f*1000+0.5), 1000
+	} else {
+		num, err = strconv.ParseUint(s, 10, 32)
+		den = 1
+	}
+	if err == nil && (num == 0 || den == 0) {
+		err = errors.New("zero")
+	}
+	return
+}
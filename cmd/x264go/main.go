@@ -0,0 +1,312 @@
+// Command x264go is a small x264-style command line encoder built on the
+// libx264 binding.
+//
+//	x264go --preset veryfast --crf 23 --input-res 640x360 --fps 25 -o out.mp4 in.yuv
+//	x264go --bitrate 2000 --vbv-maxrate 2000 --vbv-bufsize 4000 -o out.m3u8 in.y4m
+//
+// Raw YUV input needs --input-res (and --input-csp/--fps when they are not
+// i420/25); Y4M input is recognized by its extension.  The output container
+// is chosen from the extension of --output, see openOutput.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/moonfdd/ffmpeg-go/ffcommon"
+	"github.com/moonfdd/x264-go/libx264"
+	"github.com/moonfdd/x264-go/libx264common"
+)
+
+// x264 options passed straight to x264_param_parse, in the order applied.
+var passthrough = []string{
+	"level", "keyint", "min-keyint", "bframes", "ref", "threads",
+	"crf", "qp", "bitrate", "vbv-maxrate", "vbv-bufsize", "qpmin", "qpmax",
+	"pass", "stats", "zones",
+}
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	fs := flag.NewFlagSet("x264go", flag.ContinueOnError)
+	lib := fs.String("lib", "", "path of the libx264 shared library")
+	output := fs.String("output", "", "output file (.264 .ts .mp4 .m3u8 .mpd) or rtmp:// URL")
+	fs.StringVar(output, "o", "", "shorthand for --output")
+	preset := fs.String("preset", "medium", "x264 preset")
+	tune := fs.String("tune", "", "x264 tune")
+	profile := fs.String("profile", "", "restrict the output to this profile")
+	res := fs.String("input-res", "", "raw input resolution WxH")
+	csp := fs.String("input-csp", "", "raw input colorspace: i420, i422, i444, nv12")
+	fps := fs.String("fps", "", "input frame rate, e.g. 25 or 30000/1001")
+	frames := fs.Int("frames", 0, "maximum number of frames to encode")
+	params := fs.String("x264-params", "", "extra options as name=value:name=value")
+	quiet := fs.Bool("quiet", false, "no progress output")
+	psnr := fs.Bool("psnr", false, "compute and report PSNR")
+	ssim := fs.Bool("ssim", false, "compute and report SSIM")
+	qpfile := fs.String("qpfile", "", "force frame types and QPs from a file of \"frame type [qp]\" lines")
+	slowFirstPass := fs.Bool("slow-firstpass", false, "keep the full preset in --pass 1")
+	hrdCheck := fs.Bool("hrd-check", false, "simulate the VBV/HRD buffer and report violations")
+	sliceCheck := fs.Bool("slice-check", false, "verify every slice against the slice size, macroblock and count limits")
+	pulldown := fs.String("pulldown", "", "soft telecine pattern: 22, 32, 64, double, triple, euro")
+	values := make(map[string]*string, len(passthrough))
+	for _, name := range passthrough {
+		values[name] = fs.String(name, "", "x264 --"+name)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: x264go [options] -o output input\n\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(os.Args[1:]); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 || *output == "" {
+		fs.Usage()
+		return 2
+	}
+	if *lib != "" {
+		libx264common.SetLibx264Path(*lib)
+	}
+
+	var forced map[int]qpEntry
+	if *qpfile != "" {
+		var err error
+		if forced, err = readQpfile(*qpfile); err != nil {
+			fmt.Fprintf(os.Stderr, "x264go: %v\n", err)
+			return 1
+		}
+	}
+
+	in, err := openInput(fs.Arg(0), *res, *csp, *fps)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "x264go: %v\n", err)
+		return 1
+	}
+	defer in.Close()
+
+	param := new(libx264.X264ParamT)
+	if param.X264ParamDefaultPreset(*preset, *tune) < 0 {
+		fmt.Fprintf(os.Stderr, "x264go: invalid preset/tune %q/%q\n", *preset, *tune)
+		return 1
+	}
+	param.IWidth = ffcommon.FInt(in.width)
+	param.IHeight = ffcommon.FInt(in.height)
+	param.ICsp = in.csp
+	opts := [][2]string{
+		{"fps", fmt.Sprintf("%d/%d", in.fpsNum, in.fpsDen)},
+		{"frames", strconv.Itoa(limitFrames(in.frames, *frames))},
+	}
+	for _, name := range passthrough {
+		if v := *values[name]; v != "" {
+			opts = append(opts, [2]string{name, v})
+		}
+	}
+	for _, kv := range strings.Split(*params, ":") {
+		if kv == "" {
+			continue
+		}
+		i := strings.IndexByte(kv, '=')
+		if i < 0 {
+			opts = append(opts, [2]string{kv, "1"})
+		} else {
+			opts = append(opts, [2]string{kv[:i], kv[i+1:]})
+		}
+	}
+	for _, o := range opts {
+		switch param.X264ParamParse(o[0], o[1]) {
+		case libx264.X264_PARAM_BAD_NAME:
+			fmt.Fprintf(os.Stderr, "x264go: unknown option --%s\n", o[0])
+			return 1
+		case libx264.X264_PARAM_BAD_VALUE:
+			fmt.Fprintf(os.Stderr, "x264go: invalid value for --%s: %q\n", o[0], o[1])
+			return 1
+		}
+	}
+	param.SetQualityMetrics(*psnr, *ssim)
+	if param.Pass() == 1 && !*slowFirstPass {
+		param.X264ParamApplyFastfirstpass()
+	}
+	if *profile != "" && param.X264ParamApplyProfile(*profile) < 0 {
+		fmt.Fprintf(os.Stderr, "x264go: invalid profile %q\n", *profile)
+		return 1
+	}
+	qpMax := param.MaxQP()
+	if err := checkQpfile(forced, qpMax); err != nil {
+		fmt.Fprintf(os.Stderr, "x264go: %s: %v\n", *qpfile, err)
+		return 1
+	}
+
+	/* PTS are frame numbers, so the timebase is the frame duration, except
+	   with pulldown where they count output frames */
+	tbNum, tbDen := int64(in.fpsDen), int64(in.fpsNum)
+	var clock *libx264.PulldownClock
+	if *pulldown != "" {
+		p, err := libx264.ParsePulldown(*pulldown)
+		if err == nil {
+			err = param.SetPulldown(p, uint32(in.fpsNum), uint32(in.fpsDen))
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "x264go: %v\n", err)
+			return 1
+		}
+		_, tff := param.Scan()
+		clock = libx264.NewPulldownClock(p, tff)
+		tbDen = tbDen * int64(p.FactorNum) / int64(p.FactorDen)
+	}
+	sink, err := openOutput(*output, tbNum, tbDen)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "x264go: %v\n", err)
+		return 1
+	}
+	var hrd *libx264.HRDChecker
+	if *hrdCheck {
+		if hrd, err = libx264.NewHRDChecker(param); err != nil {
+			sink.Close()
+			fmt.Fprintf(os.Stderr, "x264go: %v\n", err)
+			return 1
+		}
+		sink = libx264.HRDSink(sink, hrd)
+	}
+	var slices *libx264.SliceChecker
+	if *sliceCheck {
+		slices = libx264.NewSliceChecker(param)
+		sink = libx264.SliceSink(sink, slices)
+	}
+	st := newStats(sink, libx264.NewQualityStats(param), float64(in.fpsNum)/float64(in.fpsDen), limitFrames(in.frames, *frames), *quiet)
+	enc, err := libx264.NewEncoder(param, st)
+	if err != nil {
+		sink.Close()
+		fmt.Fprintf(os.Stderr, "x264go: %v\n", err)
+		return 1
+	}
+
+	pic := new(libx264.X264PictureT)
+	if pic.X264PictureAlloc(in.csp, param.IWidth, param.IHeight) < 0 {
+		enc.Close()
+		fmt.Fprintf(os.Stderr, "x264go: x264_picture_alloc failed\n")
+		return 1
+	}
+	defer pic.X264PictureClean()
+
+	ret := 0
+	for i := 0; *frames <= 0 || i < *frames; i++ {
+		if err = in.read(pic); err == io.EOF {
+			break
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "\nx264go: %v\n", err)
+			ret = 1
+			break
+		}
+		pic.IPts = int64(i)
+		if clock != nil {
+			clock.Apply(pic)
+		}
+		pic.ResetControls()
+		if e, ok := forced[i]; ok {
+			pic.SetType(e.typ)
+			pic.SetQP(e.qp, qpMax)
+		}
+		if err = enc.Encode(pic); err != nil {
+			fmt.Fprintf(os.Stderr, "\nx264go: %v\n", err)
+			ret = 1
+			break
+		}
+	}
+	if err = enc.Close(); err != nil && ret == 0 {
+		fmt.Fprintf(os.Stderr, "\nx264go: %v\n", err)
+		ret = 1
+	}
+	st.report()
+	if hrd != nil {
+		hrd.Report(os.Stderr)
+		if ret == 0 && hrd.Err() != nil {
+			ret = 1
+		}
+	}
+	if slices != nil {
+		slices.Report(os.Stderr)
+		if ret == 0 && slices.Err() != nil {
+			ret = 1
+		}
+	}
+	return ret
+}
+
+func limitFrames(total, max int) int {
+	if max > 0 && (total == 0 || max < total) {
+		return max
+	}
+	return total
+}
+
+// stats is a pass-through Sink collecting what the x264 CLI reports.
+type stats struct {
+	libx264.Sink
+	quality *libx264.QualityStats
+	fps     float64
+	total   int
+	quiet   bool
+	start   time.Time
+	last    time.Time
+	frames  int
+	bytes   int64
+}
+
+func newStats(sink libx264.Sink, quality *libx264.QualityStats, fps float64, total int, quiet bool) *stats {
+	now := time.Now()
+	return &stats{
+		Sink:    sink,
+		quality: quality,
+		fps:     fps,
+		total:   total,
+		quiet:   quiet,
+		start:   now,
+		last:    now,
+	}
+}
+
+func (s *stats) WriteFrame(f *libx264.Frame) error {
+	s.quality.Add(f)
+	s.frames++
+	s.bytes = s.quality.All.Bytes
+	if now := time.Now(); !s.quiet && now.Sub(s.last) >= 250*time.Millisecond {
+		s.last = now
+		s.progress(now)
+	}
+	return s.Sink.WriteFrame(f)
+}
+
+func (s *stats) progress(now time.Time) {
+	elapsed := now.Sub(s.start).Seconds()
+	encFps := float64(s.frames) / elapsed
+	if s.total > 0 {
+		eta := time.Duration(float64(s.total-s.frames) / encFps * float64(time.Second))
+		fmt.Fprintf(os.Stderr, "[%.1f%%] %d/%d frames, %.2f fps, %.2f kb/s, eta %s  \r",
+			100*float64(s.frames)/float64(s.total), s.frames, s.total, encFps, s.kbps(), eta.Round(time.Second))
+	} else {
+		fmt.Fprintf(os.Stderr, "%d frames: %.2f fps, %.2f kb/s  \r", s.frames, encFps, s.kbps())
+	}
+}
+
+func (s *stats) kbps() float64 {
+	if s.frames == 0 {
+		return 0
+	}
+	return float64(s.bytes) * 8 * s.fps / float64(s.frames) / 1000
+}
+
+func (s *stats) report() {
+	if !s.quiet {
+		fmt.Fprintf(os.Stderr, "%*s\r", 79, "")
+	}
+	s.quality.Report(os.Stderr, s.fps)
+	elapsed := time.Since(s.start).Seconds()
+	fmt.Fprintf(os.Stderr, "encoded %d frames, %.2f fps, %.2f kb/s, %d bytes\n",
+		s.frames, float64(s.frames)/elapsed, s.kbps(), s.bytes)
+}
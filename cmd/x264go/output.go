@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/moonfdd/x264-go/dash"
+	"github.com/moonfdd/x264-go/fmp4"
+	"github.com/moonfdd/x264-go/hls"
+	"github.com/moonfdd/x264-go/libx264"
+	"github.com/moonfdd/x264-go/mpegts"
+	"github.com/moonfdd/x264-go/rtmp"
+)
+
+// openOutput returns the sink for path, chosen by its extension or scheme:
+//
+//	.264 .h264 .avc  raw Annex-B (also the fallback)
+//	.ts              MPEG-TS
+//	.mp4 .m4v        fragmented MP4
+//	.m3u8            HLS playlist and TS segments next to it
+//	.mpd             DASH manifest and fMP4 segments next to it
+//	rtmp://          RTMP publish
+func openOutput(path string, tbNum, tbDen int64) (libx264.Sink, error) {
+	if strings.HasPrefix(path, "rtmp://") {
+		c, err := rtmp.Publish(path)
+		if err != nil {
+			return nil, err
+		}
+		c.TimebaseNum, c.TimebaseDen = tbNum, tbDen
+		return c.Sink(), nil
+	}
+
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".m3u8":
+		seg, err := hls.NewSegmenter(hls.Config{
+			Dir:          dir,
+			PlaylistName: name,
+			TimebaseNum:  tbNum,
+			TimebaseDen:  tbDen,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return seg.Sink(), nil
+	case ".mpd":
+		w, err := dash.NewWriter(dash.Config{
+			Dir:          dir,
+			ManifestName: name,
+			TimebaseNum:  tbNum,
+			TimebaseDen:  tbDen,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return w.Sink(), nil
+	}
+
+	var f *os.File
+	var err error
+	if path == "-" {
+		f = os.Stdout
+	} else if f, err = os.Create(path); err != nil {
+		return nil, err
+	}
+	var sink libx264.Sink
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ts":
+		sink, err = mpegts.NewSink(f, tbNum, tbDen)
+	case ".mp4", ".m4v":
+		var w *fmp4.Writer
+		if w, err = fmp4.NewWriter(f, 0, tbNum, tbDen); err == nil {
+			sink = w.Sink()
+		}
+	default:
+		sink = libx264.NewAnnexBSink(f)
+	}
+	if err != nil && f != os.Stdout {
+		f.Close()
+	}
+	return sink, err
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/moonfdd/ffmpeg-go/ffcommon"
+	"github.com/moonfdd/x264-go/libx264"
+)
+
+type qpEntry struct {
+	typ ffcommon.FInt
+	qp  int /* -1 for auto */
+}
+
+/* frame type letters of the x264 --qpfile format */
+var qpfileTypes = map[string]ffcommon.FInt{
+	"I": libx264.X264_TYPE_IDR,
+	"i": libx264.X264_TYPE_I,
+	"K": libx264.X264_TYPE_KEYFRAME,
+	"P": libx264.X264_TYPE_P,
+	"B": libx264.X264_TYPE_BREF,
+	"b": libx264.X264_TYPE_B,
+}
+
+// readQpfile parses lines of "framenum frametype [QP]".
+func readQpfile(path string) (map[int]qpEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	entries := make(map[int]qpEntry)
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+		var frame int
+		var typ string
+		qp := -1
+		n, _ := fmt.Sscan(text, &frame, &typ, &qp)
+		t, ok := qpfileTypes[typ]
+		if n < 2 || !ok || frame < 0 || qp > libx264.QPMax {
+			return nil, fmt.Errorf("%s:%d: invalid qpfile entry %q", path, line, text)
+		}
+		entries[frame] = qpEntry{typ: t, qp: qp}
+	}
+	return entries, sc.Err()
+}
+
+// checkQpfile rejects forced QPs above qpMax, the limit of the bit depth
+// of the encode.
+func checkQpfile(entries map[int]qpEntry, qpMax int) error {
+	bad := -1
+	for frame, e := range entries {
+		if e.qp > qpMax && (bad < 0 || frame < bad) {
+			bad = frame
+		}
+	}
+	if bad >= 0 {
+		return fmt.Errorf("frame %d: QP %d above %d for this bit depth", bad, entries[bad].qp, qpMax)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/moonfdd/x264-go/libx264"
+)
+
+func TestQpfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		qpMax   int
+		want    map[int]qpEntry
+		readErr bool
+		checkOK bool
+	}{
+		{"types and qps", "# comment\n0 I\n\n10 P 30\n20 b -1\n", 51,
+			map[int]qpEntry{0: {libx264.X264_TYPE_IDR, -1}, 10: {libx264.X264_TYPE_P, 30}, 20: {libx264.X264_TYPE_B, -1}}, false, true},
+		{"10-bit qp on 8-bit", "0 I 60\n", 51, map[int]qpEntry{0: {libx264.X264_TYPE_IDR, 60}}, false, false},
+		{"10-bit qp on 10-bit", "0 I 60\n", 63, map[int]qpEntry{0: {libx264.X264_TYPE_IDR, 60}}, false, true},
+		{"qp above any bit depth", "0 I 64\n", 63, nil, true, false},
+		{"unknown type", "0 X\n", 51, nil, true, false},
+		{"negative frame", "-1 P\n", 51, nil, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "qpfile.txt")
+			if err := os.WriteFile(path, []byte(tt.text), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			entries, err := readQpfile(path)
+			if (err != nil) != tt.readErr {
+				t.Fatalf("readQpfile: %v", err)
+			}
+			if err != nil {
+				return
+			}
+			if len(entries) != len(tt.want) {
+				t.Fatalf("entries %v, want %v", entries, tt.want)
+			}
+			for frame, e := range tt.want {
+				if entries[frame] != e {
+					t.Errorf("frame %d: %+v, want %+v", frame, entries[frame], e)
+				}
+			}
+			if err := checkQpfile(entries, tt.qpMax); (err == nil) != tt.checkOK {
+				t.Errorf("checkQpfile: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+// Package dash writes MPEG-DASH presentations: fMP4 segments cut on
+// encoder keyframes and an MPD using SegmentTemplate/SegmentTimeline, for
+// both the static (on-demand) and dynamic (live) profiles.
+package dash
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	ProfileLive      = "urn:mpeg:dash:profile:isoff-live:2011"
+	mpdNamespace     = "urn:mpeg:dash:schema:mpd:2011"
+	TypeStatic       = "static"
+	TypeDynamic      = "dynamic"
+	mimeTypeVideoMP4 = "video/mp4"
+)
+
+// MPD is the root of a media presentation description.
+type MPD struct {
+	XMLName                    xml.Name `xml:"MPD"`
+	Xmlns                      string   `xml:"xmlns,attr"`
+	Profiles                   string   `xml:"profiles,attr"`
+	Type                       string   `xml:"type,attr"`
+	MinBufferTime              string   `xml:"minBufferTime,attr"`
+	MediaPresentationDuration  string   `xml:"mediaPresentationDuration,attr,omitempty"`
+	AvailabilityStartTime      string   `xml:"availabilityStartTime,attr,omitempty"`
+	PublishTime                string   `xml:"publishTime,attr,omitempty"`
+	MinimumUpdatePeriod        string   `xml:"minimumUpdatePeriod,attr,omitempty"`
+	TimeShiftBufferDepth       string   `xml:"timeShiftBufferDepth,attr,omitempty"`
+	SuggestedPresentationDelay string   `xml:"suggestedPresentationDelay,attr,omitempty"`
+	Periods                    []Period `xml:"Period"`
+}
+
+type Period struct {
+	ID             string          `xml:"id,attr"`
+	Start          string          `xml:"start,attr"`
+	AdaptationSets []AdaptationSet `xml:"AdaptationSet"`
+}
+
+type AdaptationSet struct {
+	MimeType         string           `xml:"mimeType,attr"`
+	SegmentAlignment bool             `xml:"segmentAlignment,attr"`
+	StartWithSAP     int              `xml:"startWithSAP,attr"`
+	Representations  []Representation `xml:"Representation"`
+}
+
+type Representation struct {
+	ID              string           `xml:"id,attr"`
+	Codecs          string           `xml:"codecs,attr"`
+	Width           int              `xml:"width,attr,omitempty"`
+	Height          int              `xml:"height,attr,omitempty"`
+	FrameRate       string           `xml:"frameRate,attr,omitempty"`
+	Bandwidth       int              `xml:"bandwidth,attr"`
+	SegmentTemplate *SegmentTemplate `xml:"SegmentTemplate"`
+}
+
+type SegmentTemplate struct {
+	Timescale              uint32           `xml:"timescale,attr"`
+	PresentationTimeOffset uint64           `xml:"presentationTimeOffset,attr,omitempty"`
+	Initialization         string           `xml:"initialization,attr"`
+	Media                  string           `xml:"media,attr"`
+	SegmentTimeline        *SegmentTimeline `xml:"SegmentTimeline"`
+}
+
+type SegmentTimeline struct {
+	S []S `xml:"S"`
+}
+
+// S is a run of R+1 consecutive segments of duration D starting at T.
+type S struct {
+	T *uint64 `xml:"t,attr"`
+	D uint64  `xml:"d,attr"`
+	R int     `xml:"r,attr,omitempty"`
+}
+
+// WriteTo writes the MPD as XML.
+func (m *MPD) WriteTo(w io.Writer) (int64, error) {
+	out, err := xml.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return int64(n), err
+	}
+	n2, err := w.Write(append(out, '\n'))
+	return int64(n + n2), err
+}
+
+// Timeline compacts segment start times and durations into S elements.
+// A t attribute is only written when a segment does not follow the previous
+// one contiguously.
+func Timeline(starts, durations []uint64) *SegmentTimeline {
+	tl := &SegmentTimeline{}
+	var next uint64
+	for i := range starts {
+		contiguous := i > 0 && starts[i] == next
+		if n := len(tl.S); contiguous && tl.S[n-1].D == durations[i] {
+			tl.S[n-1].R++
+		} else {
+			s := S{D: durations[i]}
+			if !contiguous {
+				t := starts[i]
+				s.T = &t
+			}
+			tl.S = append(tl.S, s)
+		}
+		next = starts[i] + durations[i]
+	}
+	return tl
+}
+
+// Duration formats d as an xs:duration, e.g. "PT4.000S".
+func Duration(d time.Duration) string {
+	return fmt.Sprintf("PT%.3fS", d.Seconds())
+}
@@ -0,0 +1,35 @@
+package dash
+
+import (
+	"github.com/moonfdd/x264-go/libx264"
+)
+
+type writerSink struct {
+	w *Writer
+}
+
+// Sink returns the writer as a libx264.Sink.  The init segment is written
+// from the parameter sets passed to WriteHeaders.
+func (w *Writer) Sink() libx264.Sink {
+	return writerSink{w}
+}
+
+func (k writerSink) WriteHeaders(nals []libx264.X264NalT) error {
+	units := make([][]byte, 0, len(nals))
+	for i := range nals {
+		units = append(units, nals[i].Unit())
+	}
+	return k.w.WriteHeaders(units)
+}
+
+func (k writerSink) WriteFrame(f *libx264.Frame) error {
+	var data []byte
+	for i := range f.Nals {
+		data = f.Nals[i].AppendAnnexB(data)
+	}
+	return k.w.WriteFrame(data, f.Pts, f.Dts, f.Keyframe)
+}
+
+func (k writerSink) Close() error {
+	return k.w.Close()
+}
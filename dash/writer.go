@@ -0,0 +1,309 @@
+package dash
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/moonfdd/x264-go/fmp4"
+	"github.com/moonfdd/x264-go/h264"
+	"github.com/moonfdd/x264-go/internal/media"
+	"github.com/moonfdd/x264-go/libx264"
+)
+
+// Config describes one DASH representation written to a directory.
+type Config struct {
+	Dir          string
+	ManifestName string /* default "manifest.mpd" */
+	InitName     string /* default "init.mp4" */
+	/* media segment template, $Time$ is replaced by the segment start time; default "segment-$Time$.m4s" */
+	MediaPattern string
+
+	/* segments are cut on the first keyframe at or after this duration */
+	TargetDuration time.Duration
+
+	/* dynamic (live) MPD; otherwise a static MPD is written */
+	Live bool
+	/* number of segments kept in a live timeline, 0 keeps all of them */
+	WindowSize     int
+	DeleteSegments bool
+	/* wall clock time of the first frame for live MPDs, default time of the first frame */
+	AvailabilityStartTime time.Time
+
+	/* track timescale, default 90000 */
+	Timescale uint32
+	/* timebase of the PTS/DTS passed to WriteFrame, i.e. i_timebase_num/i_timebase_den */
+	TimebaseNum int64
+	TimebaseDen int64
+
+	RepresentationID string /* default "0" */
+	FrameRate        string /* optional, e.g. "25" or "30000/1001" */
+}
+
+var ErrClosed = errors.New("dash: writer closed")
+var ErrNoHeaders = errors.New("dash: no SPS/PPS before the first keyframe")
+
+// Writer segments encoder output into fMP4 files and maintains the MPD.
+type Writer struct {
+	cfg Config
+
+	sps, pps [][]byte
+	codec    string
+	width    int
+	height   int
+
+	started  bool
+	frag     *fmp4.Fragmenter
+	sequence uint32
+
+	starts    []uint64
+	durations []uint64
+	names     []string
+	firstPts  int64
+	bandwidth int
+	closed    bool
+}
+
+// NewWriter creates cfg.Dir if needed and returns a writer.
+func NewWriter(cfg Config) (*Writer, error) {
+	if cfg.ManifestName == "" {
+		cfg.ManifestName = "manifest.mpd"
+	}
+	if cfg.InitName == "" {
+		cfg.InitName = "init.mp4"
+	}
+	if cfg.MediaPattern == "" {
+		cfg.MediaPattern = "segment-$Time$.m4s"
+	}
+	if cfg.TargetDuration <= 0 {
+		cfg.TargetDuration = 4 * time.Second
+	}
+	if cfg.Timescale == 0 {
+		cfg.Timescale = 90000
+	}
+	if cfg.RepresentationID == "" {
+		cfg.RepresentationID = "0"
+	}
+	if cfg.TimebaseNum <= 0 || cfg.TimebaseDen <= 0 {
+		return nil, errors.New("dash: invalid timebase")
+	}
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, err
+	}
+	frag, err := fmp4.NewFragmenter(cfg.Timescale, cfg.TimebaseNum, cfg.TimebaseDen)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{cfg: cfg, frag: frag}, nil
+}
+
+// Codec returns the RFC 6381 codec string derived from the SPS, e.g.
+// "avc1.64001f".  It is empty until the parameter sets have been seen.
+func (w *Writer) Codec() string {
+	return w.codec
+}
+
+// ManifestPath returns the path of the MPD.
+func (w *Writer) ManifestPath() string {
+	return filepath.Join(w.cfg.Dir, w.cfg.ManifestName)
+}
+
+// WriteHeaders supplies the parameter sets, e.g. from X264EncoderHeaders.
+// Otherwise they are taken from the first keyframe.
+func (w *Writer) WriteHeaders(units [][]byte) error {
+	sps, pps := h264.ParameterSets(units)
+	if len(sps) == 0 || len(pps) == 0 {
+		return ErrNoHeaders
+	}
+	info, err := h264.ParseSPS(sps[0])
+	if err != nil {
+		return err
+	}
+	w.sps = copyUnits(sps)
+	w.pps = copyUnits(pps)
+	w.codec = info.Codec()
+	w.width, w.height = info.Width, info.Height
+	init, err := fmp4.InitSegment(w.sps, w.pps, w.cfg.Timescale)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(w.cfg.Dir, w.cfg.InitName), init, 0644)
+}
+
+// KeyframeDue reports whether the frame with the given input pts should be
+// forced to be an IDR frame so that the current segment ends on time.
+func (w *Writer) KeyframeDue(pts int64) bool {
+	if !w.started {
+		return false
+	}
+	start, _ := w.frag.Start()
+	return w.duration(w.frag.Scale(pts)-start) >= w.cfg.TargetDuration
+}
+
+// WriteNals writes one encoded picture as returned by X264EncoderEncode.
+func (w *Writer) WriteNals(nals []libx264.X264NalT, pic_out *libx264.X264PictureT) error {
+	var data []byte
+	for i := range nals {
+		data = nals[i].AppendAnnexB(data)
+	}
+	return w.WriteFrame(data, pic_out.IPts, pic_out.Dts(), pic_out.IsKeyframe())
+}
+
+// WriteFrame writes one Annex-B access unit with timestamps in the
+// configured timebase.
+func (w *Writer) WriteFrame(data []byte, pts, dts int64, keyframe bool) error {
+	if w.closed {
+		return ErrClosed
+	}
+	units := h264.SplitAnnexB(data)
+	first := !w.started
+	if first {
+		if !keyframe {
+			return nil
+		}
+		if w.sps == nil {
+			if err := w.WriteHeaders(units); err != nil {
+				return err
+			}
+		}
+		w.started = true
+		if w.cfg.Live && w.cfg.AvailabilityStartTime.IsZero() {
+			w.cfg.AvailabilityStartTime = time.Now()
+		}
+	}
+
+	ptsT, _ := w.frag.Push(units, pts, dts, keyframe)
+	if first {
+		w.firstPts = ptsT
+	}
+	start, _ := w.frag.Start()
+	if keyframe && w.frag.Len() > 0 && w.duration(ptsT-start) >= w.cfg.TargetDuration {
+		return w.finishSegment(ptsT)
+	}
+	return nil
+}
+
+// Close writes the last segment and the final MPD.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	w.frag.Finish()
+	if w.frag.Len() > 0 {
+		if err := w.finishSegment(w.frag.End()); err != nil {
+			return err
+		}
+	}
+	return w.writeManifest(true)
+}
+
+func (w *Writer) finishSegment(end int64) error {
+	segPts, _ := w.frag.Start()
+	start := uint64(segPts)
+	name := w.mediaName(start)
+	dur := uint64(end - segPts)
+	if secs := w.duration(int64(dur)).Seconds(); secs > 0 {
+		if bw := int(float64(w.frag.Size()*8) / secs); bw > w.bandwidth {
+			w.bandwidth = bw
+		}
+	}
+	w.sequence++
+	samples, base := w.frag.Flush()
+	seg := fmp4.MediaSegment(w.sequence, base, samples)
+	if err := os.WriteFile(filepath.Join(w.cfg.Dir, name), seg, 0644); err != nil {
+		return err
+	}
+
+	w.starts = append(w.starts, start)
+	w.durations = append(w.durations, dur)
+	w.names = append(w.names, name)
+
+	if n := w.cfg.WindowSize; w.cfg.Live && n > 0 && len(w.starts) > n {
+		drop := len(w.starts) - n
+		if w.cfg.DeleteSegments {
+			for _, old := range w.names[:drop] {
+				os.Remove(filepath.Join(w.cfg.Dir, old))
+			}
+		}
+		w.starts = w.starts[drop:]
+		w.durations = w.durations[drop:]
+		w.names = w.names[drop:]
+	}
+	return w.writeManifest(false)
+}
+
+func (w *Writer) writeManifest(final bool) error {
+	mpd := &MPD{
+		Xmlns:         mpdNamespace,
+		Profiles:      ProfileLive,
+		Type:          TypeStatic,
+		MinBufferTime: Duration(w.cfg.TargetDuration),
+	}
+	var total uint64
+	if len(w.starts) > 0 {
+		total = w.starts[len(w.starts)-1] + w.durations[len(w.durations)-1] - uint64(w.firstPts)
+	}
+	if w.cfg.Live {
+		mpd.Type = TypeDynamic
+		mpd.AvailabilityStartTime = w.cfg.AvailabilityStartTime.UTC().Format(time.RFC3339)
+		mpd.PublishTime = time.Now().UTC().Format(time.RFC3339)
+		if final {
+			mpd.MediaPresentationDuration = Duration(w.duration(int64(total)))
+		} else {
+			mpd.MinimumUpdatePeriod = Duration(w.cfg.TargetDuration)
+			mpd.SuggestedPresentationDelay = Duration(3 * w.cfg.TargetDuration)
+			if w.cfg.WindowSize > 0 {
+				mpd.TimeShiftBufferDepth = Duration(time.Duration(w.cfg.WindowSize) * w.cfg.TargetDuration)
+			}
+		}
+	} else {
+		mpd.MediaPresentationDuration = Duration(w.duration(int64(total)))
+	}
+
+	rep := Representation{
+		ID:        w.cfg.RepresentationID,
+		Codecs:    w.codec,
+		Width:     w.width,
+		Height:    w.height,
+		FrameRate: w.cfg.FrameRate,
+		Bandwidth: w.bandwidth,
+		SegmentTemplate: &SegmentTemplate{
+			Timescale:              w.cfg.Timescale,
+			PresentationTimeOffset: uint64(w.firstPts),
+			Initialization:         w.cfg.InitName,
+			Media:                  w.cfg.MediaPattern,
+			SegmentTimeline:        Timeline(w.starts, w.durations),
+		},
+	}
+	mpd.Periods = []Period{{
+		ID:    "0",
+		Start: "PT0S",
+		AdaptationSets: []AdaptationSet{{
+			MimeType:         mimeTypeVideoMP4,
+			SegmentAlignment: true,
+			StartWithSAP:     1,
+			Representations:  []Representation{rep},
+		}},
+	}}
+	return media.WriteFileAtomic(w.ManifestPath(), mpd)
+}
+
+func (w *Writer) mediaName(t uint64) string {
+	return strings.Replace(w.cfg.MediaPattern, "$Time$", strconv.FormatUint(t, 10), -1)
+}
+
+func (w *Writer) duration(ticks int64) time.Duration {
+	return time.Duration(media.Rescale(ticks, int64(time.Second), int64(w.cfg.Timescale)))
+}
+
+func copyUnits(units [][]byte) [][]byte {
+	out := make([][]byte, len(units))
+	for i, u := range units {
+		out[i] = append([]byte(nil), u...)
+	}
+	return out
+}
@@ -0,0 +1,169 @@
+package dash
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+/* 1280x720 High level 3.1 */
+var testSPS, _ = hex.DecodeString("6764001facd9405005bb011000000300100000030300f1831960")
+var testPPS = []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0}
+
+func annexB(units ...[]byte) []byte {
+	var b []byte
+	for _, u := range units {
+		b = append(b, 0, 0, 0, 1)
+		b = append(b, u...)
+	}
+	return b
+}
+
+func u64(v uint64) *uint64 { return &v }
+
+func TestTimeline(t *testing.T) {
+	tests := []struct {
+		name      string
+		starts    []uint64
+		durations []uint64
+		want      []S
+	}{
+		{"empty", nil, nil, nil},
+		{"repeat", []uint64{0, 10, 20, 30}, []uint64{10, 10, 10, 10}, []S{{T: u64(0), D: 10, R: 3}}},
+		{"duration change", []uint64{5, 15, 25, 32}, []uint64{10, 10, 7, 7},
+			[]S{{T: u64(5), D: 10, R: 1}, {D: 7, R: 1}}},
+		{"gap", []uint64{0, 10, 40}, []uint64{10, 10, 10}, []S{{T: u64(0), D: 10, R: 1}, {T: u64(40), D: 10}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Timeline(tt.starts, tt.durations).S
+			if len(got) != len(tt.want) {
+				t.Fatalf("%d S elements, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				g, w := got[i], tt.want[i]
+				if g.D != w.D || g.R != w.R || (g.T == nil) != (w.T == nil) || g.T != nil && *g.T != *w.T {
+					t.Errorf("S[%d] = %+v, want %+v", i, g, w)
+				}
+			}
+		})
+	}
+}
+
+func TestDuration(t *testing.T) {
+	for _, tt := range []struct {
+		d    time.Duration
+		want string
+	}{
+		{4 * time.Second, "PT4.000S"},
+		{1500 * time.Millisecond, "PT1.500S"},
+		{0, "PT0.000S"},
+	} {
+		if got := Duration(tt.d); got != tt.want {
+			t.Errorf("Duration(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestWriter(t *testing.T) {
+	tests := []struct {
+		name     string
+		live     bool
+		window   int
+		frames   int
+		gop      int
+		wantType string
+		wantS    []S
+	}{
+		/* 25 fps, 2 s GOPs, 4 s target: segments of 4 s, the last 2.4 s */
+		{"static", false, 0, 260, 50, TypeStatic, []S{{T: u64(0), D: 360000, R: 1}, {D: 216000}}},
+		{"live window", true, 1, 260, 50, TypeDynamic, []S{{T: u64(720000), D: 216000}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			w, err := NewWriter(Config{
+				Dir:            dir,
+				TargetDuration: 4 * time.Second,
+				Live:           tt.live,
+				WindowSize:     tt.window,
+				DeleteSegments: true,
+				TimebaseNum:    1,
+				TimebaseDen:    25,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < tt.frames; i++ {
+				data := annexB([]byte{0x41, 0x9a, 1, 2})
+				if i%tt.gop == 0 {
+					data = annexB(testSPS, testPPS, []byte{0x65, 0x88, 1, 2})
+				}
+				if err := w.WriteFrame(data, int64(i), int64(i), i%tt.gop == 0); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if w.Codec() != "avc1.64001f" {
+				t.Errorf("codec %q", w.Codec())
+			}
+
+			raw, err := os.ReadFile(w.ManifestPath())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var mpd MPD
+			if err := xml.Unmarshal(raw, &mpd); err != nil {
+				t.Fatal(err)
+			}
+			if mpd.Type != tt.wantType || mpd.MediaPresentationDuration != "PT10.400S" {
+				t.Errorf("type %q duration %q", mpd.Type, mpd.MediaPresentationDuration)
+			}
+			rep := mpd.Periods[0].AdaptationSets[0].Representations[0]
+			if rep.Codecs != "avc1.64001f" || rep.Width != 1280 || rep.Height != 720 || rep.Bandwidth <= 0 {
+				t.Errorf("representation %+v", rep)
+			}
+			got := rep.SegmentTemplate.SegmentTimeline.S
+			if len(got) != len(tt.wantS) {
+				t.Fatalf("timeline %+v, want %d S elements", got, len(tt.wantS))
+			}
+			var t0 uint64
+			for i := range got {
+				g, want := got[i], tt.wantS[i]
+				if g.D != want.D || g.R != want.R || (g.T == nil) != (want.T == nil) || g.T != nil && *g.T != *want.T {
+					t.Errorf("S[%d] = %+v, want %+v", i, g, want)
+				}
+				if g.T != nil {
+					t0 = *g.T
+				}
+				for r := 0; r <= g.R; r++ {
+					name := filepath.Join(dir, w.mediaName(t0))
+					if _, err := os.Stat(name); err != nil {
+						t.Errorf("segment %s: %v", name, err)
+					}
+					t0 += g.D
+				}
+			}
+			if _, err := os.Stat(filepath.Join(dir, "init.mp4")); err != nil {
+				t.Error(err)
+			}
+			if tt.window > 0 {
+				if _, err := os.Stat(filepath.Join(dir, w.mediaName(0))); !os.IsNotExist(err) {
+					t.Errorf("segment outside the window kept: %v", err)
+				}
+			}
+			if !bytes.HasPrefix(raw, []byte(xml.Header)) {
+				t.Error("no XML header")
+			}
+		})
+	}
+	if _, err := NewWriter(Config{Dir: t.TempDir()}); err == nil {
+		t.Error("NewWriter accepted a zero timebase")
+	}
+}
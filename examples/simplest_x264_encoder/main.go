@@ -4,7 +4,6 @@ package main
 import (
 	"fmt"
 	"os"
-	"unsafe"
 
 	"github.com/moonfdd/ffmpeg-go/ffcommon"
 	"github.com/moonfdd/x264-go/libx264"
@@ -13,14 +12,13 @@ import (
 
 func main0() ffcommon.FInt {
 
-	var ret ffcommon.FInt
 	var y_size ffcommon.FInt
-	var i, j ffcommon.FInt
+	var i ffcommon.FInt
 
 	//FILE* fp_src  = fopen("../cuc_ieschool_640x360_yuv444p.yuv", "rb");
 	fp_src, _ := os.Open("./resources/cuc_ieschool_640x360_yuv420p.yuv")
 	fp_dst_file := "./out/cuc_ieschool_640x360_yuv420p.h264"
-	fp_dst, _ := os.Create(fp_dst_file)
+	fp_dst, _ := libx264.NewAnnexBFileSink(fp_dst_file)
 
 	//Encode 50 frame
 	//if set 0, encode all frame
@@ -28,11 +26,8 @@ func main0() ffcommon.FInt {
 	var csp ffcommon.FInt = libx264.X264_CSP_I420
 	var width, height ffcommon.FInt = 640, 360
 
-	var iNal ffcommon.FInt = 0
-	var pNals *libx264.X264NalT
-	var pHandle *libx264.X264T
+	var pHandle *libx264.Encoder
 	pPic_in := new(libx264.X264PictureT)
-	pPic_out := new(libx264.X264PictureT)
 	pParam := new(libx264.X264ParamT)
 
 	//Check
@@ -65,13 +60,14 @@ func main0() ffcommon.FInt {
 	pParam.ICsp = csp
 	pParam.X264ParamApplyProfile(libx264.X264ProfileNames[5])
 
-	pHandle = pParam.X264EncoderOpen164()
+	pHandle, err := libx264.NewEncoder(pParam, fp_dst)
+	if err != nil {
+		fmt.Printf("Error open encoder.\n")
+		return -1
+	}
 
-	pPic_out.X264PictureInit()
 	pPic_in.X264PictureAlloc(csp, pParam.IWidth, pParam.IHeight)
 
-	//ret = x264_encoder_headers(pHandle, &pNals, &iNal);
-
 	y_size = pParam.IWidth * pParam.IHeight
 	//detect frame number
 	if frame_num == 0 {
@@ -110,41 +106,24 @@ func main0() ffcommon.FInt {
 		}
 		pPic_in.IPts = int64(i)
 
-		ret = pHandle.X264EncoderEncode(&pNals, &iNal, pPic_in, pPic_out)
-		if ret < 0 {
+		if err = pHandle.Encode(pPic_in); err != nil {
 			fmt.Printf("Error.\n")
 			return -1
 		}
 
 		fmt.Printf("Succeed encode frame: %5d\n", i)
-
-		for j = 0; j < iNal; j++ {
-			a := unsafe.Sizeof(libx264.X264NalT{})
-			pNal := (*libx264.X264NalT)(unsafe.Pointer(uintptr(unsafe.Pointer(pNals)) + uintptr(a*uintptr(j))))
-			fp_dst.Write(ffcommon.ByteSliceFromByteP(pNal.PPayload, int(pNal.IPayload)))
-		}
 	}
-	i = 0
 	//flush encoder
-	for {
-		ret = pHandle.X264EncoderEncode(&pNals, &iNal, nil, pPic_out)
-		if ret == 0 {
-			break
-		}
-		fmt.Printf("Flush 1 frame.\n")
-		for j = 0; j < iNal; j++ {
-			a := unsafe.Sizeof(libx264.X264NalT{})
-			pNal := (*libx264.X264NalT)(unsafe.Pointer(uintptr(unsafe.Pointer(pNals)) + uintptr(a*uintptr(j))))
-			fp_dst.Write(ffcommon.ByteSliceFromByteP(pNal.PPayload, int(pNal.IPayload)))
-		}
-		i++
+	if err = pHandle.Flush(); err != nil {
+		fmt.Printf("Error.\n")
+		return -1
 	}
 	pPic_in.X264PictureClean()
-	pHandle.X264EncoderClose()
+	//close encoder and output file
+	pHandle.Close()
 	pHandle = nil
 
 	fp_src.Close()
-	fp_dst.Close()
 
 	fmt.Printf("\nffplay %s\n", fp_dst_file)
 
@@ -0,0 +1,78 @@
+// Package fmp4 writes fragmented MP4 (ISO BMFF) initialization and media
+// segments for a single H.264 video track, as used by DASH and HLS.
+package fmp4
+
+import (
+	"encoding/binary"
+)
+
+// box is an ISO BMFF box under construction.
+type box struct {
+	buf []byte
+}
+
+func newBox(typ string) *box {
+	b := &box{buf: make([]byte, 8, 64)}
+	copy(b.buf[4:], typ)
+	return b
+}
+
+func newFullBox(typ string, version byte, flags uint32) *box {
+	b := newBox(typ)
+	b.u32(uint32(version)<<24 | flags&0xffffff)
+	return b
+}
+
+func (b *box) u8(v byte) *box {
+	b.buf = append(b.buf, v)
+	return b
+}
+
+func (b *box) u16(v uint16) *box {
+	b.buf = append(b.buf, byte(v>>8), byte(v))
+	return b
+}
+
+func (b *box) u32(v uint32) *box {
+	b.buf = append(b.buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	return b
+}
+
+func (b *box) u64(v uint64) *box {
+	b.u32(uint32(v >> 32))
+	return b.u32(uint32(v))
+}
+
+func (b *box) bytes(p []byte) *box {
+	b.buf = append(b.buf, p...)
+	return b
+}
+
+func (b *box) zeros(n int) *box {
+	for i := 0; i < n; i++ {
+		b.buf = append(b.buf, 0)
+	}
+	return b
+}
+
+func (b *box) add(children ...*box) *box {
+	for _, c := range children {
+		b.buf = append(b.buf, c.finish()...)
+	}
+	return b
+}
+
+func (b *box) finish() []byte {
+	binary.BigEndian.PutUint32(b.buf, uint32(len(b.buf)))
+	return b.buf
+}
+
+/* unity transformation matrix used by mvhd and tkhd */
+var unityMatrix = []uint32{0x00010000, 0, 0, 0, 0x00010000, 0, 0, 0, 0x40000000}
+
+func (b *box) matrix() *box {
+	for _, v := range unityMatrix {
+		b.u32(v)
+	}
+	return b
+}
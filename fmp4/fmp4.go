@@ -0,0 +1,137 @@
+package fmp4
+
+import (
+	"github.com/moonfdd/x264-go/h264"
+)
+
+const TrackID = 1
+
+// Sample is one coded picture of a media segment.  Times are in the track
+// timescale.
+type Sample struct {
+	Data                  []byte /* length-prefixed NAL units (h264.AVCC) */
+	Duration              uint32
+	CompositionTimeOffset int32 /* pts - dts */
+	Keyframe              bool
+}
+
+// InitSegment returns the ftyp and moov boxes describing the video track
+// whose parameter sets are sps and pps.
+func InitSegment(sps, pps [][]byte, timescale uint32) ([]byte, error) {
+	avcC, err := h264.DecoderConfigurationRecord(sps, pps)
+	if err != nil {
+		return nil, err
+	}
+	info, err := h264.ParseSPS(sps[0])
+	if err != nil {
+		return nil, err
+	}
+	width, height := uint16(info.Width), uint16(info.Height)
+
+	ftyp := newBox("ftyp").bytes([]byte("iso6")).u32(0).bytes([]byte("iso6cmfcavc1dash"))
+
+	mvhd := newFullBox("mvhd", 0, 0).
+		u32(0).u32(0). /* creation/modification time */
+		u32(timescale).u32(0).
+		u32(0x00010000).u16(0x0100).zeros(10). /* rate, volume, reserved */
+		matrix().zeros(24).
+		u32(TrackID + 1)
+
+	tkhd := newFullBox("tkhd", 0, 3). /* enabled, in movie */
+						u32(0).u32(0).u32(TrackID).u32(0).u32(0).
+						zeros(8).u16(0).u16(0).u16(0).u16(0).
+						matrix().
+						u32(uint32(width) << 16).u32(uint32(height) << 16)
+
+	mdhd := newFullBox("mdhd", 0, 0).
+		u32(0).u32(0).u32(timescale).u32(0).
+		u16(0x55c4). /* language "und" */
+		u16(0)
+
+	hdlr := newFullBox("hdlr", 0, 0).
+		u32(0).bytes([]byte("vide")).zeros(12).bytes([]byte("VideoHandler\x00"))
+
+	avc1 := newBox("avc1").
+		zeros(6).u16(1). /* data_reference_index */
+		zeros(16).
+		u16(width).u16(height).
+		u32(0x00480000).u32(0x00480000). /* 72 dpi */
+		u32(0).u16(1).                   /* frame_count */
+		zeros(32).                       /* compressorname */
+		u16(0x0018).u16(0xffff).
+		add(newBox("avcC").bytes(avcC))
+
+	stbl := newBox("stbl").add(
+		newFullBox("stsd", 0, 0).u32(1).add(avc1),
+		newFullBox("stts", 0, 0).u32(0),
+		newFullBox("stsc", 0, 0).u32(0),
+		newFullBox("stsz", 0, 0).u32(0).u32(0),
+		newFullBox("stco", 0, 0).u32(0),
+	)
+	minf := newBox("minf").add(
+		newFullBox("vmhd", 0, 1).zeros(8),
+		newBox("dinf").add(newFullBox("dref", 0, 0).u32(1).add(newFullBox("url ", 0, 1))),
+		stbl,
+	)
+	trak := newBox("trak").add(tkhd, newBox("mdia").add(mdhd, hdlr, minf))
+	mvex := newBox("mvex").add(
+		newFullBox("trex", 0, 0).u32(TrackID).u32(1).u32(0).u32(0).u32(0),
+	)
+	moov := newBox("moov").add(mvhd, trak, mvex)
+
+	out := append([]byte(nil), ftyp.finish()...)
+	return append(out, moov.finish()...), nil
+}
+
+// MediaSegment returns a styp box followed by a Fragment, for use as a
+// DASH or HLS media segment.
+func MediaSegment(sequence uint32, baseDecodeTime uint64, samples []Sample) []byte {
+	styp := newBox("styp").bytes([]byte("msdh")).u32(0).bytes([]byte("msdhmsixcmfs"))
+	return append(styp.finish(), Fragment(sequence, baseDecodeTime, samples)...)
+}
+
+// Fragment returns a moof and mdat holding samples, the first of which is
+// decoded at baseDecodeTime.
+func Fragment(sequence uint32, baseDecodeTime uint64, samples []Sample) []byte {
+	const trunFlags = 0x000001 | 0x000100 | 0x000200 | 0x000400 | 0x000800 /* data offset, duration, size, flags, cts */
+	trun := newFullBox("trun", 1, trunFlags).u32(uint32(len(samples)))
+	dataOffsetPos := len(trun.buf)
+	trun.u32(0)
+	mdatSize := 8
+	for _, s := range samples {
+		flags := uint32(0x01010000) /* sample_depends_on=1, is_non_sync */
+		if s.Keyframe {
+			flags = 0x02000000 /* sample_depends_on=2 */
+		}
+		trun.u32(s.Duration).u32(uint32(len(s.Data))).u32(flags).u32(uint32(s.CompositionTimeOffset))
+		mdatSize += len(s.Data)
+	}
+
+	traf := newBox("traf").add(
+		newFullBox("tfhd", 0, 0x020000).u32(TrackID), /* default-base-is-moof */
+		newFullBox("tfdt", 1, 0).u64(baseDecodeTime),
+	)
+	moof := newBox("moof").add(newFullBox("mfhd", 0, 0).u32(sequence))
+
+	traf.add(trun)
+	moof.add(traf)
+	moofBytes := moof.finish()
+
+	/* trun's data_offset is relative to the start of moof and points past
+	 * the mdat header; trun is the last box of moof */
+	trunStart := len(moofBytes) - len(trun.buf)
+	putU32(moofBytes[trunStart+dataOffsetPos:], uint32(len(moofBytes)+8))
+
+	out := make([]byte, 0, len(moofBytes)+mdatSize)
+	out = append(out, moofBytes...)
+	out = append(out, 0, 0, 0, 0, 'm', 'd', 'a', 't')
+	putU32(out[len(moofBytes):], uint32(mdatSize))
+	for _, s := range samples {
+		out = append(out, s.Data...)
+	}
+	return out
+}
+
+func putU32(b []byte, v uint32) {
+	b[0], b[1], b[2], b[3] = byte(v>>24), byte(v>>16), byte(v>>8), byte(v)
+}
@@ -0,0 +1,263 @@
+package fmp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+
+	"github.com/moonfdd/ffmpeg-go/ffcommon"
+	"github.com/moonfdd/x264-go/libx264"
+)
+
+/* 320x240 Constrained Baseline level 1.3 */
+var testSPS, _ = hex.DecodeString("6742c00dd90141fb0110000003001000000303c0f142a480")
+var testPPS = []byte{0x68, 0xce, 0x3c, 0x80}
+
+func annexB(units ...[]byte) []byte {
+	var b []byte
+	for _, u := range units {
+		b = append(b, 0, 0, 0, 1)
+		b = append(b, u...)
+	}
+	return b
+}
+
+type testBox struct {
+	typ  string
+	body []byte
+}
+
+func parseBoxes(t *testing.T, b []byte) []testBox {
+	t.Helper()
+	var boxes []testBox
+	for len(b) > 0 {
+		if len(b) < 8 {
+			t.Fatalf("truncated box header")
+		}
+		size := int(binary.BigEndian.Uint32(b))
+		if size < 8 || size > len(b) {
+			t.Fatalf("box %q: size %d of %d bytes", b[4:8], size, len(b))
+		}
+		boxes = append(boxes, testBox{string(b[4:8]), b[8:size]})
+		b = b[size:]
+	}
+	return boxes
+}
+
+func child(t *testing.T, b []byte, path ...string) []byte {
+	t.Helper()
+	for _, typ := range path {
+		found := false
+		for _, c := range parseBoxes(t, b) {
+			if c.typ == typ {
+				b, found = c.body, true
+				break
+			}
+		}
+		if !found {
+			t.Fatalf("no %s box", typ)
+		}
+	}
+	return b
+}
+
+type testTrun struct {
+	durations []uint32
+	sizes     []uint32
+	cts       []int32
+	sync      []bool
+}
+
+func parseFragment(t *testing.T, moof []byte) (seq uint32, base uint64, trun testTrun) {
+	t.Helper()
+	seq = binary.BigEndian.Uint32(child(t, moof, "mfhd")[4:])
+	base = binary.BigEndian.Uint64(child(t, moof, "traf", "tfdt")[4:])
+	b := child(t, moof, "traf", "trun")
+	n := int(binary.BigEndian.Uint32(b[4:]))
+	for i := 0; i < n; i++ {
+		s := b[12+16*i:]
+		trun.durations = append(trun.durations, binary.BigEndian.Uint32(s))
+		trun.sizes = append(trun.sizes, binary.BigEndian.Uint32(s[4:]))
+		trun.sync = append(trun.sync, binary.BigEndian.Uint32(s[8:])&0x00010000 == 0)
+		trun.cts = append(trun.cts, int32(binary.BigEndian.Uint32(s[12:])))
+	}
+	return
+}
+
+func TestInitSegment(t *testing.T) {
+	init, err := InitSegment([][]byte{testSPS}, [][]byte{testPPS}, 90000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	boxes := parseBoxes(t, init)
+	if len(boxes) != 2 || boxes[0].typ != "ftyp" || boxes[1].typ != "moov" {
+		t.Fatalf("top level boxes %v", boxes)
+	}
+	tkhd := child(t, boxes[1].body, "trak", "tkhd")
+	if w, h := binary.BigEndian.Uint32(tkhd[76:])>>16, binary.BigEndian.Uint32(tkhd[80:])>>16; w != 320 || h != 240 {
+		t.Errorf("tkhd size %dx%d, want 320x240", w, h)
+	}
+	if ts := binary.BigEndian.Uint32(child(t, boxes[1].body, "trak", "mdia", "mdhd")[12:]); ts != 90000 {
+		t.Errorf("timescale %d", ts)
+	}
+	stsd := child(t, boxes[1].body, "trak", "mdia", "minf", "stbl", "stsd")
+	avcC := child(t, stsd[8:], "avc1")[78:]
+	if c := child(t, avcC, "avcC"); c[1] != 0x42 || c[3] != 13 {
+		t.Errorf("avcC profile %d level %d", c[1], c[3])
+	}
+}
+
+func TestFragmenter(t *testing.T) {
+	tests := []struct {
+		name      string
+		timescale uint32
+		num, den  int64
+		pts, dts  []int64
+		wantDur   []uint32
+		wantCTS   []int32
+		wantBase  uint64
+	}{
+		{"cfr", 90000, 1, 25, []int64{0, 1, 2, 3}, []int64{0, 1, 2, 3},
+			[]uint32{3600, 3600, 3600, 3600}, []int32{0, 0, 0, 0}, 0},
+		{"b-frames negative dts", 90000, 1, 25, []int64{0, 3, 1, 2}, []int64{-2, -1, 0, 1},
+			[]uint32{3600, 3600, 3600, 3600}, []int32{7200, 14400, 3600, 3600}, 0},
+		{"vfr millisecond", 1000, 1, 1000, []int64{100, 140, 180, 230}, []int64{100, 140, 180, 230},
+			[]uint32{40, 40, 50, 50}, []int32{0, 0, 0, 0}, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewFragmenter(tt.timescale, tt.num, tt.den)
+			if err != nil {
+				t.Fatal(err)
+			}
+			unit := []byte{0x65, 1, 2, 3}
+			for i := range tt.pts {
+				f.Push([][]byte{testSPS, testPPS, unit}, tt.pts[i], tt.dts[i], i == 0)
+				if f.Len() != i {
+					t.Fatalf("after %d pushes: %d samples", i+1, f.Len())
+				}
+			}
+			f.Finish()
+			samples, base := f.Flush()
+			if base != tt.wantBase {
+				t.Errorf("base decode time %d, want %d", base, tt.wantBase)
+			}
+			for i, s := range samples {
+				if s.Duration != tt.wantDur[i] || s.CompositionTimeOffset != tt.wantCTS[i] {
+					t.Errorf("sample %d: duration %d cts %d, want %d %d", i, s.Duration, s.CompositionTimeOffset, tt.wantDur[i], tt.wantCTS[i])
+				}
+				/* parameter sets are dropped, the slice is length prefixed */
+				if !bytes.Equal(s.Data, []byte{0, 0, 0, 4, 0x65, 1, 2, 3}) {
+					t.Errorf("sample %d: data %x", i, s.Data)
+				}
+				if s.Keyframe != (i == 0) {
+					t.Errorf("sample %d: keyframe %v", i, s.Keyframe)
+				}
+			}
+		})
+	}
+	if _, err := NewFragmenter(0, 1, 0); err == nil {
+		t.Error("NewFragmenter accepted a zero timebase denominator")
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var out bytes.Buffer
+	w, err := NewWriter(&out, 0, 1, 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slice := func(typ byte) []byte { return append([]byte{typ}, bytes.Repeat([]byte{0xab}, 50)...) }
+	const gop, frames = 5, 12
+	for i := 0; i < frames; i++ {
+		data := annexB(slice(0x41))
+		if i%gop == 0 {
+			data = annexB([]byte{9, 0x10}, testSPS, testPPS, slice(0x65))
+		}
+		if err := w.WriteFrame(data, int64(i), int64(i), i%gop == 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	boxes := parseBoxes(t, out.Bytes())
+	want := []string{"ftyp", "moov", "moof", "mdat", "moof", "mdat", "moof", "mdat"}
+	if len(boxes) != len(want) {
+		t.Fatalf("%d boxes, want %d", len(boxes), len(want))
+	}
+	for i, b := range boxes {
+		if b.typ != want[i] {
+			t.Fatalf("box %d is %s, want %s", i, b.typ, want[i])
+		}
+	}
+	for i, wantN := range []int{5, 5, 2} {
+		seq, base, trun := parseFragment(t, boxes[2+2*i].body)
+		if seq != uint32(i+1) || base != uint64(i*gop*3600) || len(trun.sizes) != wantN {
+			t.Errorf("fragment %d: sequence %d base %d samples %d", i, seq, base, len(trun.sizes))
+		}
+		mdat := 0
+		for j, size := range trun.sizes {
+			mdat += int(size)
+			if trun.durations[j] != 3600 || trun.sync[j] != (j == 0) {
+				t.Errorf("fragment %d sample %d: duration %d sync %v", i, j, trun.durations[j], trun.sync[j])
+			}
+		}
+		if len(boxes[3+2*i].body) != mdat {
+			t.Errorf("fragment %d: mdat %d bytes, samples %d", i, len(boxes[3+2*i].body), mdat)
+		}
+	}
+	if _, err := NewWriter(&out, 0, 1, 0); err != ErrTimebase {
+		t.Errorf("zero timebase denominator: %v", err)
+	}
+}
+
+/* x264Nal returns unit as x264 outputs it with b_annexb on or off */
+func x264Nal(unit []byte, annexb bool) libx264.X264NalT {
+	p := []byte{0, 0, 0, 1}
+	if !annexb {
+		binary.BigEndian.PutUint32(p, uint32(len(unit)))
+	}
+	p = append(p, unit...)
+	return libx264.X264NalT{
+		IRefIdc:        ffcommon.FInt(unit[0] >> 5),
+		IType:          ffcommon.FInt(unit[0] & 0x1f),
+		BLongStartcode: 1,
+		IPayload:       ffcommon.FInt(len(p)),
+		PPayload:       (*ffcommon.FUint8T)(&p[0]),
+	}
+}
+
+func TestWriterSink(t *testing.T) {
+	idr := append([]byte{0x65}, bytes.Repeat([]byte{0xab}, 50)...)
+	for _, annexb := range []bool{true, false} {
+		var out bytes.Buffer
+		w, err := NewWriter(&out, 0, 1, 25)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sink := w.Sink()
+		if err := sink.WriteHeaders([]libx264.X264NalT{x264Nal(testSPS, annexb), x264Nal(testPPS, annexb)}); err != nil {
+			t.Fatal(err)
+		}
+		f := &libx264.Frame{Nals: []libx264.X264NalT{x264Nal([]byte{9, 0x10}, annexb), x264Nal(idr, annexb)}, Keyframe: true}
+		if err := sink.WriteFrame(f); err != nil {
+			t.Fatal(err)
+		}
+		if err := sink.Close(); err != nil {
+			t.Fatal(err)
+		}
+		boxes := parseBoxes(t, out.Bytes())
+		if len(boxes) != 4 || boxes[3].typ != "mdat" {
+			t.Fatalf("annexb %v: %d boxes", annexb, len(boxes))
+		}
+		if !bytes.Contains(boxes[1].body, append([]byte{0, byte(len(testSPS))}, testSPS...)) {
+			t.Errorf("annexb %v: SPS missing from avcC", annexb)
+		}
+		want := append([]byte{0, 0, 0, byte(len(idr))}, idr...)
+		if !bytes.Equal(boxes[3].body, want) {
+			t.Errorf("annexb %v: mdat %x, want %x", annexb, boxes[3].body, want)
+		}
+	}
+}
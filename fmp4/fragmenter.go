@@ -0,0 +1,140 @@
+package fmp4
+
+import (
+	"errors"
+
+	"github.com/moonfdd/x264-go/h264"
+	"github.com/moonfdd/x264-go/internal/media"
+)
+
+var ErrTimebase = errors.New("fmp4: invalid timebase")
+
+// Fragmenter turns access units into the samples of fragments.  It
+// converts timestamps to the track timescale, shifted so that decode times
+// start non-negative, drops the parameter sets and delimiters carried by
+// the init segment, and completes every sample when the next decode time
+// gives its duration.  The caller decides where fragments are cut.
+type Fragmenter struct {
+	Timescale uint32
+	/* timebase of the timestamps passed to Push */
+	TimebaseNum int64
+	TimebaseDen int64
+
+	started          bool
+	offset           int64
+	pending          *Sample
+	pendPts, pendDts int64
+	lastDur          int64
+
+	samples            []Sample
+	startPts, startDts int64 /* of the open fragment */
+	maxPts             int64
+	size               int
+}
+
+// NewFragmenter returns a fragmenter for the track timescale (0 selects
+// 90000) and input timebase.
+func NewFragmenter(timescale uint32, timebaseNum, timebaseDen int64) (*Fragmenter, error) {
+	if timescale == 0 {
+		timescale = 90000
+	}
+	if timebaseNum <= 0 || timebaseDen <= 0 {
+		return nil, ErrTimebase
+	}
+	return &Fragmenter{Timescale: timescale, TimebaseNum: timebaseNum, TimebaseDen: timebaseDen}, nil
+}
+
+// Scale converts an input timestamp to the shifted track timescale.
+func (f *Fragmenter) Scale(ts int64) int64 {
+	return media.Rescale(ts, f.TimebaseNum*int64(f.Timescale), f.TimebaseDen) + f.offset
+}
+
+// Push completes the previously pushed access unit and queues units, the
+// NAL units of the next one.  It returns the shifted presentation and
+// decode times of the queued unit.
+func (f *Fragmenter) Push(units [][]byte, pts, dts int64, keyframe bool) (int64, int64) {
+	if !f.started {
+		f.started = true
+		if d := f.Scale(dts); d < 0 {
+			f.offset = -d
+		}
+	}
+	ptsT, dtsT := f.Scale(pts), f.Scale(dts)
+	if f.pending != nil {
+		f.lastDur = dtsT - f.pendDts
+		f.complete()
+	}
+	if len(f.samples) == 0 {
+		f.startPts, f.startDts = ptsT, dtsT
+	}
+
+	kept := units[:0:0]
+	for _, u := range units {
+		switch h264.NalType(u) {
+		case h264.NalSPS, h264.NalPPS, h264.NalAUD:
+		default:
+			kept = append(kept, u)
+		}
+	}
+	f.pending = &Sample{
+		Data:                  h264.AVCC(kept),
+		CompositionTimeOffset: int32(ptsT - dtsT),
+		Keyframe:              keyframe,
+	}
+	f.pendPts, f.pendDts = ptsT, dtsT
+	return ptsT, dtsT
+}
+
+func (f *Fragmenter) complete() {
+	dur := f.lastDur
+	if dur < 0 {
+		dur = 0
+	}
+	f.pending.Duration = uint32(dur)
+	f.samples = append(f.samples, *f.pending)
+	f.size += len(f.pending.Data)
+	if f.pendPts > f.maxPts {
+		f.maxPts = f.pendPts
+	}
+	f.pending = nil
+}
+
+// Finish completes the queued access unit with the duration of the one
+// before it, at the end of the stream.
+func (f *Fragmenter) Finish() {
+	if f.pending != nil {
+		f.complete()
+	}
+}
+
+// Len returns the number of completed samples of the open fragment.
+func (f *Fragmenter) Len() int {
+	return len(f.samples)
+}
+
+// Size returns the bytes of the completed samples of the open fragment.
+func (f *Fragmenter) Size() int {
+	return f.size
+}
+
+// Start returns the presentation and decode times of the first sample of
+// the open fragment.
+func (f *Fragmenter) Start() (pts, dts int64) {
+	return f.startPts, f.startDts
+}
+
+// End returns the presentation end time of the completed samples.
+func (f *Fragmenter) End() int64 {
+	return f.maxPts + f.lastDur
+}
+
+// Flush returns the completed samples and the decode time of the first,
+// and opens a new fragment starting with the queued access unit.
+func (f *Fragmenter) Flush() ([]Sample, uint64) {
+	samples, base := f.samples, uint64(f.startDts)
+	f.samples, f.size = nil, 0
+	if f.pending != nil {
+		f.startPts, f.startDts = f.pendPts, f.pendDts
+	}
+	return samples, base
+}
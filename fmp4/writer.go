@@ -0,0 +1,129 @@
+package fmp4
+
+import (
+	"bufio"
+	"errors"
+	"io"
+
+	"github.com/moonfdd/x264-go/h264"
+	"github.com/moonfdd/x264-go/libx264"
+)
+
+var ErrNoHeaders = errors.New("fmp4: no SPS/PPS before the first keyframe")
+
+// Writer writes a fragmented MP4 file with one fragment per GOP.
+type Writer struct {
+	w    *bufio.Writer
+	c    io.Closer
+	frag *Fragmenter
+
+	wroteInit bool
+	sequence  uint32
+}
+
+// NewWriter returns a writer to w using the given track timescale (0
+// selects 90000) and the timebase of the PTS/DTS passed to WriteFrame,
+// i.e. i_timebase_num/i_timebase_den.  If w is an io.Closer it is closed
+// by Close.
+func NewWriter(w io.Writer, timescale uint32, timebaseNum, timebaseDen int64) (*Writer, error) {
+	frag, err := NewFragmenter(timescale, timebaseNum, timebaseDen)
+	if err != nil {
+		return nil, err
+	}
+	fw := &Writer{w: bufio.NewWriter(w), frag: frag}
+	if c, ok := w.(io.Closer); ok {
+		fw.c = c
+	}
+	return fw, nil
+}
+
+// WriteHeaders writes the initialization segment (ftyp and moov).
+func (fw *Writer) WriteHeaders(sps, pps [][]byte) error {
+	init, err := InitSegment(sps, pps, fw.frag.Timescale)
+	if err != nil {
+		return err
+	}
+	fw.wroteInit = true
+	_, err = fw.w.Write(init)
+	return err
+}
+
+// WriteFrame writes one Annex-B access unit.  The initialization segment
+// is taken from the first keyframe unless WriteHeaders was called.
+func (fw *Writer) WriteFrame(data []byte, pts, dts int64, keyframe bool) error {
+	units := h264.SplitAnnexB(data)
+	if !fw.frag.started {
+		if !keyframe {
+			return nil
+		}
+		if !fw.wroteInit {
+			sps, pps := h264.ParameterSets(units)
+			if len(sps) == 0 || len(pps) == 0 {
+				return ErrNoHeaders
+			}
+			if err := fw.WriteHeaders(sps, pps); err != nil {
+				return err
+			}
+		}
+	}
+	fw.frag.Push(units, pts, dts, keyframe)
+	if keyframe && fw.frag.Len() > 0 {
+		return fw.flush()
+	}
+	return nil
+}
+
+// Close writes the last fragment.
+func (fw *Writer) Close() error {
+	var err error
+	fw.frag.Finish()
+	if fw.frag.Len() > 0 {
+		err = fw.flush()
+	}
+	if ferr := fw.w.Flush(); err == nil {
+		err = ferr
+	}
+	if fw.c != nil {
+		if cerr := fw.c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (fw *Writer) flush() error {
+	fw.sequence++
+	samples, base := fw.frag.Flush()
+	_, err := fw.w.Write(Fragment(fw.sequence, base, samples))
+	return err
+}
+
+type writerSink struct {
+	fw *Writer
+}
+
+// Sink returns the writer as a libx264.Sink.
+func (fw *Writer) Sink() libx264.Sink {
+	return writerSink{fw}
+}
+
+func (k writerSink) WriteHeaders(nals []libx264.X264NalT) error {
+	units := make([][]byte, 0, len(nals))
+	for i := range nals {
+		units = append(units, nals[i].Unit())
+	}
+	sps, pps := h264.ParameterSets(units)
+	return k.fw.WriteHeaders(sps, pps)
+}
+
+func (k writerSink) WriteFrame(f *libx264.Frame) error {
+	var data []byte
+	for i := range f.Nals {
+		data = f.Nals[i].AppendAnnexB(data)
+	}
+	return k.fw.WriteFrame(data, f.Pts, f.Dts, f.Keyframe)
+}
+
+func (k writerSink) Close() error {
+	return k.fw.Close()
+}
@@ -3,6 +3,6 @@ module github.com/moonfdd/x264-go
 go 1.16
 
 require (
-	github.com/moonfdd/ffmpeg-go v0.0.0-20230306023015-7de6b82b1252 // indirect
+	github.com/moonfdd/ffmpeg-go v0.0.0-20230306023015-7de6b82b1252
 	github.com/ying32/dylib v0.0.0-20220227124818-fdf9ea9fbc96
 )
@@ -0,0 +1,61 @@
+package h264
+
+import (
+	"errors"
+)
+
+var ErrNoParameterSets = errors.New("h264: missing SPS or PPS")
+
+// DecoderConfigurationRecord builds the AVCDecoderConfigurationRecord
+// (ISO/IEC 14496-15) carried in the MP4 avcC box and the FLV AVC sequence
+// header.
+func DecoderConfigurationRecord(sps, pps [][]byte) ([]byte, error) {
+	if len(sps) == 0 || len(pps) == 0 || len(sps[0]) < 4 {
+		return nil, ErrNoParameterSets
+	}
+	s0 := sps[0]
+	rec := []byte{
+		1,     /* configurationVersion */
+		s0[1], /* AVCProfileIndication */
+		s0[2], /* profile_compatibility */
+		s0[3], /* AVCLevelIndication */
+		0xff,  /* lengthSizeMinusOne = 3 */
+		0xe0 | byte(len(sps)),
+	}
+	for _, s := range sps {
+		rec = append(rec, byte(len(s)>>8), byte(len(s)))
+		rec = append(rec, s...)
+	}
+	rec = append(rec, byte(len(pps)))
+	for _, p := range pps {
+		rec = append(rec, byte(len(p)>>8), byte(len(p)))
+		rec = append(rec, p...)
+	}
+
+	switch s0[1] {
+	case 100, 110, 122, 144, 244:
+		parsed, err := ParseSPS(s0)
+		if err != nil {
+			return nil, err
+		}
+		rec = append(rec,
+			0xfc|byte(parsed.ChromaFormatIdc),
+			0xf8|byte(parsed.BitDepthLuma-8),
+			0xf8|byte(parsed.BitDepthChroma-8),
+			0) /* numOfSequenceParameterSetExt */
+	}
+	return rec, nil
+}
+
+// ParameterSets extracts the SPS and PPS NAL units from units.
+func ParameterSets(units [][]byte) (sps, pps [][]byte) {
+	for _, u := range units {
+		switch NalType(u) {
+		case NalSPS:
+			sps = append(sps, u)
+		case NalPPS:
+			pps = append(pps, u)
+		}
+	}
+	return
+}
@@ -0,0 +1,52 @@
+package h264
+
+import (
+	"errors"
+)
+
+var ErrTruncated = errors.New("h264: truncated bitstream")
+
+// bitReader reads RBSP bits MSB first.
+type bitReader struct {
+	data []byte
+	pos  int /* in bits */
+	err  error
+}
+
+func (r *bitReader) u(n int) uint32 {
+	var v uint32
+	for i := 0; i < n; i++ {
+		if r.pos >= len(r.data)*8 {
+			r.err = ErrTruncated
+			return 0
+		}
+		bit := r.data[r.pos>>3] >> (7 - uint(r.pos&7)) & 1
+		v = v<<1 | uint32(bit)
+		r.pos++
+	}
+	return v
+}
+
+func (r *bitReader) flag() bool {
+	return r.u(1) != 0
+}
+
+func (r *bitReader) ue() uint32 {
+	zeros := 0
+	for r.u(1) == 0 {
+		if r.err != nil || zeros > 31 {
+			r.err = ErrTruncated
+			return 0
+		}
+		zeros++
+	}
+	return (1<<uint(zeros) - 1) + r.u(zeros)
+}
+
+func (r *bitReader) se() int32 {
+	v := r.ue()
+	if v&1 != 0 {
+		return int32((v + 1) / 2)
+	}
+	return -int32(v / 2)
+}
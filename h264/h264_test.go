@@ -0,0 +1,326 @@
+package h264
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+/* x264 parameter sets: 320x240 Baseline 1.3, 1280x720 High 3.1, 1920x1080 High 4.0 */
+var (
+	spsBaseline, _ = hex.DecodeString("6742c00dd90141fb0110000003001000000303c0f142a480")
+	spsHigh720, _  = hex.DecodeString("6764001facd9405005bb011000000300100000030300f1831960")
+	spsHigh1080, _ = hex.DecodeString("67640028acd940780227e5c05a808080a0000003002000000781e3064b")
+	testPPS        = []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0}
+)
+
+type bitWriter struct {
+	buf  []byte
+	bits int
+}
+
+func (w *bitWriter) u(n int, v uint32) {
+	for i := n - 1; i >= 0; i-- {
+		if w.bits%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		if v>>uint(i)&1 != 0 {
+			w.buf[len(w.buf)-1] |= 0x80 >> uint(w.bits%8)
+		}
+		w.bits++
+	}
+}
+
+func (w *bitWriter) flag(b bool) {
+	if b {
+		w.u(1, 1)
+	} else {
+		w.u(1, 0)
+	}
+}
+
+func (w *bitWriter) ue(v uint32) {
+	n := 0
+	for x := v + 1; x > 1; x >>= 1 {
+		n++
+	}
+	w.u(n, 0)
+	w.u(n+1, v+1)
+}
+
+func (w *bitWriter) se(v int32) {
+	if v > 0 {
+		w.ue(uint32(2*v - 1))
+	} else {
+		w.ue(uint32(-2 * v))
+	}
+}
+
+/* rbsp_trailing_bits, then emulation prevention */
+func (w *bitWriter) nal(header byte) []byte {
+	w.u(1, 1)
+	for w.bits%8 != 0 {
+		w.u(1, 0)
+	}
+	out := []byte{header}
+	zeros := 0
+	for _, b := range w.buf {
+		if zeros >= 2 && b <= 3 {
+			out = append(out, 3)
+			zeros = 0
+		}
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+/* 1920x1080 interlaced High 4:2:2 10-bit with a scaling matrix and a full VUI */
+func spsHigh422() []byte {
+	w := &bitWriter{}
+	w.u(8, 122)
+	w.u(8, 0)
+	w.u(8, 40)
+	w.ue(0)      /* seq_parameter_set_id */
+	w.ue(2)      /* chroma_format_idc */
+	w.ue(2)      /* bit_depth_luma_minus8 */
+	w.ue(2)      /* bit_depth_chroma_minus8 */
+	w.u(1, 0)    /* qpprime_y_zero_transform_bypass_flag */
+	w.flag(true) /* seq_scaling_matrix_present_flag */
+	for i := 0; i < 8; i++ {
+		w.flag(i == 0)
+		if i == 0 {
+			for j := 0; j < 16; j++ {
+				w.se(0)
+			}
+		}
+	}
+	w.ue(0) /* log2_max_frame_num_minus4 */
+	w.ue(0) /* pic_order_cnt_type */
+	w.ue(2) /* log2_max_pic_order_cnt_lsb_minus4 */
+	w.ue(4) /* max_num_ref_frames */
+	w.u(1, 0)
+	w.ue(119)     /* pic_width_in_mbs_minus1 */
+	w.ue(33)      /* pic_height_in_map_units_minus1 */
+	w.flag(false) /* frame_mbs_only_flag */
+	w.u(1, 0)     /* mb_adaptive_frame_field_flag */
+	w.flag(true)  /* direct_8x8_inference_flag */
+	w.flag(true)  /* frame_cropping_flag */
+	w.ue(0)
+	w.ue(0)
+	w.ue(0)
+	w.ue(4)      /* 2 rows per unit for interlaced 4:2:2 */
+	w.flag(true) /* vui_parameters_present_flag */
+
+	w.flag(true)
+	w.u(8, aspectRatioExtendedSAR)
+	w.u(16, 4)
+	w.u(16, 3)
+	w.flag(true) /* overscan_info_present_flag */
+	w.flag(true)
+	w.flag(true) /* video_signal_type_present_flag */
+	w.u(3, 1)
+	w.flag(true)
+	w.flag(true)
+	w.u(8, 9)
+	w.u(8, 16)
+	w.u(8, 9)
+	w.flag(true) /* chroma_loc_info_present_flag */
+	w.ue(2)
+	w.ue(2)
+	w.flag(true) /* timing_info_present_flag */
+	w.u(32, 1001)
+	w.u(32, 60000)
+	w.flag(true)
+	w.flag(true) /* nal_hrd_parameters_present_flag */
+	w.ue(0)
+	w.u(4, 0)
+	w.u(4, 0)
+	w.ue(999)
+	w.ue(1999)
+	w.flag(true)
+	w.u(5, 23)
+	w.u(5, 23)
+	w.u(5, 23)
+	w.u(5, 24)
+	w.flag(false) /* vcl_hrd_parameters_present_flag */
+	w.flag(false) /* low_delay_hrd_flag */
+	w.flag(true)  /* pic_struct_present_flag */
+	w.flag(true)  /* bitstream_restriction_flag */
+	w.flag(true)
+	w.ue(0)
+	w.ue(0)
+	w.ue(16)
+	w.ue(16)
+	w.ue(2)
+	w.ue(4)
+	return w.nal(0x67)
+}
+
+/* 320x240 High 4:4:4 Predictive 10-bit without VUI */
+func spsHigh444() []byte {
+	w := &bitWriter{}
+	w.u(8, 244)
+	w.u(8, 0)
+	w.u(8, 30)
+	w.ue(0)       /* seq_parameter_set_id */
+	w.ue(3)       /* chroma_format_idc */
+	w.flag(false) /* separate_colour_plane_flag */
+	w.ue(2)       /* bit_depth_luma_minus8 */
+	w.ue(2)       /* bit_depth_chroma_minus8 */
+	w.u(1, 0)     /* qpprime_y_zero_transform_bypass_flag */
+	w.flag(false) /* seq_scaling_matrix_present_flag */
+	w.ue(0)       /* log2_max_frame_num_minus4 */
+	w.ue(2)       /* pic_order_cnt_type */
+	w.ue(1)       /* max_num_ref_frames */
+	w.u(1, 0)
+	w.ue(19)      /* pic_width_in_mbs_minus1 */
+	w.ue(14)      /* pic_height_in_map_units_minus1 */
+	w.flag(true)  /* frame_mbs_only_flag */
+	w.flag(true)  /* direct_8x8_inference_flag */
+	w.flag(false) /* frame_cropping_flag */
+	w.flag(false) /* vui_parameters_present_flag */
+	return w.nal(0x67)
+}
+
+func TestParseSPS(t *testing.T) {
+	tests := []struct {
+		name          string
+		sps           []byte
+		codec         string
+		width, height int
+		chroma, depth int
+		frameMbsOnly  bool
+		rateNum       uint32
+		rateDen       uint32
+		vui           *VUI /* compared field by field when set */
+	}{
+		{"baseline", spsBaseline, "avc1.42c00d", 320, 240, 1, 8, true, 60, 2, nil},
+		{"high 720p", spsHigh720, "avc1.64001f", 1280, 720, 1, 8, true, 48, 2, nil},
+		{"high 1080p cropped", spsHigh1080, "avc1.640028", 1920, 1080, 1, 8, true, 60, 2, &VUI{
+			AspectRatioIdc: 1, SarWidth: 1, SarHeight: 1,
+			VideoSignalTypePresent: true, VideoFormat: 5, ColourDescriptionPresent: true,
+			ColourPrimaries: 1, TransferCharacteristics: 1, MatrixCoefficients: 1,
+			TimingInfoPresent: true, NumUnitsInTick: 1, TimeScale: 60,
+			BitstreamRestriction: true, MaxDecFrameBuffering: 4,
+		}},
+		{"high 4:2:2 interlaced", spsHigh422(), "avc1.7a0028", 1920, 1080, 2, 10, false, 60000, 2002, &VUI{
+			AspectRatioIdc: aspectRatioExtendedSAR, SarWidth: 4, SarHeight: 3,
+			OverscanInfoPresent: true, OverscanAppropriate: true,
+			VideoSignalTypePresent: true, VideoFormat: 1, FullRange: true, ColourDescriptionPresent: true,
+			ColourPrimaries: 9, TransferCharacteristics: 16, MatrixCoefficients: 9,
+			ChromaLocInfoPresent: true, ChromaSampleLocTop: 2, ChromaSampleLocBottom: 2,
+			TimingInfoPresent: true, NumUnitsInTick: 1001, TimeScale: 60000, FixedFrameRate: true,
+			NalHRD: &HRD{
+				CPB:                          []CPBSpec{{BitRate: 64000, CpbSize: 32000, CBR: true}},
+				InitialCpbRemovalDelayLength: 24, CpbRemovalDelayLength: 24, DpbOutputDelayLength: 24, TimeOffsetLength: 24,
+			},
+			PicStructPresent:     true,
+			BitstreamRestriction: true, MaxNumReorderFrames: 2, MaxDecFrameBuffering: 4,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseSPS(tt.sps)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.Codec() != tt.codec || s.Width != tt.width || s.Height != tt.height {
+				t.Errorf("%s %dx%d, want %s %dx%d", s.Codec(), s.Width, s.Height, tt.codec, tt.width, tt.height)
+			}
+			if s.ChromaFormatIdc != tt.chroma || s.BitDepthLuma != tt.depth || s.BitDepthChroma != tt.depth || s.FrameMbsOnly != tt.frameMbsOnly {
+				t.Errorf("chroma %d depth %d/%d frame_mbs_only %v", s.ChromaFormatIdc, s.BitDepthLuma, s.BitDepthChroma, s.FrameMbsOnly)
+			}
+			if num, den, ok := s.VUI.FrameRate(); !ok || num != tt.rateNum || den != tt.rateDen {
+				t.Errorf("frame rate %d/%d %v, want %d/%d", num, den, ok, tt.rateNum, tt.rateDen)
+			}
+			if tt.vui != nil && !reflect.DeepEqual(s.VUI, tt.vui) {
+				t.Errorf("VUI\n%+v\nwant\n%+v", s.VUI, tt.vui)
+			}
+			if codec, err := CodecString(tt.sps); err != nil || codec != tt.codec {
+				t.Errorf("CodecString: %q %v", codec, err)
+			}
+		})
+	}
+	for _, bad := range [][]byte{nil, testPPS, spsBaseline[:3], spsBaseline[:6]} {
+		if _, err := ParseSPS(bad); err == nil {
+			t.Errorf("ParseSPS(%x) succeeded", bad)
+		}
+	}
+}
+
+func TestSplitAnnexB(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want [][]byte
+	}{
+		{"empty", nil, nil},
+		{"no start code", []byte{0x65, 1}, [][]byte{{0x65, 1}}},
+		{"mixed start codes", []byte{0, 0, 0, 1, 9, 0xf0, 0, 0, 1, 0x67, 1, 0, 0, 0, 0, 1, 0x65, 2, 0},
+			[][]byte{{9, 0xf0}, {0x67, 1}, {0x65, 2}}},
+		{"empty unit", []byte{0, 0, 1, 0, 0, 1, 0x41}, [][]byte{{0x41}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SplitAnnexB(tt.data); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEBSPToRBSP(t *testing.T) {
+	for _, tt := range []struct{ in, want []byte }{
+		{[]byte{1, 2, 3}, []byte{1, 2, 3}},
+		{[]byte{0, 0, 3, 1}, []byte{0, 0, 1}},
+		{[]byte{0, 0, 3, 0, 0, 3}, []byte{0, 0, 0, 0}},
+		{[]byte{0, 3, 0, 0, 3, 3}, []byte{0, 3, 0, 0, 3}},
+	} {
+		if got := EBSPToRBSP(tt.in); !bytes.Equal(got, tt.want) {
+			t.Errorf("EBSPToRBSP(%x) = %x, want %x", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDecoderConfigurationRecord(t *testing.T) {
+	tests := []struct {
+		name string
+		sps  []byte
+		ext  []byte /* chroma_format, bit depths and SPS ext count of High profiles */
+	}{
+		{"baseline", spsBaseline, nil},
+		{"high", spsHigh720, []byte{0xfd, 0xf8, 0xf8, 0}},
+		{"high 4:2:2 10-bit", spsHigh422(), []byte{0xfe, 0xfa, 0xfa, 0}},
+		{"high 4:4:4 10-bit", spsHigh444(), []byte{0xff, 0xfa, 0xfa, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, err := DecoderConfigurationRecord([][]byte{tt.sps}, [][]byte{testPPS})
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []byte{1, tt.sps[1], tt.sps[2], tt.sps[3], 0xff, 0xe1, 0, byte(len(tt.sps))}
+			want = append(want, tt.sps...)
+			want = append(want, 1, 0, byte(len(testPPS)))
+			want = append(want, testPPS...)
+			want = append(want, tt.ext...)
+			if !bytes.Equal(rec, want) {
+				t.Errorf("got  %x\nwant %x", rec, want)
+			}
+		})
+	}
+	if _, err := DecoderConfigurationRecord(nil, [][]byte{testPPS}); err != ErrNoParameterSets {
+		t.Errorf("no SPS: %v", err)
+	}
+
+	sps, pps := ParameterSets([][]byte{{9, 0x10}, spsBaseline, testPPS, {0x65, 1}})
+	if len(sps) != 1 || len(pps) != 1 || !bytes.Equal(sps[0], spsBaseline) || !bytes.Equal(pps[0], testPPS) {
+		t.Errorf("ParameterSets: %x %x", sps, pps)
+	}
+}
@@ -0,0 +1,91 @@
+// Package h264 contains the bitstream helpers shared by the muxers and
+// network outputs: Annex-B splitting, emulation prevention, SPS parsing
+// and the AVCDecoderConfigurationRecord.
+package h264
+
+const (
+	NalSlice    = 1
+	NalSliceIDR = 5
+	NalSEI      = 6
+	NalSPS      = 7
+	NalPPS      = 8
+	NalAUD      = 9
+	NalFiller   = 12
+)
+
+// NalType returns the nal_unit_type of a NAL unit without start code.
+func NalType(unit []byte) int {
+	if len(unit) == 0 {
+		return 0
+	}
+	return int(unit[0] & 0x1f)
+}
+
+// SplitAnnexB splits an Annex-B byte stream into NAL units without start
+// codes.  The returned units alias data.
+func SplitAnnexB(data []byte) [][]byte {
+	var units [][]byte
+	start := -1
+	for i := 0; i+2 < len(data); {
+		if data[i] == 0 && data[i+1] == 0 && data[i+2] == 1 {
+			if start >= 0 {
+				units = appendUnit(units, data[start:i])
+			}
+			i += 3
+			start = i
+			continue
+		}
+		i++
+	}
+	if start >= 0 {
+		units = appendUnit(units, data[start:])
+	} else if len(data) > 0 {
+		units = append(units, data)
+	}
+	return units
+}
+
+func appendUnit(units [][]byte, unit []byte) [][]byte {
+	/* drop the leading zero of a 4-byte start code and trailing_zero_8bits */
+	for len(unit) > 0 && unit[len(unit)-1] == 0 {
+		unit = unit[:len(unit)-1]
+	}
+	if len(unit) == 0 {
+		return units
+	}
+	return append(units, unit)
+}
+
+// AVCC converts NAL units into the length-prefixed form used by MP4 and FLV.
+func AVCC(units [][]byte) []byte {
+	size := 0
+	for _, u := range units {
+		size += 4 + len(u)
+	}
+	out := make([]byte, 0, size)
+	for _, u := range units {
+		n := len(u)
+		out = append(out, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+		out = append(out, u...)
+	}
+	return out
+}
+
+// EBSPToRBSP removes emulation prevention bytes (00 00 03).
+func EBSPToRBSP(ebsp []byte) []byte {
+	rbsp := make([]byte, 0, len(ebsp))
+	zeros := 0
+	for _, b := range ebsp {
+		if zeros >= 2 && b == 3 {
+			zeros = 0
+			continue
+		}
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		rbsp = append(rbsp, b)
+	}
+	return rbsp
+}
@@ -0,0 +1,161 @@
+package h264
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrNotSPS = errors.New("h264: not a sequence parameter set")
+
+// SPS holds the fields of a sequence parameter set needed by muxers.
+type SPS struct {
+	ProfileIdc         int
+	ConstraintFlags    byte /* constraint_set0..5_flag and reserved bits, as coded */
+	LevelIdc           int
+	ID                 int
+	ChromaFormatIdc    int
+	BitDepthLuma       int
+	BitDepthChroma     int
+	Log2MaxFrameNum    int
+	PicOrderCntType    int
+	MaxNumRefFrames    int
+	PicWidthInMbs      int
+	PicHeightInMapUnit int
+	FrameMbsOnly       bool
+	Direct8x8Inference bool
+	CropLeft           int
+	CropRight          int
+	CropTop            int
+	CropBottom         int
+
+	/* frame size in luma samples after cropping */
+	Width  int
+	Height int
+
+	VUIPresent bool
+	VUI        *VUI /* if VUIPresent */
+}
+
+// ParseSPS parses an SPS NAL unit (without start code).
+func ParseSPS(unit []byte) (*SPS, error) {
+	if NalType(unit) != NalSPS || len(unit) < 4 {
+		return nil, ErrNotSPS
+	}
+	r := &bitReader{data: EBSPToRBSP(unit[1:])}
+	s := &SPS{
+		ChromaFormatIdc: 1,
+		BitDepthLuma:    8,
+		BitDepthChroma:  8,
+	}
+	s.ProfileIdc = int(r.u(8))
+	s.ConstraintFlags = byte(r.u(8))
+	s.LevelIdc = int(r.u(8))
+	s.ID = int(r.ue())
+
+	switch s.ProfileIdc {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		s.ChromaFormatIdc = int(r.ue())
+		if s.ChromaFormatIdc == 3 {
+			r.u(1) /* separate_colour_plane_flag */
+		}
+		s.BitDepthLuma = int(r.ue()) + 8
+		s.BitDepthChroma = int(r.ue()) + 8
+		r.u(1) /* qpprime_y_zero_transform_bypass_flag */
+		if r.flag() {
+			n := 8
+			if s.ChromaFormatIdc == 3 {
+				n = 12
+			}
+			for i := 0; i < n; i++ {
+				if r.flag() {
+					size := 16
+					if i >= 6 {
+						size = 64
+					}
+					skipScalingList(r, size)
+				}
+			}
+		}
+	}
+
+	s.Log2MaxFrameNum = int(r.ue()) + 4
+	s.PicOrderCntType = int(r.ue())
+	switch s.PicOrderCntType {
+	case 0:
+		r.ue() /* log2_max_pic_order_cnt_lsb_minus4 */
+	case 1:
+		r.u(1)
+		r.se()
+		r.se()
+		n := r.ue()
+		for i := uint32(0); i < n && r.err == nil; i++ {
+			r.se()
+		}
+	}
+	s.MaxNumRefFrames = int(r.ue())
+	r.u(1) /* gaps_in_frame_num_value_allowed_flag */
+	s.PicWidthInMbs = int(r.ue()) + 1
+	s.PicHeightInMapUnit = int(r.ue()) + 1
+	s.FrameMbsOnly = r.flag()
+	if !s.FrameMbsOnly {
+		r.u(1) /* mb_adaptive_frame_field_flag */
+	}
+	s.Direct8x8Inference = r.flag()
+	if r.flag() {
+		s.CropLeft = int(r.ue())
+		s.CropRight = int(r.ue())
+		s.CropTop = int(r.ue())
+		s.CropBottom = int(r.ue())
+	}
+	s.VUIPresent = r.flag()
+	if s.VUIPresent {
+		s.VUI = parseVUI(r)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	frameHeightInMbs := s.PicHeightInMapUnit
+	if !s.FrameMbsOnly {
+		frameHeightInMbs *= 2
+	}
+	cropUnitX, cropUnitY := 1, 1
+	switch s.ChromaFormatIdc {
+	case 1:
+		cropUnitX, cropUnitY = 2, 2
+	case 2:
+		cropUnitX = 2
+	}
+	if !s.FrameMbsOnly {
+		cropUnitY *= 2
+	}
+	s.Width = s.PicWidthInMbs*16 - cropUnitX*(s.CropLeft+s.CropRight)
+	s.Height = frameHeightInMbs*16 - cropUnitY*(s.CropTop+s.CropBottom)
+	return s, nil
+}
+
+func skipScalingList(r *bitReader, size int) {
+	last, next := int32(8), int32(8)
+	for j := 0; j < size && r.err == nil; j++ {
+		if next != 0 {
+			next = (last + r.se() + 256) % 256
+		}
+		if next != 0 {
+			last = next
+		}
+	}
+}
+
+// Codec returns the RFC 6381 codec string, e.g. "avc1.64001f".
+func (s *SPS) Codec() string {
+	return fmt.Sprintf("avc1.%02x%02x%02x", s.ProfileIdc, s.ConstraintFlags, s.LevelIdc)
+}
+
+// CodecString returns the RFC 6381 codec string of an SPS NAL unit.
+func CodecString(sps []byte) (string, error) {
+	s, err := ParseSPS(sps)
+	if err != nil {
+		return "", err
+	}
+	return s.Codec(), nil
+}
@@ -0,0 +1,149 @@
+package h264
+
+// VUI holds the video usability information of an SPS (annex E).
+type VUI struct {
+	AspectRatioIdc int
+	SarWidth       int
+	SarHeight      int
+
+	OverscanInfoPresent bool
+	OverscanAppropriate bool
+
+	VideoSignalTypePresent   bool
+	VideoFormat              int /* 5 if absent */
+	FullRange                bool
+	ColourDescriptionPresent bool
+	ColourPrimaries          int /* 2 (unspecified) if absent */
+	TransferCharacteristics  int
+	MatrixCoefficients       int
+
+	ChromaLocInfoPresent  bool
+	ChromaSampleLocTop    int
+	ChromaSampleLocBottom int
+
+	TimingInfoPresent bool
+	NumUnitsInTick    uint32
+	TimeScale         uint32
+	FixedFrameRate    bool
+
+	NalHRD      *HRD
+	VclHRD      *HRD
+	LowDelayHRD bool
+
+	PicStructPresent bool
+
+	BitstreamRestriction bool
+	MaxNumReorderFrames  int
+	MaxDecFrameBuffering int
+}
+
+// HRD holds hrd_parameters with the bit rates and CPB sizes scaled to
+// bits per second and bits.
+type HRD struct {
+	CPB []CPBSpec
+
+	InitialCpbRemovalDelayLength int
+	CpbRemovalDelayLength        int
+	DpbOutputDelayLength         int
+	TimeOffsetLength             int
+}
+
+// CPBSpec is the specification of one coded picture buffer.
+type CPBSpec struct {
+	BitRate int64
+	CpbSize int64
+	CBR     bool
+}
+
+const aspectRatioExtendedSAR = 255
+
+/* sample aspect ratios of aspect_ratio_idc 1..16 (table E-1) */
+var sarTable = [...][2]int{
+	{0, 0}, {1, 1}, {12, 11}, {10, 11}, {16, 11}, {40, 33}, {24, 11}, {20, 11}, {32, 11},
+	{80, 33}, {18, 11}, {15, 11}, {64, 33}, {160, 99}, {4, 3}, {3, 2}, {2, 1},
+}
+
+func parseVUI(r *bitReader) *VUI {
+	v := &VUI{VideoFormat: 5, ColourPrimaries: 2, TransferCharacteristics: 2, MatrixCoefficients: 2}
+	if r.flag() {
+		v.AspectRatioIdc = int(r.u(8))
+		if v.AspectRatioIdc == aspectRatioExtendedSAR {
+			v.SarWidth = int(r.u(16))
+			v.SarHeight = int(r.u(16))
+		} else if v.AspectRatioIdc < len(sarTable) {
+			v.SarWidth, v.SarHeight = sarTable[v.AspectRatioIdc][0], sarTable[v.AspectRatioIdc][1]
+		}
+	}
+	if v.OverscanInfoPresent = r.flag(); v.OverscanInfoPresent {
+		v.OverscanAppropriate = r.flag()
+	}
+	if v.VideoSignalTypePresent = r.flag(); v.VideoSignalTypePresent {
+		v.VideoFormat = int(r.u(3))
+		v.FullRange = r.flag()
+		if v.ColourDescriptionPresent = r.flag(); v.ColourDescriptionPresent {
+			v.ColourPrimaries = int(r.u(8))
+			v.TransferCharacteristics = int(r.u(8))
+			v.MatrixCoefficients = int(r.u(8))
+		}
+	}
+	if v.ChromaLocInfoPresent = r.flag(); v.ChromaLocInfoPresent {
+		v.ChromaSampleLocTop = int(r.ue())
+		v.ChromaSampleLocBottom = int(r.ue())
+	}
+	if v.TimingInfoPresent = r.flag(); v.TimingInfoPresent {
+		v.NumUnitsInTick = r.u(32)
+		v.TimeScale = r.u(32)
+		v.FixedFrameRate = r.flag()
+	}
+	if r.flag() {
+		v.NalHRD = parseHRD(r)
+	}
+	if r.flag() {
+		v.VclHRD = parseHRD(r)
+	}
+	if v.NalHRD != nil || v.VclHRD != nil {
+		v.LowDelayHRD = r.flag()
+	}
+	v.PicStructPresent = r.flag()
+	if v.BitstreamRestriction = r.flag(); v.BitstreamRestriction {
+		r.u(1) /* motion_vectors_over_pic_boundaries_flag */
+		r.ue() /* max_bytes_per_pic_denom */
+		r.ue() /* max_bits_per_mb_denom */
+		r.ue() /* log2_max_mv_length_horizontal */
+		r.ue() /* log2_max_mv_length_vertical */
+		v.MaxNumReorderFrames = int(r.ue())
+		v.MaxDecFrameBuffering = int(r.ue())
+	}
+	return v
+}
+
+func parseHRD(r *bitReader) *HRD {
+	h := new(HRD)
+	n := int(r.ue()) + 1
+	if n > 32 {
+		r.err = ErrTruncated
+		return h
+	}
+	bitRateScale := r.u(4)
+	cpbSizeScale := r.u(4)
+	h.CPB = make([]CPBSpec, n)
+	for i := range h.CPB {
+		h.CPB[i].BitRate = (int64(r.ue()) + 1) << (6 + bitRateScale)
+		h.CPB[i].CpbSize = (int64(r.ue()) + 1) << (4 + cpbSizeScale)
+		h.CPB[i].CBR = r.flag()
+	}
+	h.InitialCpbRemovalDelayLength = int(r.u(5)) + 1
+	h.CpbRemovalDelayLength = int(r.u(5)) + 1
+	h.DpbOutputDelayLength = int(r.u(5)) + 1
+	h.TimeOffsetLength = int(r.u(5))
+	return h
+}
+
+// FrameRate returns the frame rate signalled by the timing info, assuming
+// two ticks per frame, or false without timing info.
+func (v *VUI) FrameRate() (num, den uint32, ok bool) {
+	if v == nil || !v.TimingInfoPresent || v.NumUnitsInTick == 0 {
+		return 0, 0, false
+	}
+	return v.TimeScale, 2 * v.NumUnitsInTick, true
+}
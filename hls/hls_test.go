@@ -0,0 +1,234 @@
+package hls
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+/* 320x240 Constrained Baseline level 1.3 */
+var testSPS, _ = hex.DecodeString("6742c00dd90141fb0110000003001000000303c0f142a480")
+var testPPS = []byte{0x68, 0xce, 0x3c, 0x80}
+
+func annexB(units ...[]byte) []byte {
+	var b []byte
+	for _, u := range units {
+		b = append(b, 0, 0, 0, 1)
+		b = append(b, u...)
+	}
+	return b
+}
+
+func TestMediaPlaylist(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		p    MediaPlaylist
+		want string
+	}{
+		{"vod", MediaPlaylist{
+			TargetDuration: 6 * time.Second,
+			PlaylistType:   "VOD",
+			Segments: []Segment{
+				{URI: "a.ts", Duration: 6 * time.Second},
+				{URI: "b.ts", Duration: 6500 * time.Millisecond},
+			},
+			Ended: true,
+		}, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:7\n#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:VOD\n" +
+			"#EXTINF:6.000,\na.ts\n#EXTINF:6.500,\nb.ts\n#EXT-X-ENDLIST\n"},
+		{"live fmp4", MediaPlaylist{
+			TargetDuration: 4 * time.Second,
+			MediaSequence:  12,
+			Map:            "init.mp4",
+			Segments: []Segment{
+				{URI: "s12.m4s", Duration: 4 * time.Second, ProgramDateTime: start},
+				{URI: "s13.m4s", Duration: 4 * time.Second, ProgramDateTime: start.Add(4 * time.Second), Discontinuity: true},
+			},
+		}, "#EXTM3U\n#EXT-X-VERSION:7\n#EXT-X-TARGETDURATION:4\n#EXT-X-MEDIA-SEQUENCE:12\n#EXT-X-MAP:URI=\"init.mp4\"\n" +
+			"#EXT-X-PROGRAM-DATE-TIME:2024-05-01T12:00:00.000Z\n#EXTINF:4.000,\ns12.m4s\n" +
+			"#EXT-X-DISCONTINUITY\n#EXT-X-PROGRAM-DATE-TIME:2024-05-01T12:00:04.000Z\n#EXTINF:4.000,\ns13.m4s\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			if _, err := tt.p.WriteTo(&b); err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", b.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestMasterPlaylist(t *testing.T) {
+	p := MasterPlaylist{Variants: []Variant{
+		{URI: "hi/index.m3u8", Bandwidth: 5000000, AverageBandwidth: 4000000, Width: 1920, Height: 1080, Codecs: "avc1.640028", FrameRate: 25},
+		{URI: "lo/index.m3u8", Bandwidth: 800000},
+	}}
+	var b bytes.Buffer
+	if _, err := p.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-INDEPENDENT-SEGMENTS\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=5000000,AVERAGE-BANDWIDTH=4000000,RESOLUTION=1920x1080,FRAME-RATE=25.000,CODECS=\"avc1.640028\"\nhi/index.m3u8\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=800000\nlo/index.m3u8\n"
+	if b.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestSegmenter(t *testing.T) {
+	tests := []struct {
+		name      string
+		format    Format
+		window    int
+		wantFiles []string
+		wantGone  []string
+		wantLines []string
+	}{
+		{"ts", FormatTS, 0,
+			[]string{"segment00000.ts", "segment00001.ts", "segment00002.ts"}, nil,
+			[]string{"#EXT-X-VERSION:3", "#EXT-X-PLAYLIST-TYPE:EVENT", "#EXTINF:4.000,", "#EXTINF:2.400,", "#EXT-X-ENDLIST"}},
+		{"fmp4 window", FormatFMP4, 2,
+			[]string{"init.mp4", "segment00001.m4s", "segment00002.m4s"}, []string{"segment00000.m4s"},
+			[]string{"#EXT-X-VERSION:7", "#EXT-X-MAP:URI=\"init.mp4\"", "#EXT-X-MEDIA-SEQUENCE:1", "segment00002.m4s"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s, err := NewSegmenter(Config{
+				Dir:            dir,
+				Format:         tt.format,
+				TargetDuration: 4 * time.Second,
+				WindowSize:     tt.window,
+				DeleteSegments: true,
+				TimebaseNum:    1,
+				TimebaseDen:    25,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			/* 25 fps with 2 s GOPs; an unusable frame precedes the first keyframe */
+			if err := s.WriteFrame(annexB([]byte{0x41, 1}), -1, -1, false); err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 260; i++ {
+				keyframe := i%50 == 0
+				data := annexB([]byte{0x41, 0x9a, byte(i)})
+				if keyframe {
+					data = annexB(testSPS, testPPS, []byte{0x65, 0x88, byte(i)})
+				}
+				if due := s.KeyframeDue(int64(i)); due != (i > 0 && i%100 == 0) {
+					t.Errorf("frame %d: KeyframeDue %v", i, due)
+				}
+				if err := s.WriteFrame(data, int64(i), int64(i), keyframe); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.WriteFrame(nil, 0, 0, true); err != ErrClosed {
+				t.Errorf("WriteFrame after Close: %v", err)
+			}
+
+			raw, err := os.ReadFile(s.PlaylistPath())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, line := range tt.wantLines {
+				if !strings.Contains(string(raw), line+"\n") {
+					t.Errorf("playlist lacks %q:\n%s", line, raw)
+				}
+			}
+			for _, name := range tt.wantFiles {
+				if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+					t.Error(err)
+				}
+			}
+			for _, name := range tt.wantGone {
+				if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+					t.Errorf("%s not deleted: %v", name, err)
+				}
+			}
+			if tt.format == FormatFMP4 {
+				/* segment 1 holds frames 100-199 */
+				seg, err := os.ReadFile(filepath.Join(dir, "segment00001.m4s"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				styp := int(binary.BigEndian.Uint32(seg))
+				moof := seg[styp:]
+				if string(seg[4:8]) != "styp" || string(moof[4:8]) != "moof" {
+					t.Fatalf("segment starts with %q %q", seg[4:8], moof[4:8])
+				}
+				i := bytes.Index(moof, []byte("tfdt"))
+				if base := binary.BigEndian.Uint64(moof[i+8:]); base != 100*3600 {
+					t.Errorf("tfdt %d, want %d", base, 100*3600)
+				}
+				i = bytes.Index(moof, []byte("trun"))
+				if n := binary.BigEndian.Uint32(moof[i+8:]); n != 100 {
+					t.Errorf("%d samples, want 100", n)
+				}
+			}
+		})
+	}
+	if _, err := NewSegmenter(Config{Dir: t.TempDir(), TimebaseNum: 1, TimebaseDen: 25, Format: 7}); err == nil {
+		t.Error("NewSegmenter accepted an invalid format")
+	}
+}
+
+func TestSegmenterTargetDuration(t *testing.T) {
+	tests := []struct {
+		name      string
+		keyframes []int
+		want      string
+	}{
+		{"nominal", []int{0, 50, 100, 150}, "#EXT-X-TARGETDURATION:2\n"},
+		/* the 5 s segment slides out of the window but still sets the target */
+		{"long first segment", []int{0, 125, 150, 175}, "#EXT-X-TARGETDURATION:5\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewSegmenter(Config{
+				Dir:            t.TempDir(),
+				TargetDuration: 1 * time.Second,
+				WindowSize:     1,
+				TimebaseNum:    1,
+				TimebaseDen:    25,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			key := map[int]bool{}
+			for _, k := range tt.keyframes {
+				key[k] = true
+			}
+			for i := 0; i < 200; i++ {
+				data := annexB([]byte{0x41, 0x9a, byte(i)})
+				if key[i] {
+					data = annexB(testSPS, testPPS, []byte{0x65, 0x88, byte(i)})
+				}
+				if err := s.WriteFrame(data, int64(i), int64(i), key[i]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+			raw, err := os.ReadFile(s.PlaylistPath())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(raw), tt.want) {
+				t.Errorf("playlist lacks %q:\n%s", tt.want, raw)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+// Package hls cuts encoder output into HTTP Live Streaming segments on
+// keyframes and maintains the media and master playlists in a directory.
+package hls
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/moonfdd/x264-go/internal/media"
+)
+
+// Segment is one entry of a media playlist.
+type Segment struct {
+	URI      string
+	Duration time.Duration
+	/* zero when EXT-X-PROGRAM-DATE-TIME is not written */
+	ProgramDateTime time.Time
+	Discontinuity   bool
+}
+
+// MediaPlaylist is the list of segments of one rendition.
+type MediaPlaylist struct {
+	Version        int
+	TargetDuration time.Duration
+	MediaSequence  int
+	Segments       []Segment
+	/* EXT-X-MAP, the fMP4 initialization section */
+	Map string
+	/* EXT-X-PLAYLIST-TYPE: "", "EVENT" or "VOD" */
+	PlaylistType string
+	Ended        bool
+}
+
+// WriteTo writes the playlist in m3u8 format.
+func (p *MediaPlaylist) WriteTo(w io.Writer) (int64, error) {
+	var b bytes.Buffer
+	version := p.Version
+	if version == 0 {
+		version = 3
+		if p.Map != "" {
+			version = 7
+		}
+	}
+	target := p.TargetDuration
+	for _, s := range p.Segments {
+		if s.Duration > target {
+			target = s.Duration
+		}
+	}
+	b.WriteString("#EXTM3U\n")
+	fmt.Fprintf(&b, "#EXT-X-VERSION:%d\n", version)
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", int(math.Ceil(target.Seconds()-0.0005)))
+	fmt.Fprintf(&b, "#EXT-X-MEDIA-SEQUENCE:%d\n", p.MediaSequence)
+	if p.PlaylistType != "" {
+		fmt.Fprintf(&b, "#EXT-X-PLAYLIST-TYPE:%s\n", p.PlaylistType)
+	}
+	if p.Map != "" {
+		fmt.Fprintf(&b, "#EXT-X-MAP:URI=\"%s\"\n", p.Map)
+	}
+	for _, s := range p.Segments {
+		if s.Discontinuity {
+			b.WriteString("#EXT-X-DISCONTINUITY\n")
+		}
+		if !s.ProgramDateTime.IsZero() {
+			fmt.Fprintf(&b, "#EXT-X-PROGRAM-DATE-TIME:%s\n", s.ProgramDateTime.UTC().Format("2006-01-02T15:04:05.000Z07:00"))
+		}
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\n%s\n", s.Duration.Seconds(), s.URI)
+	}
+	if p.Ended {
+		b.WriteString("#EXT-X-ENDLIST\n")
+	}
+	return b.WriteTo(w)
+}
+
+// Variant is one rendition referenced by a master playlist.
+type Variant struct {
+	URI              string
+	Bandwidth        int /* peak bits per second */
+	AverageBandwidth int
+	Width, Height    int
+	/* e.g. "avc1.64001f" */
+	Codecs    string
+	FrameRate float64
+}
+
+// MasterPlaylist lists the renditions of a stream.
+type MasterPlaylist struct {
+	Version  int
+	Variants []Variant
+}
+
+// WriteTo writes the master playlist in m3u8 format.
+func (p *MasterPlaylist) WriteTo(w io.Writer) (int64, error) {
+	var b bytes.Buffer
+	version := p.Version
+	if version == 0 {
+		version = 3
+	}
+	b.WriteString("#EXTM3U\n")
+	fmt.Fprintf(&b, "#EXT-X-VERSION:%d\n", version)
+	b.WriteString("#EXT-X-INDEPENDENT-SEGMENTS\n")
+	for _, v := range p.Variants {
+		fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d", v.Bandwidth)
+		if v.AverageBandwidth > 0 {
+			fmt.Fprintf(&b, ",AVERAGE-BANDWIDTH=%d", v.AverageBandwidth)
+		}
+		if v.Width > 0 && v.Height > 0 {
+			fmt.Fprintf(&b, ",RESOLUTION=%dx%d", v.Width, v.Height)
+		}
+		if v.FrameRate > 0 {
+			fmt.Fprintf(&b, ",FRAME-RATE=%.3f", v.FrameRate)
+		}
+		if v.Codecs != "" {
+			fmt.Fprintf(&b, ",CODECS=\"%s\"", v.Codecs)
+		}
+		fmt.Fprintf(&b, "\n%s\n", v.URI)
+	}
+	return b.WriteTo(w)
+}
+
+// WriteFile writes the master playlist to path atomically.
+func (p *MasterPlaylist) WriteFile(path string) error {
+	return media.WriteFileAtomic(path, p)
+}
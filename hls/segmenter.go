@@ -0,0 +1,309 @@
+package hls
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/moonfdd/x264-go/fmp4"
+	"github.com/moonfdd/x264-go/h264"
+	"github.com/moonfdd/x264-go/internal/media"
+	"github.com/moonfdd/x264-go/libx264"
+	"github.com/moonfdd/x264-go/mpegts"
+)
+
+// Format is the container of the media segments.
+type Format int
+
+const (
+	FormatTS   Format = iota /* MPEG-2 transport stream */
+	FormatFMP4               /* fragmented MP4 with an EXT-X-MAP initialization section */
+)
+
+// Config describes one HLS rendition written to a directory.
+type Config struct {
+	Dir          string
+	PlaylistName string /* default "index.m3u8" */
+	Format       Format
+	/* segment file name pattern taking the segment number, default
+	 * "segment%05d.ts" or "segment%05d.m4s" */
+	SegmentPattern string
+	InitName       string /* fMP4 initialization section, default "init.mp4" */
+
+	/* segments are cut on the first keyframe at or after this duration */
+	TargetDuration time.Duration
+
+	/* number of segments kept in a live playlist, 0 keeps all of them (event/VOD) */
+	WindowSize int
+	/* remove segment files that slid out of the window */
+	DeleteSegments bool
+
+	/* when non-zero, EXT-X-PROGRAM-DATE-TIME is written relative to this wall clock time of the first frame */
+	StartTime time.Time
+
+	/* timebase of the PTS/DTS passed to WriteFrame, i.e. i_timebase_num/i_timebase_den */
+	TimebaseNum int64
+	TimebaseDen int64
+}
+
+var ErrClosed = errors.New("hls: segmenter closed")
+
+// Segmenter writes MPEG-TS or fMP4 segments and keeps the media playlist
+// current.
+//
+// Segments can only start on keyframes.  To keep segment lengths exact the
+// caller can force an IDR whenever KeyframeDue reports true:
+//
+//	if seg.KeyframeDue(pts) {
+//		pic.SetType(libx264.X264_TYPE_IDR)
+//	}
+type Segmenter struct {
+	cfg      Config
+	playlist MediaPlaylist
+
+	file  *os.File
+	buf   *bufio.Writer
+	mux   *mpegts.Muxer
+	frag  *fmp4.Fragmenter /* FormatFMP4 */
+	index int
+
+	segStart int64 /* pts of the first frame of the open segment */
+	open     bool
+	firstPts int64
+	offset   int64 /* 90 kHz shift keeping DTS non-negative */
+	started  bool
+	lastPts  int64
+	maxPts   int64
+	frameDur int64 /* smallest pts step seen, used for the last segment */
+	closed   bool
+}
+
+// NewSegmenter creates cfg.Dir if needed and returns a segmenter.
+func NewSegmenter(cfg Config) (*Segmenter, error) {
+	if cfg.PlaylistName == "" {
+		cfg.PlaylistName = "index.m3u8"
+	}
+	if cfg.SegmentPattern == "" {
+		cfg.SegmentPattern = "segment%05d.ts"
+		if cfg.Format == FormatFMP4 {
+			cfg.SegmentPattern = "segment%05d.m4s"
+		}
+	}
+	if cfg.InitName == "" {
+		cfg.InitName = "init.mp4"
+	}
+	if cfg.TargetDuration <= 0 {
+		cfg.TargetDuration = 6 * time.Second
+	}
+	if cfg.TimebaseNum <= 0 || cfg.TimebaseDen <= 0 {
+		return nil, errors.New("hls: invalid timebase")
+	}
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &Segmenter{cfg: cfg}
+	switch cfg.Format {
+	case FormatTS:
+	case FormatFMP4:
+		var err error
+		if s.frag, err = fmp4.NewFragmenter(0, cfg.TimebaseNum, cfg.TimebaseDen); err != nil {
+			return nil, err
+		}
+		s.playlist.Map = cfg.InitName
+	default:
+		return nil, fmt.Errorf("hls: invalid segment format %d", cfg.Format)
+	}
+	s.playlist.TargetDuration = cfg.TargetDuration
+	if cfg.WindowSize == 0 {
+		s.playlist.PlaylistType = "EVENT"
+	}
+	return s, nil
+}
+
+// Playlist returns the media playlist as last written.
+func (s *Segmenter) Playlist() *MediaPlaylist {
+	return &s.playlist
+}
+
+// PlaylistPath returns the path of the media playlist.
+func (s *Segmenter) PlaylistPath() string {
+	return filepath.Join(s.cfg.Dir, s.cfg.PlaylistName)
+}
+
+// KeyframeDue reports whether the frame with the given input pts should be
+// forced to be an IDR frame so that the current segment ends on time.
+func (s *Segmenter) KeyframeDue(pts int64) bool {
+	if !s.open {
+		return false
+	}
+	return s.duration(pts-s.segStart) >= s.cfg.TargetDuration
+}
+
+// WriteNals writes one encoded picture as returned by X264EncoderEncode.
+func (s *Segmenter) WriteNals(nals []libx264.X264NalT, pic_out *libx264.X264PictureT) error {
+	var data []byte
+	for i := range nals {
+		data = nals[i].AppendAnnexB(data)
+	}
+	return s.WriteFrame(data, pic_out.IPts, pic_out.Dts(), pic_out.IsKeyframe())
+}
+
+// WriteFrame writes one Annex-B access unit with timestamps in the
+// configured timebase.
+func (s *Segmenter) WriteFrame(data []byte, pts, dts int64, keyframe bool) error {
+	if s.closed {
+		return ErrClosed
+	}
+	if !s.started {
+		if !keyframe {
+			/* nothing can be decoded before the first keyframe */
+			return nil
+		}
+		if s.frag != nil {
+			if err := s.writeInit(data); err != nil {
+				return err
+			}
+		}
+		s.started = true
+		s.firstPts = pts
+		if d := s.to90k(dts); d < 0 {
+			s.offset = -d
+		}
+	}
+	if s.open {
+		d := pts - s.lastPts
+		if d < 0 {
+			d = -d
+		}
+		if d > 0 && (s.frameDur == 0 || d < s.frameDur) {
+			s.frameDur = d
+		}
+	}
+	s.lastPts = pts
+	if !s.open || pts > s.maxPts {
+		s.maxPts = pts
+	}
+	if s.frag != nil {
+		s.frag.Push(h264.SplitAnnexB(data), pts, dts, keyframe)
+	}
+
+	if keyframe && (!s.open || s.duration(pts-s.segStart) >= s.cfg.TargetDuration) {
+		if err := s.finishSegment(pts); err != nil {
+			return err
+		}
+		if err := s.openSegment(pts); err != nil {
+			return err
+		}
+	}
+	if s.mux == nil {
+		return nil
+	}
+	return s.mux.WriteVideo(data, s.to90k(pts)+s.offset, s.to90k(dts)+s.offset, keyframe)
+}
+
+// Close finishes the last segment and marks the playlist as ended.
+func (s *Segmenter) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	if s.frag != nil {
+		s.frag.Finish()
+	}
+	end := s.maxPts + s.frameDur
+	if err := s.finishSegment(end); err != nil {
+		return err
+	}
+	s.playlist.Ended = true
+	return media.WriteFileAtomic(s.PlaylistPath(), &s.playlist)
+}
+
+func (s *Segmenter) writeInit(data []byte) error {
+	sps, pps := h264.ParameterSets(h264.SplitAnnexB(data))
+	if len(sps) == 0 || len(pps) == 0 {
+		return errors.New("hls: no SPS/PPS before the first keyframe")
+	}
+	init, err := fmp4.InitSegment(sps, pps, s.frag.Timescale)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(s.cfg.Dir, s.cfg.InitName), init, 0644)
+}
+
+func (s *Segmenter) openSegment(pts int64) error {
+	s.segStart = pts
+	s.open = true
+	if s.frag != nil {
+		return nil
+	}
+	name := fmt.Sprintf(s.cfg.SegmentPattern, s.index)
+	f, err := os.Create(filepath.Join(s.cfg.Dir, name))
+	if err != nil {
+		return err
+	}
+	s.file = f
+	s.buf = bufio.NewWriter(f)
+	s.mux = mpegts.NewMuxer(s.buf)
+	return s.mux.WriteTables()
+}
+
+func (s *Segmenter) finishSegment(end int64) error {
+	if !s.open {
+		return nil
+	}
+	s.open = false
+	if err := s.writeSegment(); err != nil {
+		return err
+	}
+
+	seg := Segment{
+		URI:      fmt.Sprintf(s.cfg.SegmentPattern, s.index),
+		Duration: s.duration(end - s.segStart),
+	}
+	if !s.cfg.StartTime.IsZero() {
+		seg.ProgramDateTime = s.cfg.StartTime.Add(s.duration(s.segStart - s.firstPts))
+	}
+	s.index++
+	/* EXT-X-TARGETDURATION must not change between reloads, so it keeps
+	 * the longest segment ever listed rather than that of the window */
+	if seg.Duration > s.playlist.TargetDuration {
+		s.playlist.TargetDuration = seg.Duration
+	}
+	s.playlist.Segments = append(s.playlist.Segments, seg)
+	if n := s.cfg.WindowSize; n > 0 && len(s.playlist.Segments) > n {
+		removed := s.playlist.Segments[:len(s.playlist.Segments)-n]
+		s.playlist.Segments = s.playlist.Segments[len(removed):]
+		s.playlist.MediaSequence += len(removed)
+		if s.cfg.DeleteSegments {
+			for _, r := range removed {
+				os.Remove(filepath.Join(s.cfg.Dir, r.URI))
+			}
+		}
+	}
+	return media.WriteFileAtomic(s.PlaylistPath(), &s.playlist)
+}
+
+func (s *Segmenter) writeSegment() error {
+	if s.frag != nil {
+		samples, base := s.frag.Flush()
+		seg := fmp4.MediaSegment(uint32(s.index+1), base, samples)
+		return os.WriteFile(filepath.Join(s.cfg.Dir, fmt.Sprintf(s.cfg.SegmentPattern, s.index)), seg, 0644)
+	}
+	err := s.buf.Flush()
+	if cerr := s.file.Close(); err == nil {
+		err = cerr
+	}
+	s.file, s.buf, s.mux = nil, nil, nil
+	return err
+}
+
+func (s *Segmenter) duration(ticks int64) time.Duration {
+	return time.Duration(media.Rescale(ticks, s.cfg.TimebaseNum*int64(time.Second), s.cfg.TimebaseDen))
+}
+
+func (s *Segmenter) to90k(ts int64) int64 {
+	return media.Rescale(ts, s.cfg.TimebaseNum*90000, s.cfg.TimebaseDen)
+}
@@ -0,0 +1,44 @@
+package hls
+
+import (
+	"github.com/moonfdd/x264-go/libx264"
+)
+
+type segmenterSink struct {
+	s       *Segmenter
+	headers []byte
+}
+
+// Sink returns the segmenter as a libx264.Sink.  The SPS/PPS from
+// WriteHeaders are prepended to keyframes that do not carry them, so every
+// segment is decodable even with b_repeat_headers off.
+func (s *Segmenter) Sink() libx264.Sink {
+	return &segmenterSink{s: s}
+}
+
+func (k *segmenterSink) WriteHeaders(nals []libx264.X264NalT) error {
+	for i := range nals {
+		switch nals[i].IType {
+		case libx264.NAL_SPS, libx264.NAL_PPS:
+			k.headers = nals[i].AppendAnnexB(k.headers)
+		}
+	}
+	return nil
+}
+
+func (k *segmenterSink) WriteFrame(f *libx264.Frame) error {
+	var data []byte
+	hasSPS := false
+	for i := range f.Nals {
+		hasSPS = hasSPS || f.Nals[i].IType == libx264.NAL_SPS
+		data = f.Nals[i].AppendAnnexB(data)
+	}
+	if f.Keyframe && !hasSPS && len(k.headers) > 0 {
+		data = append(append([]byte(nil), k.headers...), data...)
+	}
+	return k.s.WriteFrame(data, f.Pts, f.Dts, f.Keyframe)
+}
+
+func (k *segmenterSink) Close() error {
+	return k.s.Close()
+}
@@ -0,0 +1,40 @@
+// Package media holds the helpers shared by the container and streaming
+// output packages.
+package media
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Rescale returns ts*num/den without overflowing for large ts.
+func Rescale(ts, num, den int64) int64 {
+	q, r := ts/den, ts%den
+	return q*num + r*num/den
+}
+
+// WriteFileAtomic writes to a temporary file and renames it over path so
+// that clients polling a playlist or manifest never see a partial file.
+func WriteFileAtomic(path string, src io.WriterTo) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = src.WriteTo(tmp); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	/* CreateTemp makes the file private; web servers must be able to read it */
+	if err = tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
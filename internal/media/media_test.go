@@ -0,0 +1,45 @@
+package media
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing os.FileMode /* zero when the file does not exist yet */
+	}{
+		{"new file", 0},
+		{"replace private file", 0600},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "index.m3u8")
+			if tt.existing != 0 {
+				if err := os.WriteFile(path, []byte("old"), tt.existing); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := WriteFileAtomic(path, bytes.NewBufferString("#EXTM3U\n")); err != nil {
+				t.Fatal(err)
+			}
+			fi, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fi.Mode().Perm() != 0644 {
+				t.Errorf("mode %v, want 0644", fi.Mode().Perm())
+			}
+			if raw, _ := os.ReadFile(path); string(raw) != "#EXTM3U\n" {
+				t.Errorf("content %q", raw)
+			}
+			if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+				t.Errorf("%d files left in directory", len(entries))
+			}
+		})
+	}
+}
@@ -0,0 +1,294 @@
+package libx264
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/moonfdd/ffmpeg-go/ffcommon"
+)
+
+// CompatFormat is a resolution and frame rate allowed by a specification.
+type CompatFormat struct {
+	Width, Height  int
+	FpsNum, FpsDen uint32
+	Interlaced     bool /* field coded source, top field first */
+}
+
+func (f CompatFormat) String() string {
+	scan := "p"
+	if f.Interlaced {
+		scan = "i"
+	}
+	return fmt.Sprintf("%dx%d %.5g%s", f.Width, f.Height, float64(f.FpsNum)/float64(f.FpsDen), scan)
+}
+
+func (f CompatFormat) matches(width, height int, fpsNum, fpsDen uint32, interlaced bool) bool {
+	return f.Width == width && f.Height == height && f.Interlaced == interlaced &&
+		uint64(f.FpsNum)*uint64(fpsDen) == uint64(fpsNum)*uint64(f.FpsDen)
+}
+
+func compatError(spec string, formats []CompatFormat, width, height int, fpsNum, fpsDen uint32, interlaced bool) error {
+	allowed := make([]string, len(formats))
+	for i, f := range formats {
+		allowed[i] = f.String()
+	}
+	have := CompatFormat{width, height, fpsNum, fpsDen, interlaced}
+	return fmt.Errorf("libx264: %s does not allow %v; allowed formats: %s", spec, have, strings.Join(allowed, ", "))
+}
+
+func findFormat(formats []CompatFormat, width, height int, fpsNum, fpsDen uint32, interlaced bool) (CompatFormat, bool) {
+	for _, f := range formats {
+		if f.matches(width, height, fpsNum, fpsDen, interlaced) {
+			return f, true
+		}
+	}
+	return CompatFormat{}, false
+}
+
+// BlurayFormats lists the video formats of the Blu-ray specification.  25p
+// and 29.97p at 1080 and 576 lines are coded fake interlaced.
+var BlurayFormats = []CompatFormat{
+	{1920, 1080, 24000, 1001, false}, {1920, 1080, 24, 1, false},
+	{1920, 1080, 25, 1, false}, {1920, 1080, 30000, 1001, false},
+	{1920, 1080, 25, 1, true}, {1920, 1080, 30000, 1001, true},
+	{1440, 1080, 24000, 1001, false}, {1440, 1080, 24, 1, false},
+	{1440, 1080, 25, 1, false}, {1440, 1080, 30000, 1001, false},
+	{1440, 1080, 25, 1, true}, {1440, 1080, 30000, 1001, true},
+	{1280, 720, 24000, 1001, false}, {1280, 720, 24, 1, false},
+	{1280, 720, 50, 1, false}, {1280, 720, 60000, 1001, false},
+	{720, 576, 25, 1, true}, {720, 576, 25, 1, false},
+	{720, 480, 30000, 1001, true}, {720, 480, 24000, 1001, false},
+}
+
+/* allowed SARs of the anamorphic Blu-ray formats, 4:3 and 16:9 */
+func bluraySARs(width, height int) []string {
+	switch {
+	case width == 1440:
+		return []string{"4:3"}
+	case height == 576:
+		return []string{"16:15", "64:45"}
+	case height == 480:
+		return []string{"8:9", "32:27"}
+	}
+	return nil
+}
+
+// ApplyBluray makes param Blu-ray compliant for the picture size and frame
+// rate already set, as recommended for x264 --bluray-compat: level 4.1,
+// VBV 40000/30000, 4 slices, NAL HRD, AUDs, open GOPs of at most one
+// second, at most 3 strict pyramid B-frames and the reference limit of the
+// resolution.  interlaced selects field coding of an interlaced source.
+// 720x480 23.976p needs 3:2 pulldown (SetPulldown) afterwards.  The SAR of
+// the anamorphic formats must be set first, except 1440x1080 which is
+// always 4:3.
+func (param *X264ParamT) ApplyBluray(interlaced bool) error {
+	w, h := int(param.IWidth), int(param.IHeight)
+	fpsNum, fpsDen := param.FPS()
+	f, ok := findFormat(BlurayFormats, w, h, fpsNum, fpsDen, interlaced)
+	if !ok {
+		return compatError("Blu-ray", BlurayFormats, w, h, fpsNum, fpsDen, interlaced)
+	}
+	if param.ICsp&X264_CSP_MASK != X264_CSP_I420 || param.i_bitdepth > 8 {
+		return fmt.Errorf("libx264: Blu-ray needs 8-bit 4:2:0")
+	}
+	if w == 1440 && param.vui.i_sar_width == 0 {
+		if err := param.SetSAR(4, 3); err != nil {
+			return err
+		}
+	}
+	if sars := bluraySARs(w, h); sars != nil {
+		sw, sh := param.SAR()
+		sar := fmt.Sprintf("%d:%d", sw, sh)
+		ok := false
+		for _, s := range sars {
+			ok = ok || s == sar
+		}
+		if !ok {
+			return fmt.Errorf("libx264: Blu-ray %v needs a SAR of %s, have %s", f, strings.Join(sars, " or "), sar)
+		}
+	}
+	if param.rc.i_rc_method == X264_RC_CQP {
+		return fmt.Errorf("libx264: Blu-ray needs VBV, which CQP rate control does not support")
+	}
+	if maxrate, bufsize := param.VBV(); maxrate <= 0 || maxrate > 40000 || bufsize <= 0 || bufsize > 30000 {
+		param.SetVBV(40000, 30000)
+	}
+
+	param.b_bluray_compat = 1
+	param.i_level_idc = 41
+	param.i_slice_count = 4
+	param.i_slice_max_mbs = 0
+	param.i_nal_hrd = X264_NAL_HRD_VBR
+	param.b_aud = 1
+	param.b_open_gop = 1
+	param.b_vfr_input = 0
+	keyint := ffcommon.FInt((uint64(fpsNum) + uint64(fpsDen)/2) / uint64(fpsDen))
+	if param.i_keyint_max <= 0 || param.i_keyint_max > keyint {
+		param.i_keyint_max = keyint
+	}
+	if param.i_keyint_min > param.i_keyint_max {
+		param.i_keyint_min = param.i_keyint_max
+	}
+	if param.i_bframe > 3 {
+		param.i_bframe = 3
+	}
+	if param.i_bframe_pyramid == X264_B_PYRAMID_NORMAL {
+		param.i_bframe_pyramid = X264_B_PYRAMID_STRICT
+	}
+	maxRef := ffcommon.FInt(6)
+	if h == 1080 {
+		maxRef = 4
+	}
+	if param.i_frame_reference > maxRef {
+		param.i_frame_reference = maxRef
+	}
+
+	switch {
+	case interlaced:
+		param.SetScan(ScanInterlaced, true)
+	case (h == 1080 || h == 576) && f.FpsNum != 24 && f.FpsNum != 24000:
+		param.SetScan(ScanFakeInterlaced, true)
+	default:
+		param.SetScan(ScanProgressive, true)
+	}
+	prim, transfer, matrix := ColorPrimariesBT709, TransferBT709, MatrixBT709
+	switch h {
+	case 576:
+		prim, transfer, matrix = ColorPrimariesBT470BG, TransferBT470BG, MatrixBT470BG
+	case 480:
+		prim, transfer, matrix = ColorPrimariesSMPTE170M, TransferSMPTE170M, MatrixSMPTE170M
+	}
+	return param.SetColor(prim, transfer, matrix)
+}
+
+// AVCIntraFormats lists the formats of AVC-Intra classes 100 and 200;
+// class 50 is anamorphic (1440x1080, 960x720).
+var AVCIntraFormats = []CompatFormat{
+	{1920, 1080, 30000, 1001, true}, {1920, 1080, 25, 1, true},
+	{1920, 1080, 30000, 1001, false}, {1920, 1080, 25, 1, false}, {1920, 1080, 24000, 1001, false},
+	{1280, 720, 60000, 1001, false}, {1280, 720, 50, 1, false},
+	{1280, 720, 30000, 1001, false}, {1280, 720, 25, 1, false}, {1280, 720, 24000, 1001, false},
+}
+
+// AVCIntraClasses are the supported i_avcintra_class values.
+var AVCIntraClasses = []int{50, 100, 200}
+
+func avcIntraFormats(class int) []CompatFormat {
+	formats := make([]CompatFormat, len(AVCIntraFormats))
+	for i, f := range AVCIntraFormats {
+		if class == 50 {
+			f.Width = f.Width * 3 / 4
+		}
+		formats[i] = f
+	}
+	return formats
+}
+
+// ApplyAVCIntra configures an AVC-Intra class 50, 100 or 200 encode in the
+// Panasonic or Sony flavor (X264_AVCINTRA_FLAVOR_*) for the picture size
+// and frame rate already set: 10-bit, 4:2:0 for class 50 and 4:2:2
+// otherwise.  x264 derives the remaining settings (intra only, CAVLC or
+// CABAC, slices, quant matrices, frame size) from the class.  The input
+// pictures must use the colorspace set here.  It fails if the library is
+// not built for 10-bit or the chroma format.
+func (param *X264ParamT) ApplyAVCIntra(class, flavor int, interlaced bool) error {
+	valid := false
+	for _, c := range AVCIntraClasses {
+		valid = valid || c == class
+	}
+	if !valid {
+		return fmt.Errorf("libx264: invalid AVC-Intra class %d, want one of %v", class, AVCIntraClasses)
+	}
+	if flavor != X264_AVCINTRA_FLAVOR_PANASONIC && flavor != X264_AVCINTRA_FLAVOR_SONY {
+		return fmt.Errorf("libx264: invalid AVC-Intra flavor %d, want one of %v", flavor, X264AvcintraFlavorNames)
+	}
+	formats := avcIntraFormats(class)
+	w, h := int(param.IWidth), int(param.IHeight)
+	fpsNum, fpsDen := param.FPS()
+	if _, ok := findFormat(formats, w, h, fpsNum, fpsDen, interlaced); !ok {
+		return compatError(fmt.Sprintf("AVC-Intra %d", class), formats, w, h, fpsNum, fpsDen, interlaced)
+	}
+
+	csp := ffcommon.FInt(X264_CSP_I422)
+	if class == 50 {
+		csp = X264_CSP_I420
+	}
+	if !SupportsBitDepth(10) {
+		return fmt.Errorf("libx264: AVC-Intra needs 10-bit, the library is built for %d-bit only", libBitDepth)
+	}
+	if !SupportsChromaFormat(int(csp)) {
+		return fmt.Errorf("libx264: AVC-Intra %d needs %s, the library is built for %s only",
+			class, chromaName(int(csp)), chromaName(libChromaFormat))
+	}
+
+	param.i_avcintra_class = ffcommon.FInt(class)
+	param.i_avcintra_flavor = ffcommon.FInt(flavor)
+	param.i_bitdepth = 10
+	param.ICsp = param.ICsp&^X264_CSP_MASK | csp
+	param.b_vfr_input = 0
+	param.b_bluray_compat = 0
+	mode := ScanProgressive
+	if interlaced {
+		mode = ScanInterlaced
+	}
+	param.SetScan(mode, true)
+	if w == 1440 || w == 960 {
+		if err := param.SetSAR(4, 3); err != nil {
+			return err
+		}
+	}
+	return param.SetColor(ColorPrimariesBT709, TransferBT709, MatrixBT709)
+}
+
+/* X264_BIT_DEPTH and X264_CHROMA_FORMAT of the library, 0 for any */
+var libBitDepth, libChromaFormat = X264_BIT_DEPTH, X264_CHROMA_FORMAT
+
+// SupportsBitDepth reports whether the library was built for depth: x264
+// builds 8-bit, 10-bit or both (X264_BIT_DEPTH 0).
+func SupportsBitDepth(depth int) bool {
+	if libBitDepth != 0 {
+		return depth == libBitDepth
+	}
+	return depth == 8 || depth == 10
+}
+
+// SupportsChromaFormat reports whether the library was built for the
+// chroma format of csp (X264_CSP_I400, I420, I422 or I444 and their
+// variants).
+func SupportsChromaFormat(csp int) bool {
+	if libChromaFormat == 0 {
+		return true
+	}
+	switch csp & X264_CSP_MASK {
+	case X264_CSP_I400:
+		return libChromaFormat == X264_CSP_I400
+	case X264_CSP_I422, X264_CSP_YV16, X264_CSP_NV16, X264_CSP_YUYV, X264_CSP_UYVY, X264_CSP_V210:
+		return libChromaFormat == X264_CSP_I422
+	case X264_CSP_I444, X264_CSP_YV24, X264_CSP_BGR, X264_CSP_BGRA, X264_CSP_RGB:
+		return libChromaFormat == X264_CSP_I444
+	}
+	return libChromaFormat == X264_CSP_I420
+}
+
+func chromaName(csp int) string {
+	switch csp & X264_CSP_MASK {
+	case X264_CSP_I400:
+		return "4:0:0"
+	case X264_CSP_I422:
+		return "4:2:2"
+	case X264_CSP_I444:
+		return "4:4:4"
+	}
+	return "4:2:0"
+}
+
+// AVCIntraClass returns i_avcintra_class and i_avcintra_flavor; class 0 is
+// a normal encode.
+func (param *X264ParamT) AVCIntraClass() (class, flavor int) {
+	return int(param.i_avcintra_class), int(param.i_avcintra_flavor)
+}
+
+// BlurayCompat reports whether b_bluray_compat is set.
+func (param *X264ParamT) BlurayCompat() bool {
+	return param.b_bluray_compat != 0
+}
@@ -0,0 +1,113 @@
+package libx264
+
+import "testing"
+
+func compatParam(t *testing.T, width, height int, fpsNum, fpsDen uint32) *X264ParamT {
+	t.Helper()
+	param := new(X264ParamT)
+	param.IWidth, param.IHeight = int32(width), int32(height)
+	param.ICsp = X264_CSP_I420
+	param.SetBitDepth(8)
+	if err := param.SetFPS(fpsNum, fpsDen); err != nil {
+		t.Fatal(err)
+	}
+	return param
+}
+
+func TestApplyAVCIntra(t *testing.T) {
+	tests := []struct {
+		name           string
+		class          int
+		width, height  int
+		fpsNum, fpsDen uint32
+		interlaced     bool
+		libDepth       int
+		libChroma      int
+		ok             bool
+		csp            int
+		sarW, sarH     int
+	}{
+		{"class 100 1080i", 100, 1920, 1080, 30000, 1001, true, 0, 0, true, X264_CSP_I422, 0, 0},
+		{"class 200 720p", 200, 1280, 720, 50, 1, false, 0, 0, true, X264_CSP_I422, 0, 0},
+		{"class 50 anamorphic", 50, 1440, 1080, 25, 1, false, 0, 0, true, X264_CSP_I420, 4, 3},
+		{"class 50 full width", 50, 1920, 1080, 25, 1, false, 0, 0, false, 0, 0, 0},
+		{"unknown class", 75, 1920, 1080, 25, 1, false, 0, 0, false, 0, 0, 0},
+		{"8-bit library", 100, 1920, 1080, 25, 1, false, 8, 0, false, 0, 0, 0},
+		{"10-bit library", 100, 1920, 1080, 25, 1, false, 10, 0, true, X264_CSP_I422, 0, 0},
+		{"4:2:0 library", 100, 1920, 1080, 25, 1, false, 0, X264_CSP_I420, false, 0, 0, 0},
+		{"4:2:0 library class 50", 50, 960, 720, 50, 1, false, 0, X264_CSP_I420, true, X264_CSP_I420, 4, 3},
+	}
+	defer func() { libBitDepth, libChromaFormat = X264_BIT_DEPTH, X264_CHROMA_FORMAT }()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			libBitDepth, libChromaFormat = tt.libDepth, tt.libChroma
+			param := compatParam(t, tt.width, tt.height, tt.fpsNum, tt.fpsDen)
+			err := param.ApplyAVCIntra(tt.class, X264_AVCINTRA_FLAVOR_PANASONIC, tt.interlaced)
+			if (err == nil) != tt.ok {
+				t.Fatalf("ApplyAVCIntra: %v", err)
+			}
+			if err != nil {
+				if class, _ := param.AVCIntraClass(); class != 0 || param.BitDepth() != 8 {
+					t.Errorf("failed call changed param: class %d depth %d", class, param.BitDepth())
+				}
+				return
+			}
+			if class, flavor := param.AVCIntraClass(); class != tt.class || flavor != X264_AVCINTRA_FLAVOR_PANASONIC {
+				t.Errorf("class %d flavor %d", class, flavor)
+			}
+			if param.BitDepth() != 10 || int(param.ICsp&X264_CSP_MASK) != tt.csp {
+				t.Errorf("depth %d csp %#x", param.BitDepth(), param.ICsp)
+			}
+			if w, h := param.SAR(); w != tt.sarW || h != tt.sarH {
+				t.Errorf("SAR %d:%d, want %d:%d", w, h, tt.sarW, tt.sarH)
+			}
+		})
+	}
+}
+
+func TestApplyBluray(t *testing.T) {
+	tests := []struct {
+		name           string
+		width, height  int
+		fpsNum, fpsDen uint32
+		interlaced     bool
+		sarW, sarH     int /* set before */
+		depth          int
+		ok             bool
+		wantSarW       int
+		wantSarH       int
+	}{
+		{"1080p 23.976", 1920, 1080, 24000, 1001, false, 0, 0, 8, true, 0, 0},
+		{"1440 sets 4:3", 1440, 1080, 25, 1, true, 0, 0, 8, true, 4, 3},
+		{"576i 16:9", 720, 576, 25, 1, true, 64, 45, 8, true, 64, 45},
+		{"576i without SAR", 720, 576, 25, 1, true, 0, 0, 8, false, 0, 0},
+		{"1080p 50", 1920, 1080, 50, 1, false, 0, 0, 8, false, 0, 0},
+		{"10-bit", 1920, 1080, 25, 1, false, 0, 0, 10, false, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			param := compatParam(t, tt.width, tt.height, tt.fpsNum, tt.fpsDen)
+			param.SetBitDepth(tt.depth)
+			param.SetBitrate(20000)
+			if err := param.SetSAR(tt.sarW, tt.sarH); err != nil {
+				t.Fatal(err)
+			}
+			err := param.ApplyBluray(tt.interlaced)
+			if (err == nil) != tt.ok {
+				t.Fatalf("ApplyBluray: %v", err)
+			}
+			if err != nil {
+				return
+			}
+			if !param.BlurayCompat() || param.i_level_idc != 41 || param.i_slice_count != 4 {
+				t.Errorf("bluray_compat %v level %d slices %d", param.BlurayCompat(), param.i_level_idc, param.i_slice_count)
+			}
+			if m, b := param.VBV(); m != 40000 || b != 30000 {
+				t.Errorf("VBV %d/%d", m, b)
+			}
+			if w, h := param.SAR(); w != tt.wantSarW || h != tt.wantSarH {
+				t.Errorf("SAR %d:%d, want %d:%d", w, h, tt.wantSarW, tt.wantSarH)
+			}
+		})
+	}
+}
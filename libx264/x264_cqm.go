@@ -0,0 +1,282 @@
+package libx264
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/moonfdd/ffmpeg-go/ffcommon"
+)
+
+// CQM is a set of custom quantization matrices in raster order, as in the
+// cqm_* arrays of x264_param_t.  Coefficients must be 1..255; 16 is flat.
+type CQM struct {
+	Intra4Y, Inter4Y, Intra4C, Inter4C [16]uint8
+	Intra8Y, Inter8Y, Intra8C, Inter8C [64]uint8 /* chroma 8x8 only used for 4:4:4 */
+}
+
+/* progressive zigzag scans, the order of the default tables below */
+var zigzag4, zigzag8 = zigzag(4), zigzag(8)
+
+func zigzag(n int) []int {
+	scan := make([]int, 0, n*n)
+	for d := 0; d < 2*n-1; d++ {
+		for i := 0; i <= d; i++ {
+			x, y := d-i, i /* odd diagonals run down-left */
+			if d%2 == 0 {
+				x, y = i, d-i
+			}
+			if x < n && y < n {
+				scan = append(scan, y*n+x)
+			}
+		}
+	}
+	return scan
+}
+
+func unzigzag(dst []uint8, src []uint8, scan []int) {
+	for i, v := range src {
+		dst[scan[i]] = v
+	}
+}
+
+/* H.264 default scaling lists (tables 7-3 and 7-4) in zigzag order */
+var (
+	jvt4Intra = []uint8{6, 13, 13, 20, 20, 20, 28, 28, 28, 28, 32, 32, 32, 37, 37, 42}
+	jvt4Inter = []uint8{10, 14, 14, 20, 20, 20, 24, 24, 24, 24, 27, 27, 27, 30, 30, 34}
+	jvt8Intra = []uint8{
+		6, 10, 10, 13, 11, 13, 16, 16, 16, 16, 18, 18, 18, 18, 18, 23,
+		23, 23, 23, 23, 23, 25, 25, 25, 25, 25, 25, 25, 27, 27, 27, 27,
+		27, 27, 27, 27, 29, 29, 29, 29, 29, 29, 29, 31, 31, 31, 31, 31,
+		31, 33, 33, 33, 33, 33, 36, 36, 36, 36, 38, 38, 38, 40, 40, 42,
+	}
+	jvt8Inter = []uint8{
+		9, 13, 13, 15, 13, 15, 17, 17, 17, 17, 19, 19, 19, 19, 19, 21,
+		21, 21, 21, 21, 21, 22, 22, 22, 22, 22, 22, 22, 24, 24, 24, 24,
+		24, 24, 24, 24, 25, 25, 25, 25, 25, 25, 25, 27, 27, 27, 27, 27,
+		27, 28, 28, 28, 28, 28, 30, 30, 30, 30, 32, 32, 32, 33, 33, 35,
+	}
+)
+
+// FlatCQM returns the flat matrices of X264_CQM_FLAT.
+func FlatCQM() *CQM {
+	c := new(CQM)
+	for _, m := range c.lists() {
+		for i := range m.list {
+			m.list[i] = 16
+		}
+	}
+	return c
+}
+
+// JVTCQM returns the default matrices of the standard, X264_CQM_JVT.
+func JVTCQM() *CQM {
+	c := new(CQM)
+	unzigzag(c.Intra4Y[:], jvt4Intra, zigzag4)
+	unzigzag(c.Inter4Y[:], jvt4Inter, zigzag4)
+	unzigzag(c.Intra4C[:], jvt4Intra, zigzag4)
+	unzigzag(c.Inter4C[:], jvt4Inter, zigzag4)
+	unzigzag(c.Intra8Y[:], jvt8Intra, zigzag8)
+	unzigzag(c.Inter8Y[:], jvt8Inter, zigzag8)
+	unzigzag(c.Intra8C[:], jvt8Intra, zigzag8)
+	unzigzag(c.Inter8C[:], jvt8Inter, zigzag8)
+	return c
+}
+
+type cqmList struct {
+	name string  /* JM keyword */
+	list []uint8 /* raster order */
+	jvt  []uint8 /* zigzag default for a list starting with 0 */
+}
+
+func (c *CQM) lists() []cqmList {
+	return []cqmList{
+		{"INTRA4X4_LUMA", c.Intra4Y[:], jvt4Intra},
+		{"INTRA4X4_CHROMA", c.Intra4C[:], jvt4Intra},
+		{"INTER4X4_LUMA", c.Inter4Y[:], jvt4Inter},
+		{"INTER4X4_CHROMA", c.Inter4C[:], jvt4Inter},
+		{"INTRA8X8_LUMA", c.Intra8Y[:], jvt8Intra},
+		{"INTER8X8_LUMA", c.Inter8Y[:], jvt8Inter},
+		{"INTRA8X8_CHROMA", c.Intra8C[:], jvt8Intra},
+		{"INTER8X8_CHROMA", c.Inter8C[:], jvt8Inter},
+	}
+}
+
+// Validate checks that every coefficient is in 1..255.
+func (c *CQM) Validate() error {
+	for _, m := range c.lists() {
+		for i, v := range m.list {
+			if v == 0 {
+				return fmt.Errorf("libx264: CQM %s: coefficient %d is 0, want 1-255", m.name, i)
+			}
+		}
+	}
+	return nil
+}
+
+// ParseCQM parses a JM format CQM file like x264 --cqmfile: a keyword
+// such as INTRA4X4_LUMA followed by its coefficients in raster order, '#'
+// starting comments.  A list whose first coefficient is 0 takes the JVT
+// default and a missing list is flat.
+func ParseCQM(r io.Reader) (*CQM, error) {
+	var buf bytes.Buffer
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	text := buf.String()
+
+	c := new(CQM)
+	for _, m := range c.lists() {
+		p := strings.Index(text, m.name)
+		if p < 0 {
+			for i := range m.list {
+				m.list[i] = 16
+			}
+			continue
+		}
+		p += len(m.name)
+		if p < len(text) && (text[p] == 'U' || text[p] == 'V') {
+			p++
+		}
+		body := text[p:]
+		if next := strings.Index(body, "INT"); next >= 0 {
+			body = body[:next]
+		}
+		fields := strings.FieldsFunc(body, func(r rune) bool { return r < '0' || r > '9' })
+		if len(fields) > 0 && strings.TrimLeft(fields[0], "0") == "" {
+			scan := zigzag4
+			if len(m.list) == 64 {
+				scan = zigzag8
+			}
+			unzigzag(m.list, m.jvt, scan)
+			continue
+		}
+		if len(fields) < len(m.list) {
+			return nil, fmt.Errorf("libx264: CQM %s: %d coefficients, want %d", m.name, len(fields), len(m.list))
+		}
+		for i := range m.list {
+			v, err := strconv.Atoi(fields[i])
+			if err != nil || v < 1 || v > 255 {
+				return nil, fmt.Errorf("libx264: CQM %s: bad coefficient %q, want 1-255", m.name, fields[i])
+			}
+			m.list[i] = uint8(v)
+		}
+	}
+	return c, nil
+}
+
+// ReadCQMFile parses the JM format CQM file at path.
+func ReadCQMFile(path string) (*CQM, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseCQM(f)
+}
+
+// WriteTo writes c in JM format.
+func (c *CQM) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	for _, m := range c.lists() {
+		width := 4
+		if len(m.list) == 64 {
+			width = 8
+		}
+		fmt.Fprintf(&buf, "%s =\n", m.name)
+		for i := range m.list {
+			sep := ","
+			if i%width == width-1 {
+				sep = "\n"
+			}
+			if i == len(m.list)-1 {
+				sep = "\n\n"
+			}
+			fmt.Fprintf(&buf, "%d%s", m.list[i], sep)
+		}
+	}
+	return buf.WriteTo(w)
+}
+
+// SetCQM validates c and applies it with X264_CQM_CUSTOM.
+func (param *X264ParamT) SetCQM(c *CQM) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	param.i_cqm_preset = X264_CQM_CUSTOM
+	param.psz_cqm_file = 0
+	copyCQM(param.cqm_4iy[:], c.Intra4Y[:])
+	copyCQM(param.cqm_4py[:], c.Inter4Y[:])
+	copyCQM(param.cqm_4ic[:], c.Intra4C[:])
+	copyCQM(param.cqm_4pc[:], c.Inter4C[:])
+	copyCQM(param.cqm_8iy[:], c.Intra8Y[:])
+	copyCQM(param.cqm_8py[:], c.Inter8Y[:])
+	copyCQM(param.cqm_8ic[:], c.Intra8C[:])
+	copyCQM(param.cqm_8pc[:], c.Inter8C[:])
+	return nil
+}
+
+func copyCQM(dst []ffcommon.FUint8T, src []uint8) {
+	for i, v := range src {
+		dst[i] = ffcommon.FUint8T(v)
+	}
+}
+
+// SetCQMFile parses a JM format file and applies it like SetCQM, so
+// errors show up before the encoder is opened.
+func (param *X264ParamT) SetCQMFile(path string) error {
+	c, err := ReadCQMFile(path)
+	if err != nil {
+		return err
+	}
+	return param.SetCQM(c)
+}
+
+// SetCQMPreset selects X264_CQM_FLAT or X264_CQM_JVT.
+func (param *X264ParamT) SetCQMPreset(preset int) error {
+	if preset != X264_CQM_FLAT && preset != X264_CQM_JVT {
+		return fmt.Errorf("libx264: invalid CQM preset %d", preset)
+	}
+	param.i_cqm_preset = ffcommon.FInt(preset)
+	param.psz_cqm_file = 0
+	return nil
+}
+
+// CQM returns i_cqm_preset and the matrices in effect: flat, JVT or the
+// custom ones.
+func (param *X264ParamT) CQM() (preset int, c *CQM) {
+	switch param.i_cqm_preset {
+	case X264_CQM_FLAT:
+		return X264_CQM_FLAT, FlatCQM()
+	case X264_CQM_JVT:
+		return X264_CQM_JVT, JVTCQM()
+	}
+	c = new(CQM)
+	for _, l := range []struct {
+		dst []uint8
+		src []ffcommon.FUint8T
+	}{
+		{c.Intra4Y[:], param.cqm_4iy[:]}, {c.Inter4Y[:], param.cqm_4py[:]},
+		{c.Intra4C[:], param.cqm_4ic[:]}, {c.Inter4C[:], param.cqm_4pc[:]},
+		{c.Intra8Y[:], param.cqm_8iy[:]}, {c.Inter8Y[:], param.cqm_8py[:]},
+		{c.Intra8C[:], param.cqm_8ic[:]}, {c.Inter8C[:], param.cqm_8pc[:]},
+	} {
+		for i, v := range l.src {
+			l.dst[i] = uint8(v)
+		}
+	}
+	return int(param.i_cqm_preset), c
+}
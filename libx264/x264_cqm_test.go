@@ -0,0 +1,151 @@
+package libx264
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestZigzag(t *testing.T) {
+	want4 := []int{0, 1, 4, 8, 5, 2, 3, 6, 9, 12, 13, 10, 7, 11, 14, 15}
+	if !reflect.DeepEqual(zigzag4, want4) {
+		t.Errorf("zigzag4 %v, want %v", zigzag4, want4)
+	}
+	if zigzag8[2] != 8 || zigzag8[3] != 16 || zigzag8[63] != 63 || len(zigzag8) != 64 {
+		t.Errorf("zigzag8 %v", zigzag8)
+	}
+	/* x264_cqm_jvt4i and x264_cqm_jvt4p, which are in raster order */
+	jvt := JVTCQM()
+	if want := [16]uint8{6, 13, 20, 28, 13, 20, 28, 32, 20, 28, 32, 37, 28, 32, 37, 42}; jvt.Intra4Y != want {
+		t.Errorf("JVT intra 4x4 %v, want %v", jvt.Intra4Y, want)
+	}
+	if want := [16]uint8{10, 14, 20, 24, 14, 20, 24, 27, 20, 24, 27, 30, 24, 27, 30, 34}; jvt.Inter4Y != want {
+		t.Errorf("JVT inter 4x4 %v, want %v", jvt.Inter4Y, want)
+	}
+	if !bytes.Equal(jvt.Intra8Y[:8], []byte{6, 10, 13, 16, 18, 23, 25, 27}) {
+		t.Errorf("JVT intra 8x8 first row %v", jvt.Intra8Y[:8])
+	}
+}
+
+func TestParseCQM(t *testing.T) {
+	jvt, flat := JVTCQM(), FlatCQM()
+	seq := func(n int) string {
+		s := make([]string, n)
+		for i := range s {
+			s[i] = string(rune('0'+(i%9+1))) + "0"
+		}
+		return strings.Join(s, ", ")
+	}
+	var jvtFile bytes.Buffer
+	if _, err := jvt.WriteTo(&jvtFile); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		file  string
+		check func(t *testing.T, c *CQM)
+		ok    bool
+	}{
+		{"empty is flat", "# nothing\n", func(t *testing.T, c *CQM) {
+			if *c != *flat {
+				t.Errorf("got %v", c)
+			}
+		}, true},
+		{"round trip", jvtFile.String(), func(t *testing.T, c *CQM) {
+			if *c != *jvt {
+				t.Errorf("got %v", c)
+			}
+		}, true},
+		{"one list", "INTRA4X4_LUMA = # raster order\n" + seq(16) + "\n", func(t *testing.T, c *CQM) {
+			if c.Intra4Y[0] != 10 || c.Intra4Y[1] != 20 || c.Intra4Y[2] != 30 || c.Intra4Y[4] != 50 || c.Intra4Y[15] != 70 {
+				t.Errorf("INTRA4X4_LUMA %v", c.Intra4Y)
+			}
+			if c.Inter4Y != flat.Inter4Y || c.Intra8C != flat.Intra8C {
+				t.Errorf("missing lists not flat: %v %v", c.Inter4Y, c.Intra8C)
+			}
+		}, true},
+		{"leading zero is jvt", "INTRA8X8_LUMA = 0\nINTER4X4_CHROMA =\n0, 5, 5\n", func(t *testing.T, c *CQM) {
+			if c.Intra8Y != jvt.Intra8Y || c.Inter4C != jvt.Inter4C {
+				t.Errorf("got %v %v", c.Intra8Y, c.Inter4C)
+			}
+			/* missing chroma lists are flat like the luma ones */
+			if c.Intra8C != flat.Intra8C || c.Inter8C != flat.Inter8C {
+				t.Errorf("8x8 chroma %v %v", c.Intra8C, c.Inter8C)
+			}
+		}, true},
+		{"chroma 8x8 given", "INTER8X8_LUMA = 0\nINTER8X8_CHROMA = " + seq(64), func(t *testing.T, c *CQM) {
+			if c.Inter8Y != jvt.Inter8Y || c.Inter8C[0] != 10 || c.Inter8C[63] != 10 {
+				t.Errorf("got %v %v", c.Inter8Y, c.Inter8C)
+			}
+		}, true},
+		{"chroma U suffix", "INTRA4X4_CHROMAU = " + seq(16), func(t *testing.T, c *CQM) {
+			if c.Intra4C[0] != 10 {
+				t.Errorf("INTRA4X4_CHROMA %v", c.Intra4C)
+			}
+		}, true},
+		{"raster jvt", "INTRA4X4_LUMA = 6,13,20,28\n13,20,28,32\n20,28,32,37\n28,32,37,42\n", func(t *testing.T, c *CQM) {
+			if c.Intra4Y != jvt.Intra4Y {
+				t.Errorf("INTRA4X4_LUMA %v, want %v", c.Intra4Y, jvt.Intra4Y)
+			}
+		}, true},
+		{"too few", "INTER4X4_LUMA = 16, 16, 16", nil, false},
+		{"zero inside", "INTER4X4_LUMA = 16, 0" + strings.Repeat(", 16", 14), nil, false},
+		{"too large", "INTER4X4_LUMA = 256" + strings.Repeat(", 16", 15), nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseCQM(strings.NewReader(tt.file))
+			if (err == nil) != tt.ok {
+				t.Fatalf("ParseCQM: %v", err)
+			}
+			if err != nil {
+				return
+			}
+			if err := c.Validate(); err != nil {
+				t.Error(err)
+			}
+			tt.check(t, c)
+		})
+	}
+}
+
+func TestWriteCQM(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := JVTCQM().WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"INTRA4X4_LUMA =\n6,13,20,28\n13,20,28,32\n20,28,32,37\n28,32,37,42\n\n",
+		"INTRA8X8_LUMA =\n6,10,13,16,18,23,25,27\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("output lacks %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestSetCQM(t *testing.T) {
+	param := new(X264ParamT)
+	c := JVTCQM()
+	c.Inter8C[5] = 99
+	if err := param.SetCQM(c); err != nil {
+		t.Fatal(err)
+	}
+	if preset, got := param.CQM(); preset != X264_CQM_CUSTOM || *got != *c {
+		t.Errorf("CQM() = %d %v", preset, got)
+	}
+	c.Intra4Y[3] = 0
+	if err := param.SetCQM(c); err == nil {
+		t.Error("SetCQM accepted a zero coefficient")
+	}
+	if err := param.SetCQMPreset(X264_CQM_JVT); err != nil {
+		t.Fatal(err)
+	}
+	if preset, got := param.CQM(); preset != X264_CQM_JVT || *got != *JVTCQM() {
+		t.Errorf("CQM() = %d %v", preset, got)
+	}
+	if err := param.SetCQMPreset(X264_CQM_CUSTOM); err == nil {
+		t.Error("SetCQMPreset accepted X264_CQM_CUSTOM")
+	}
+}
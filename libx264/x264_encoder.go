@@ -0,0 +1,170 @@
+package libx264
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/moonfdd/ffmpeg-go/ffcommon"
+)
+
+var ErrEncoderOpen = errors.New("libx264: x264_encoder_open failed")
+var ErrEncoderClosed = errors.New("libx264: encoder closed")
+
+// Encoder drives an x264 encoder handle and forwards its output to a Sink.
+type Encoder struct {
+	h      *X264T
+	sink   Sink
+	picOut X264PictureT
+	closed bool
+	keep   []interface{} /* Go memory referenced by the param */
+
+	mbCount int
+	/* per-frame Go memory x264 uses until the frame is output, keyed by
+	 * the sequence number carried in the picture's opaque field */
+	pending map[uintptr]*frameMem
+	seq     uintptr
+}
+
+type frameMem struct {
+	mbInfo []byte
+	sei    []X264SeiPayloadT
+}
+
+// NewEncoder opens an encoder with param and writes the stream headers to
+// sink.  The encoder takes over the Go memory param references (strings,
+// zones, ...) and drops it on Close, so param must not open another
+// encoder; open each one from a Copy instead.
+func NewEncoder(param *X264ParamT, sink Sink) (*Encoder, error) {
+	h := param.X264EncoderOpen164()
+	if h == nil {
+		return nil, ErrEncoderOpen
+	}
+	e := &Encoder{h: h, sink: sink, keep: param.take(), pending: make(map[uintptr]*frameMem)}
+	q := NewQuantOffsets(int(param.IWidth), int(param.IHeight), param.b_interlaced != 0)
+	e.mbCount = q.MbWidth * q.MbHeight
+	e.picOut.X264PictureInit()
+
+	var pNals *X264NalT
+	var iNal ffcommon.FInt
+	if ret := h.X264EncoderHeaders(&pNals, &iNal); ret < 0 {
+		h.X264EncoderClose()
+		return nil, fmt.Errorf("libx264: x264_encoder_headers failed (%d)", ret)
+	}
+	if err := sink.WriteHeaders(X264NalSlice(pNals, iNal)); err != nil {
+		h.X264EncoderClose()
+		return nil, err
+	}
+	return e, nil
+}
+
+// Handle returns the underlying x264 handle.
+func (e *Encoder) Handle() *X264T {
+	return e.h
+}
+
+// Encode encodes one picture and writes any frame leaving the encoder to
+// the sink.  A nil pic drains one delayed frame.
+func (e *Encoder) Encode(pic *X264PictureT) error {
+	if e.closed {
+		return ErrEncoderClosed
+	}
+	if pic != nil {
+		e.track(pic)
+	}
+	var pNals *X264NalT
+	var iNal ffcommon.FInt
+	ret := e.h.X264EncoderEncode(&pNals, &iNal, pic, &e.picOut)
+	if pic != nil {
+		pic.prop.mb_info = nil
+		pic.extra_sei = X264SeiT{}
+	}
+	if ret < 0 {
+		return fmt.Errorf("libx264: x264_encoder_encode failed (%d)", ret)
+	}
+	if iNal == 0 {
+		return nil
+	}
+	f := &Frame{
+		Nals:     X264NalSlice(pNals, iNal),
+		Pts:      e.picOut.IPts,
+		Dts:      e.picOut.i_dts,
+		Keyframe: e.picOut.b_keyframe != 0,
+		Type:     int(e.picOut.i_type),
+		Quality:  e.picOut.Quality(),
+		HRD:      e.picOut.HRDTiming(),
+	}
+	if m := e.pending[e.picOut.opaque]; m != nil {
+		delete(e.pending, e.picOut.opaque)
+		f.MbInfo = m.mbInfo
+	}
+	return e.sink.WriteFrame(f)
+}
+
+// track keeps the Go memory attached to pic reachable until its frame is
+// output.  Pictures are told apart by a sequence number in the opaque
+// field, which x264 copies to the output picture, as timestamps need not
+// be unique.
+func (e *Encoder) track(pic *X264PictureT) {
+	pic.opaque = 0
+	if pic.prop.mb_info == nil && pic.extra_sei.Payloads == nil {
+		return
+	}
+	e.seq++
+	pic.opaque = e.seq
+	e.pending[e.seq] = &frameMem{
+		mbInfo: ffcommon.ByteSliceFromByteP(pic.prop.mb_info, e.mbCount),
+		sei:    seiPayloads(&pic.extra_sei),
+	}
+}
+
+// IntraRefresh starts an intra refresh with the next P-frame, or right after
+// the one in progress (x264_encoder_intra_refresh).  The encoder must have
+// been opened with b_intra_refresh.
+func (e *Encoder) IntraRefresh() error {
+	if e.closed {
+		return ErrEncoderClosed
+	}
+	e.h.X264EncoderIntraRefresh()
+	return nil
+}
+
+// InvalidateReference makes x264 stop referencing the frame with pts and
+// every frame depending on it (x264_encoder_invalidate_reference); a
+// keyframe follows if nothing is left to reference.  It is incompatible
+// with B-frames and intra refresh and must not be called during Encode.
+func (e *Encoder) InvalidateReference(pts int64) error {
+	if e.closed {
+		return ErrEncoderClosed
+	}
+	if ret := e.h.X264EncoderInvalidateReference(pts); ret < 0 {
+		return fmt.Errorf("libx264: x264_encoder_invalidate_reference(%d) failed (%d)", pts, ret)
+	}
+	return nil
+}
+
+// Flush drains all delayed frames.
+func (e *Encoder) Flush() error {
+	for !e.closed && e.h.X264EncoderDelayedFrames() > 0 {
+		if err := e.Encode(nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close flushes the encoder, closes the handle and the sink.
+func (e *Encoder) Close() error {
+	if e.closed {
+		return nil
+	}
+	err := e.Flush()
+	e.closed = true
+	e.h.X264EncoderClose()
+	e.h = nil
+	e.keep = nil
+	e.pending = nil
+	if cerr := e.sink.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
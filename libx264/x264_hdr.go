@@ -0,0 +1,206 @@
+package libx264
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/moonfdd/ffmpeg-go/ffcommon"
+)
+
+// HDR transfer characteristics.
+const (
+	HDRTransferPQ  = TransferSMPTE2084
+	HDRTransferHLG = TransferARIBSTDB67
+)
+
+// Chromaticity is a CIE 1931 xy coordinate.
+type Chromaticity struct {
+	X, Y float64
+}
+
+// MasteringDisplay describes the mastering display colour volume of SMPTE
+// ST 2086 in natural units.
+type MasteringDisplay struct {
+	Red, Green, Blue Chromaticity
+	WhitePoint       Chromaticity
+	MaxLuminance     float64 /* cd/m^2 */
+	MinLuminance     float64 /* cd/m^2 */
+}
+
+// Common mastering displays: a DCI-P3 D65 and a BT.2020 display of 1000
+// cd/m^2.
+var (
+	MasteringDisplayP3D65 = MasteringDisplay{
+		Red: Chromaticity{0.680, 0.320}, Green: Chromaticity{0.265, 0.690}, Blue: Chromaticity{0.150, 0.060},
+		WhitePoint: Chromaticity{0.3127, 0.3290}, MaxLuminance: 1000, MinLuminance: 0.0001,
+	}
+	MasteringDisplayBT2020 = MasteringDisplay{
+		Red: Chromaticity{0.708, 0.292}, Green: Chromaticity{0.170, 0.797}, Blue: Chromaticity{0.131, 0.046},
+		WhitePoint: Chromaticity{0.3127, 0.3290}, MaxLuminance: 1000, MinLuminance: 0.0001,
+	}
+)
+
+// ContentLightLevel holds MaxCLL and MaxFALL in cd/m^2.
+type ContentLightLevel struct {
+	MaxCLL  int
+	MaxFALL int
+}
+
+// HDR is an HDR10 or HLG configuration.
+type HDR struct {
+	Transfer TransferCharacteristics /* HDRTransferPQ or HDRTransferHLG */
+
+	// For HLG, signal bt2020-10 in the VUI and arib-std-b67 in the
+	// alternative transfer characteristics SEI, so SDR decoders still
+	// display the stream.
+	Compatible bool
+
+	MasteringDisplay  *MasteringDisplay  /* nil for no SEI */
+	ContentLightLevel *ContentLightLevel /* nil for no SEI */
+}
+
+var ErrHDRBitDepth = errors.New("libx264: HDR needs a bit depth of at least 10")
+
+// BitDepth returns i_bitdepth.
+func (param *X264ParamT) BitDepth() int {
+	return int(param.i_bitdepth)
+}
+
+// SetBitDepth sets i_bitdepth.  The library must be built for it.
+func (param *X264ParamT) SetBitDepth(depth int) {
+	param.i_bitdepth = ffcommon.FInt(depth)
+}
+
+// Validate checks the ranges of the coordinates and luminances.
+func (m *MasteringDisplay) Validate() error {
+	for _, c := range []Chromaticity{m.Red, m.Green, m.Blue, m.WhitePoint} {
+		if !(c.X >= 0 && c.X <= 1 && c.Y >= 0 && c.Y <= 1) {
+			return fmt.Errorf("libx264: mastering display: chromaticity (%g, %g) out of range", c.X, c.Y)
+		}
+	}
+	if !(m.MinLuminance >= 0 && m.MaxLuminance > m.MinLuminance && m.MaxLuminance <= math.MaxInt32/10000) {
+		return fmt.Errorf("libx264: mastering display: invalid luminance range %g-%g cd/m^2", m.MinLuminance, m.MaxLuminance)
+	}
+	return nil
+}
+
+// Validate checks that MaxFALL does not exceed MaxCLL.
+func (l *ContentLightLevel) Validate() error {
+	if l.MaxCLL < 0 || l.MaxFALL < 0 || l.MaxCLL > 65535 || l.MaxFALL > l.MaxCLL {
+		return fmt.Errorf("libx264: content light level: invalid MaxCLL %d / MaxFALL %d", l.MaxCLL, l.MaxFALL)
+	}
+	return nil
+}
+
+/* 0.00002 and 0.0001 cd/m^2 units of the SEI */
+func chroma(v float64) ffcommon.FInt            { return ffcommon.FInt(math.Round(v * 50000)) }
+func luminance(v float64) ffcommon.FInt64T      { return ffcommon.FInt64T(math.Round(v * 10000)) }
+func chromaValue(v ffcommon.FInt) float64       { return float64(v) / 50000 }
+func luminanceValue(v ffcommon.FInt64T) float64 { return float64(v) / 10000 }
+
+// SetHDR configures the colour VUI (BT.2020 primaries and matrix, PQ or HLG
+// transfer) and the mastering display and content light level SEIs.  A
+// BT.2020 constant luminance or ICtCp matrix already set is kept.  The bit
+// depth must be set first.
+func (param *X264ParamT) SetHDR(h HDR) error {
+	if h.Transfer != HDRTransferPQ && h.Transfer != HDRTransferHLG {
+		return fmt.Errorf("libx264: invalid HDR transfer %v", h.Transfer)
+	}
+	if h.MasteringDisplay != nil {
+		if err := h.MasteringDisplay.Validate(); err != nil {
+			return err
+		}
+	}
+	if h.ContentLightLevel != nil {
+		if err := h.ContentLightLevel.Validate(); err != nil {
+			return err
+		}
+	}
+	if param.i_bitdepth < 10 {
+		return ErrHDRBitDepth
+	}
+
+	vui := &param.vui
+	vui.i_colorprim = ffcommon.FInt(ColorPrimariesBT2020)
+	if m := MatrixCoefficients(vui.i_colmatrix); m != MatrixBT2020C && m != MatrixICtCp {
+		vui.i_colmatrix = ffcommon.FInt(MatrixBT2020NC)
+	}
+	vui.i_transfer = ffcommon.FInt(h.Transfer)
+	param.i_alternative_transfer = ffcommon.FInt(TransferUnspecified)
+	if h.Transfer == HDRTransferHLG && h.Compatible {
+		vui.i_transfer = ffcommon.FInt(TransferBT2020_10)
+		param.i_alternative_transfer = ffcommon.FInt(TransferARIBSTDB67)
+	}
+
+	md := &param.mastering_display
+	md.b_mastering_display = 0
+	if m := h.MasteringDisplay; m != nil {
+		md.b_mastering_display = 1
+		md.i_green_x, md.i_green_y = chroma(m.Green.X), chroma(m.Green.Y)
+		md.i_blue_x, md.i_blue_y = chroma(m.Blue.X), chroma(m.Blue.Y)
+		md.i_red_x, md.i_red_y = chroma(m.Red.X), chroma(m.Red.Y)
+		md.i_white_x, md.i_white_y = chroma(m.WhitePoint.X), chroma(m.WhitePoint.Y)
+		md.i_display_max, md.i_display_min = luminance(m.MaxLuminance), luminance(m.MinLuminance)
+	}
+
+	cll := &param.content_light_level
+	cll.b_cll, cll.i_max_cll, cll.i_max_fall = 0, 0, 0
+	if l := h.ContentLightLevel; l != nil {
+		cll.b_cll = 1
+		cll.i_max_cll, cll.i_max_fall = ffcommon.FInt(l.MaxCLL), ffcommon.FInt(l.MaxFALL)
+	}
+	return nil
+}
+
+// HDR returns the HDR configuration of param, or false if neither the
+// transfer nor the alternative transfer is PQ or HLG.
+func (param *X264ParamT) HDR() (HDR, bool) {
+	var h HDR
+	switch t := TransferCharacteristics(param.vui.i_transfer); {
+	case t == HDRTransferPQ || t == HDRTransferHLG:
+		h.Transfer = t
+	case TransferCharacteristics(param.i_alternative_transfer) == HDRTransferHLG:
+		h.Transfer, h.Compatible = HDRTransferHLG, true
+	default:
+		return h, false
+	}
+	if md := &param.mastering_display; md.b_mastering_display != 0 {
+		h.MasteringDisplay = &MasteringDisplay{
+			Red:          Chromaticity{chromaValue(md.i_red_x), chromaValue(md.i_red_y)},
+			Green:        Chromaticity{chromaValue(md.i_green_x), chromaValue(md.i_green_y)},
+			Blue:         Chromaticity{chromaValue(md.i_blue_x), chromaValue(md.i_blue_y)},
+			WhitePoint:   Chromaticity{chromaValue(md.i_white_x), chromaValue(md.i_white_y)},
+			MaxLuminance: luminanceValue(md.i_display_max),
+			MinLuminance: luminanceValue(md.i_display_min),
+		}
+	}
+	if cll := &param.content_light_level; cll.b_cll != 0 {
+		h.ContentLightLevel = &ContentLightLevel{MaxCLL: int(cll.i_max_cll), MaxFALL: int(cll.i_max_fall)}
+	}
+	return h, true
+}
+
+// ValidateHDR checks that a param signalling HDR (PQ or HLG transfer,
+// mastering display or content light level SEI) has a bit depth of at
+// least 10 and BT.2020 colour VUI.
+func (param *X264ParamT) ValidateHDR() error {
+	_, hdr := param.HDR()
+	if !hdr && param.mastering_display.b_mastering_display == 0 && param.content_light_level.b_cll == 0 {
+		return nil
+	}
+	if param.i_bitdepth < 10 {
+		return ErrHDRBitDepth
+	}
+	vui := param.VUI()
+	if vui.ColorPrimaries != ColorPrimariesBT2020 {
+		return fmt.Errorf("libx264: HDR needs bt2020 primaries, have %v", vui.ColorPrimaries)
+	}
+	if m := vui.Matrix; m != MatrixBT2020NC && m != MatrixBT2020C && m != MatrixICtCp {
+		return fmt.Errorf("libx264: HDR needs a bt2020nc, bt2020c or ICtCp matrix, have %v", m)
+	}
+	if !hdr {
+		return fmt.Errorf("libx264: HDR metadata with %v transfer", vui.Transfer)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package libx264
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/moonfdd/ffmpeg-go/ffcommon"
+)
+
+func TestSetHDR(t *testing.T) {
+	cll := &ContentLightLevel{MaxCLL: 1000, MaxFALL: 400}
+	tests := []struct {
+		name     string
+		depth    int
+		matrix   MatrixCoefficients /* set before SetHDR */
+		h        HDR
+		ok       bool
+		transfer TransferCharacteristics
+		alt      TransferCharacteristics
+		wantM    MatrixCoefficients
+	}{
+		{"hdr10", 10, MatrixBT709, HDR{Transfer: HDRTransferPQ, MasteringDisplay: &MasteringDisplayP3D65, ContentLightLevel: cll},
+			true, TransferSMPTE2084, TransferUnspecified, MatrixBT2020NC},
+		{"hlg", 10, MatrixBT709, HDR{Transfer: HDRTransferHLG},
+			true, TransferARIBSTDB67, TransferUnspecified, MatrixBT2020NC},
+		{"hlg compatible", 12, MatrixBT709, HDR{Transfer: HDRTransferHLG, Compatible: true},
+			true, TransferBT2020_10, TransferARIBSTDB67, MatrixBT2020NC},
+		{"constant luminance kept", 10, MatrixBT2020C, HDR{Transfer: HDRTransferPQ},
+			true, TransferSMPTE2084, TransferUnspecified, MatrixBT2020C},
+		{"8-bit", 8, MatrixBT709, HDR{Transfer: HDRTransferPQ}, false, 0, 0, 0},
+		{"sdr transfer", 10, MatrixBT709, HDR{Transfer: TransferBT709}, false, 0, 0, 0},
+		{"bad mastering display", 10, MatrixBT709, HDR{Transfer: HDRTransferPQ, MasteringDisplay: &MasteringDisplay{}}, false, 0, 0, 0},
+		{"bad light level", 10, MatrixBT709, HDR{Transfer: HDRTransferPQ, ContentLightLevel: &ContentLightLevel{MaxCLL: 100, MaxFALL: 200}}, false, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			param := new(X264ParamT)
+			param.SetBitDepth(tt.depth)
+			param.vui.i_colmatrix = ffcommon.FInt(tt.matrix)
+			err := param.SetHDR(tt.h)
+			if (err == nil) != tt.ok {
+				t.Fatalf("SetHDR: %v", err)
+			}
+			if !tt.ok {
+				if _, hdr := param.HDR(); hdr || param.ValidateHDR() != nil {
+					t.Error("failed SetHDR changed param")
+				}
+				return
+			}
+			v := param.VUI()
+			if v.ColorPrimaries != ColorPrimariesBT2020 || v.Transfer != tt.transfer || v.Matrix != tt.wantM ||
+				TransferCharacteristics(param.i_alternative_transfer) != tt.alt {
+				t.Errorf("primaries %v transfer %v/%v matrix %v", v.ColorPrimaries, v.Transfer, param.i_alternative_transfer, v.Matrix)
+			}
+			if got, hdr := param.HDR(); !hdr || !reflect.DeepEqual(got, tt.h) {
+				t.Errorf("HDR() = %+v %v, want %+v", got, hdr, tt.h)
+			}
+			if err := param.ValidateHDR(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestHDRUnits(t *testing.T) {
+	param := new(X264ParamT)
+	param.SetBitDepth(10)
+	if err := param.SetHDR(HDR{Transfer: HDRTransferPQ, MasteringDisplay: &MasteringDisplayBT2020}); err != nil {
+		t.Fatal(err)
+	}
+	/* G(8500,39850) B(6550,2300) R(35400,14600) WP(15635,16450) L(10000000,1) */
+	md := param.mastering_display
+	got := []int64{
+		int64(md.i_green_x), int64(md.i_green_y), int64(md.i_blue_x), int64(md.i_blue_y),
+		int64(md.i_red_x), int64(md.i_red_y), int64(md.i_white_x), int64(md.i_white_y),
+		int64(md.i_display_max), int64(md.i_display_min),
+	}
+	want := []int64{8500, 39850, 6550, 2300, 35400, 14600, 15635, 16450, 10000000, 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SEI values %v, want %v", got, want)
+	}
+}
+
+func TestHDRValidate(t *testing.T) {
+	md := func(f func(m *MasteringDisplay)) *MasteringDisplay {
+		m := MasteringDisplayP3D65
+		f(&m)
+		return &m
+	}
+	mdTests := []struct {
+		name string
+		m    *MasteringDisplay
+		ok   bool
+	}{
+		{"p3", &MasteringDisplayP3D65, true},
+		{"chromaticity above 1", md(func(m *MasteringDisplay) { m.Red.X = 1.2 }), false},
+		{"negative chromaticity", md(func(m *MasteringDisplay) { m.WhitePoint.Y = -0.1 }), false},
+		{"nan chromaticity", md(func(m *MasteringDisplay) { m.Blue.X = math.NaN() }), false},
+		{"min above max", md(func(m *MasteringDisplay) { m.MinLuminance = 2000 }), false},
+		{"max too large", md(func(m *MasteringDisplay) { m.MaxLuminance = 300000 }), false},
+		{"negative min", md(func(m *MasteringDisplay) { m.MinLuminance = -1 }), false},
+	}
+	for _, tt := range mdTests {
+		if err := tt.m.Validate(); (err == nil) != tt.ok {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+	cllTests := []struct {
+		l  ContentLightLevel
+		ok bool
+	}{
+		{ContentLightLevel{0, 0}, true},
+		{ContentLightLevel{65535, 65535}, true},
+		{ContentLightLevel{65536, 0}, false},
+		{ContentLightLevel{100, 101}, false},
+		{ContentLightLevel{-1, 0}, false},
+	}
+	for _, tt := range cllTests {
+		if err := tt.l.Validate(); (err == nil) != tt.ok {
+			t.Errorf("%+v: %v", tt.l, err)
+		}
+	}
+}
+
+func TestValidateHDR(t *testing.T) {
+	hdr10 := func() *X264ParamT {
+		param := new(X264ParamT)
+		param.SetBitDepth(10)
+		if err := param.SetHDR(HDR{Transfer: HDRTransferPQ, ContentLightLevel: &ContentLightLevel{1000, 400}}); err != nil {
+			t.Fatal(err)
+		}
+		return param
+	}
+	tests := []struct {
+		name string
+		edit func(param *X264ParamT)
+		ok   bool
+	}{
+		{"sdr", func(param *X264ParamT) { *param = X264ParamT{} }, true},
+		{"hdr10", func(param *X264ParamT) {}, true},
+		{"8-bit", func(param *X264ParamT) { param.SetBitDepth(8) }, false},
+		{"bt709 primaries", func(param *X264ParamT) { param.vui.i_colorprim = ffcommon.FInt(ColorPrimariesBT709) }, false},
+		{"bt709 matrix", func(param *X264ParamT) { param.vui.i_colmatrix = ffcommon.FInt(MatrixBT709) }, false},
+		{"ictcp matrix", func(param *X264ParamT) { param.vui.i_colmatrix = ffcommon.FInt(MatrixICtCp) }, true},
+		{"metadata with sdr transfer", func(param *X264ParamT) { param.vui.i_transfer = ffcommon.FInt(TransferBT709) }, false},
+	}
+	for _, tt := range tests {
+		param := hdr10()
+		tt.edit(param)
+		if err := param.ValidateHDR(); (err == nil) != tt.ok {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package libx264
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/moonfdd/ffmpeg-go/ffcommon"
+)
+
+// NalHRD returns i_nal_hrd (X264_NAL_HRD_*).
+func (param *X264ParamT) NalHRD() int {
+	return int(param.i_nal_hrd)
+}
+
+// SetNalHRD sets i_nal_hrd, making x264 write buffering period and picture
+// timing SEIs and return the HRD timing of every output picture.  NAL HRD
+// needs VBV; X264_NAL_HRD_CBR also pads the stream with filler data.
+func (param *X264ParamT) SetNalHRD(mode int) error {
+	if mode < X264_NAL_HRD_NONE || mode > X264_NAL_HRD_CBR {
+		return fmt.Errorf("libx264: invalid NAL HRD mode %d", mode)
+	}
+	if mode != X264_NAL_HRD_NONE && !param.vbvEnabled() {
+		return fmt.Errorf("libx264: NAL HRD %s needs VBV", X264NalHrdNames[mode])
+	}
+	param.i_nal_hrd = ffcommon.FInt(mode)
+	return nil
+}
+
+// HRDTiming is the HRD timing x264 computed for an output picture, in
+// seconds from the start of the stream.
+type HRDTiming struct {
+	CpbInitialArrival float64
+	CpbFinalArrival   float64
+	CpbRemoval        float64
+	DpbOutput         float64
+}
+
+// HRDTiming returns the HRD timing of an output picture, zero unless
+// i_nal_hrd is set.
+func (pic *X264PictureT) HRDTiming() HRDTiming {
+	return HRDTiming{
+		CpbInitialArrival: float64(pic.hrd_timing.cpb_initial_arrival_time),
+		CpbFinalArrival:   float64(pic.hrd_timing.cpb_final_arrival_time),
+		CpbRemoval:        float64(pic.hrd_timing.cpb_removal_time),
+		DpbOutput:         float64(pic.hrd_timing.dpb_output_time),
+	}
+}
+
+// HRDFrame is what the HRD checker records of a frame.
+type HRDFrame struct {
+	Pts, Dts int64
+	Bits     int64
+	Timing   HRDTiming /* as reported by x264 */
+
+	/* simulated */
+	InitialArrival float64
+	FinalArrival   float64
+	Removal        float64
+	Fullness       int64 /* CPB bits just before removal */
+}
+
+// HRDEvent is a CPB underflow (the frame has not fully arrived when it is
+// removed) or overflow (the buffer holds more than its size).
+type HRDEvent struct {
+	Frame    int /* in decoding order */
+	Pts      int64
+	Time     float64
+	Overflow bool
+	Fullness int64
+}
+
+func (ev HRDEvent) String() string {
+	kind := "underflow"
+	if ev.Overflow {
+		kind = "overflow"
+	}
+	return fmt.Sprintf("frame %d (pts %d): CPB %s at %.6fs, fullness %d bits", ev.Frame, ev.Pts, kind, ev.Time, ev.Fullness)
+}
+
+// HRDChecker simulates the coded picture buffer of Annex C for a stream:
+// bits arrive at the VBV max rate, continuously for CBR and for VBR not
+// earlier than the initial removal delay before the removal time, and
+// every frame is removed at its removal time.  Removal times are those
+// x264 reports with NAL HRD, otherwise derived from the DTS.
+type HRDChecker struct {
+	Bitrate  int64 /* bits/s */
+	CPBSize  int64 /* bits */
+	CBR      bool
+	InitFill float64 /* initial CPB fullness in bits before the first removal */
+	Num, Den int64   /* timebase of the DTS */
+
+	Frames []HRDFrame
+}
+
+// NewHRDChecker returns a checker for an encoder opened with param.  Like
+// x264, a CFR encode without pulldown ignores the timebase and uses the
+// frame duration.
+func NewHRDChecker(param *X264ParamT) (*HRDChecker, error) {
+	maxrate, bufsize := param.VBV()
+	if maxrate <= 0 || bufsize <= 0 {
+		return nil, errors.New("libx264: HRD checking needs VBV")
+	}
+	num, den := param.Timebase()
+	if num == 0 || den == 0 || !(param.VFR() || param.b_pulldown != 0) {
+		den, num = param.FPS()
+	}
+	if num == 0 || den == 0 {
+		return nil, fmt.Errorf("libx264: invalid timebase %d/%d", num, den)
+	}
+	c := &HRDChecker{
+		Bitrate: int64(maxrate) * 1000,
+		CPBSize: int64(bufsize) * 1000,
+		CBR:     param.i_nal_hrd == X264_NAL_HRD_CBR || param.rc.b_filler != 0,
+		Num:     int64(num),
+		Den:     int64(den),
+	}
+	init := float64(param.rc.f_vbv_buffer_init)
+	if init <= 1 {
+		c.InitFill = init * float64(c.CPBSize)
+	} else {
+		c.InitFill = init * 1000
+	}
+	if c.InitFill > float64(c.CPBSize) {
+		c.InitFill = float64(c.CPBSize)
+	}
+	return c, nil
+}
+
+// Add records an output frame.
+func (c *HRDChecker) Add(f *Frame) {
+	var bytes int64
+	for i := range f.Nals {
+		bytes += int64(f.Nals[i].IPayload)
+	}
+	c.Frames = append(c.Frames, HRDFrame{Pts: f.Pts, Dts: f.Dts, Bits: bytes * 8, Timing: f.HRD})
+}
+
+/* removal times in 1/90000 s are the precision of the HRD SEIs */
+const hrdEpsilon = 1.0 / 90000
+
+// Check simulates the CPB over the recorded frames and returns the
+// underflows and overflows.
+func (c *HRDChecker) Check() []HRDEvent {
+	if len(c.Frames) == 0 {
+		return nil
+	}
+	R := float64(c.Bitrate)
+	initDelay := c.InitFill / R
+	useHRD := c.Frames[0].Timing.CpbRemoval > 0
+	if useHRD {
+		initDelay = c.Frames[0].Timing.CpbRemoval
+	}
+	dts0 := c.Frames[0].Dts
+	prevFinal := 0.0
+	for i := range c.Frames {
+		f := &c.Frames[i]
+		if useHRD {
+			f.Removal = f.Timing.CpbRemoval
+		} else {
+			f.Removal = initDelay + float64((f.Dts-dts0)*c.Num)/float64(c.Den)
+		}
+		f.InitialArrival = prevFinal
+		if !c.CBR && i > 0 && f.Removal-initDelay > prevFinal {
+			f.InitialArrival = f.Removal - initDelay
+		}
+		f.FinalArrival = f.InitialArrival + float64(f.Bits)/R
+		prevFinal = f.FinalArrival
+	}
+
+	var events []HRDEvent
+	arrivedFrames, removed := 0, int64(0)
+	var arrivedBits int64
+	for i := range c.Frames {
+		f := &c.Frames[i]
+		t := f.Removal
+		for arrivedFrames < len(c.Frames) && c.Frames[arrivedFrames].FinalArrival <= t+hrdEpsilon {
+			arrivedBits += c.Frames[arrivedFrames].Bits
+			arrivedFrames++
+		}
+		partial := int64(0)
+		if arrivedFrames < len(c.Frames) {
+			if g := &c.Frames[arrivedFrames]; g.InitialArrival < t {
+				partial = int64((t - g.InitialArrival) * R)
+			}
+		}
+		f.Fullness = arrivedBits + partial - removed
+		if f.FinalArrival > t+hrdEpsilon {
+			events = append(events, HRDEvent{Frame: i, Pts: f.Pts, Time: t, Fullness: f.Fullness})
+		}
+		if f.Fullness > c.CPBSize+int64(hrdEpsilon*R) {
+			events = append(events, HRDEvent{Frame: i, Pts: f.Pts, Time: t, Overflow: true, Fullness: f.Fullness})
+		}
+		removed += f.Bits
+	}
+	return events
+}
+
+// Err returns an error describing the first CPB violation, or nil.
+func (c *HRDChecker) Err() error {
+	events := c.Check()
+	if len(events) == 0 {
+		return nil
+	}
+	return fmt.Errorf("libx264: HRD: %d CPB violations, first: %v", len(events), events[0])
+}
+
+// Report writes a summary of the simulation and every violation.
+func (c *HRDChecker) Report(w io.Writer) error {
+	events := c.Check()
+	mode := "VBR"
+	if c.CBR {
+		mode = "CBR"
+	}
+	var min, max int64 = c.CPBSize, 0
+	for i := range c.Frames {
+		if f := c.Frames[i].Fullness; f < min {
+			min = f
+		}
+		if f := c.Frames[i].Fullness; f > max {
+			max = f
+		}
+	}
+	if _, err := fmt.Fprintf(w, "HRD %s %d bit/s, CPB %d bits: %d frames, fullness %d-%d bits, %d violations\n",
+		mode, c.Bitrate, c.CPBSize, len(c.Frames), min, max, len(events)); err != nil {
+		return err
+	}
+	for _, ev := range events {
+		if _, err := fmt.Fprintln(w, ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type hrdSink struct {
+	Sink
+	c *HRDChecker
+}
+
+// HRDSink returns sink adding every frame to checker.
+func HRDSink(sink Sink, checker *HRDChecker) Sink {
+	return hrdSink{sink, checker}
+}
+
+func (k hrdSink) WriteFrame(f *Frame) error {
+	k.c.Add(f)
+	return k.Sink.WriteFrame(f)
+}
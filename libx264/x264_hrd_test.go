@@ -0,0 +1,141 @@
+package libx264
+
+import (
+	"testing"
+
+	"github.com/moonfdd/ffmpeg-go/ffcommon"
+)
+
+func TestNewHRDChecker(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(param *X264ParamT) error
+		ok       bool
+		num, den int64
+		initFill float64
+		cbr      bool
+	}{
+		{"cfr ignores a stale timebase", func(param *X264ParamT) error {
+			param.i_timebase_num, param.i_timebase_den = 1, 1000
+			return nil
+		}, true, 1, 25, 750000, false},
+		{"cfr without timebase", nil, true, 1, 25, 750000, false},
+		{"vfr", func(param *X264ParamT) error {
+			return param.SetVFR(1, 90000)
+		}, true, 1, 90000, 750000, false},
+		{"pulldown", func(param *X264ParamT) error {
+			p, err := ParsePulldown("32")
+			if err != nil {
+				return err
+			}
+			return param.SetPulldown(p, 24000, 1001)
+		}, true, 1001, 30000, 750000, false},
+		{"cbr with init in kbit", func(param *X264ParamT) error {
+			param.rc.f_vbv_buffer_init = 500
+			return param.SetNalHRD(X264_NAL_HRD_CBR)
+		}, true, 1, 25, 500000, true},
+		{"init above the buffer", func(param *X264ParamT) error {
+			param.rc.f_vbv_buffer_init = 5000
+			return nil
+		}, true, 1, 25, 1000000, false},
+		{"no vbv", func(param *X264ParamT) error {
+			param.SetVBV(0, 0)
+			return nil
+		}, false, 0, 0, 0, false},
+		{"no frame rate", func(param *X264ParamT) error {
+			param.i_fps_num = 0
+			return nil
+		}, false, 0, 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			param := new(X264ParamT)
+			param.SetBitrate(1000)
+			param.SetVBV(1000, 1000)
+			param.rc.f_vbv_buffer_init = 0.75
+			if err := param.SetFPS(25, 1); err != nil {
+				t.Fatal(err)
+			}
+			if tt.setup != nil {
+				if err := tt.setup(param); err != nil {
+					t.Fatal(err)
+				}
+			}
+			c, err := NewHRDChecker(param)
+			if (err == nil) != tt.ok {
+				t.Fatalf("NewHRDChecker: %v", err)
+			}
+			if err != nil {
+				return
+			}
+			if c.Bitrate != 1000000 || c.CPBSize != 1000000 || c.CBR != tt.cbr {
+				t.Errorf("bitrate %d CPB %d CBR %v", c.Bitrate, c.CPBSize, c.CBR)
+			}
+			if c.Num != tt.num || c.Den != tt.den || c.InitFill != tt.initFill {
+				t.Errorf("timebase %d/%d init %g, want %d/%d %g", c.Num, c.Den, c.InitFill, tt.num, tt.den, tt.initFill)
+			}
+		})
+	}
+}
+
+func TestHRDCheck(t *testing.T) {
+	steady := func(n int, bits ffcommon.FInt) []Frame {
+		frames := make([]Frame, n)
+		for i := range frames {
+			frames[i] = Frame{Nals: []X264NalT{{IPayload: bits / 8}}, Pts: int64(i), Dts: int64(i)}
+		}
+		return frames
+	}
+	tests := []struct {
+		name     string
+		cbr      bool
+		cpb      int64
+		initFill float64
+		frames   []Frame
+		events   int
+		first    HRDEvent
+	}{
+		/* 1 Mbit/s at 25 fps is 40000 bits a frame */
+		{"steady", false, 1000000, 900000, steady(50, 40000), 0, HRDEvent{}},
+		{"underflow", false, 1000000, 900000, func() []Frame {
+			frames := steady(10, 40000)
+			frames[2].Nals[0].IPayload = 2000000 / 8
+			return frames
+		}(), 8, HRDEvent{Frame: 2, Pts: 2}},
+		/* frames of 10000 bits arrive four times as fast as they are removed */
+		{"cbr overflow", true, 100000, 90000, steady(40, 10000), 29, HRDEvent{Frame: 1, Pts: 1, Overflow: true}},
+		{"reported removal", false, 1000000, 0, func() []Frame {
+			frames := steady(25, 40000)
+			for i := range frames {
+				frames[i].HRD.CpbRemoval = 0.5 + 0.04*float64(i)
+			}
+			return frames
+		}(), 0, HRDEvent{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &HRDChecker{Bitrate: 1000000, CPBSize: tt.cpb, CBR: tt.cbr, InitFill: tt.initFill, Num: 1, Den: 25}
+			for i := range tt.frames {
+				c.Add(&tt.frames[i])
+			}
+			events := c.Check()
+			if len(events) != tt.events {
+				t.Fatalf("%d events, want %d: %v", len(events), tt.events, events)
+			}
+			if err := c.Err(); (err != nil) != (tt.events > 0) {
+				t.Errorf("Err: %v", err)
+			}
+			if len(events) > 0 {
+				if ev := events[0]; ev.Frame != tt.first.Frame || ev.Pts != tt.first.Pts || ev.Overflow != tt.first.Overflow {
+					t.Errorf("first event %v, want frame %d overflow %v", ev, tt.first.Frame, tt.first.Overflow)
+				}
+			}
+			if tt.frames[0].HRD.CpbRemoval > 0 && c.Frames[3].Removal != tt.frames[3].HRD.CpbRemoval {
+				t.Errorf("removal %g, want the reported %g", c.Frames[3].Removal, tt.frames[3].HRD.CpbRemoval)
+			}
+		})
+	}
+	if (&HRDChecker{}).Check() != nil {
+		t.Error("events without frames")
+	}
+}
@@ -0,0 +1,197 @@
+package libx264
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/moonfdd/ffmpeg-go/ffcommon"
+)
+
+// ScanMode selects how pictures are coded with respect to fields.
+type ScanMode int
+
+const (
+	ScanProgressive    ScanMode = iota
+	ScanInterlaced              /* MBAFF/PAFF field coding (b_interlaced) */
+	ScanFakeInterlaced          /* progressive coding flagged as PAFF, e.g. 25p/30p Blu-ray */
+)
+
+// SetScan sets b_interlaced, b_fake_interlaced and the field order b_tff.
+// The field order also decides the pulldown patterns of SetPulldown.
+func (param *X264ParamT) SetScan(mode ScanMode, tff bool) {
+	param.b_interlaced = ffcommon.FInt(bool2int(mode == ScanInterlaced))
+	param.b_fake_interlaced = ffcommon.FInt(bool2int(mode == ScanFakeInterlaced))
+	param.b_tff = ffcommon.FInt(bool2int(tff))
+}
+
+// Scan returns the scan mode and whether the top field is first.
+func (param *X264ParamT) Scan() (mode ScanMode, tff bool) {
+	switch {
+	case param.b_interlaced != 0:
+		mode = ScanInterlaced
+	case param.b_fake_interlaced != 0:
+		mode = ScanFakeInterlaced
+	}
+	return mode, param.b_tff != 0
+}
+
+// PicStruct returns the pic_struct (PIC_STRUCT_*) of a picture.
+func (pic *X264PictureT) PicStruct() int {
+	return int(pic.i_pic_struct)
+}
+
+// SetPicStruct sets the pic_struct (PIC_STRUCT_*) of an input picture.  x264
+// only uses it with b_pic_struct set.
+func (pic *X264PictureT) SetPicStruct(picStruct int) error {
+	if _, ok := picStructFields[picStruct]; !ok {
+		return fmt.Errorf("libx264: invalid pic_struct %d", picStruct)
+	}
+	pic.i_pic_struct = ffcommon.FInt(picStruct)
+	return nil
+}
+
+/* display duration in fields, i.e. half ticks of a pulldown timebase */
+var picStructFields = map[int]int64{
+	PIC_STRUCT_AUTO:              2,
+	PIC_STRUCT_PROGRESSIVE:       2,
+	PIC_STRUCT_TOP_BOTTOM:        2,
+	PIC_STRUCT_BOTTOM_TOP:        2,
+	PIC_STRUCT_TOP_BOTTOM_TOP:    3,
+	PIC_STRUCT_BOTTOM_TOP_BOTTOM: 3,
+	PIC_STRUCT_DOUBLE:            4,
+	PIC_STRUCT_TRIPLE:            6,
+}
+
+// Pulldown is a soft telecine pattern as in the x264 CLI --pulldown: the
+// pic_struct of consecutive frames and the output to input frame rate
+// ratio.
+type Pulldown struct {
+	Name      string
+	Pattern   []int /* PIC_STRUCT_*, for top field first */
+	FactorNum uint32
+	FactorDen uint32
+}
+
+const (
+	tb  = PIC_STRUCT_TOP_BOTTOM
+	bt  = PIC_STRUCT_BOTTOM_TOP
+	tbt = PIC_STRUCT_TOP_BOTTOM_TOP
+	btb = PIC_STRUCT_BOTTOM_TOP_BOTTOM
+)
+
+// The pulldown patterns of the x264 CLI.
+var (
+	Pulldown22     = &Pulldown{"22", []int{tb}, 1, 1}
+	Pulldown32     = &Pulldown{"32", []int{tbt, bt, btb, tb}, 5, 4}                     /* 23.976 -> 29.97 */
+	Pulldown64     = &Pulldown{"64", []int{PIC_STRUCT_DOUBLE, PIC_STRUCT_TRIPLE}, 5, 2} /* 23.976 -> 59.94 */
+	PulldownDouble = &Pulldown{"double", []int{PIC_STRUCT_DOUBLE}, 2, 1}
+	PulldownTriple = &Pulldown{"triple", []int{PIC_STRUCT_TRIPLE}, 3, 1}
+	PulldownEuro   = &Pulldown{"euro", []int{tbt, bt, bt, bt, bt, bt, bt, bt, bt, bt, bt, bt,
+		btb, tb, tb, tb, tb, tb, tb, tb, tb, tb, tb, tb}, 25, 24} /* 24 -> 25 */
+)
+
+// Pulldowns lists the patterns by name.
+var Pulldowns = []*Pulldown{Pulldown22, Pulldown32, Pulldown64, PulldownDouble, PulldownTriple, PulldownEuro}
+
+// ParsePulldown returns the pattern called name.
+func ParsePulldown(name string) (*Pulldown, error) {
+	for _, p := range Pulldowns {
+		if strings.EqualFold(p.Name, name) {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("libx264: unknown pulldown %q", name)
+}
+
+// PicStruct returns the pic_struct of frame n for the given field order.
+// Bottom field first swaps the fields of the pattern.
+func (p *Pulldown) PicStruct(n int, tff bool) int {
+	ps := p.Pattern[n%len(p.Pattern)]
+	if !tff {
+		switch ps {
+		case tb:
+			ps = bt
+		case bt:
+			ps = tb
+		case tbt:
+			ps = btb
+		case btb:
+			ps = tbt
+		}
+	}
+	return ps
+}
+
+// SetPulldown configures param for input at fpsNum/fpsDen with pattern p:
+// pic_struct signalling, CFR ratecontrol, and a timebase of one output
+// frame (two fields), which must be an integer rate.  Input pictures then
+// need the pic_struct and PTS of a PulldownClock.
+func (param *X264ParamT) SetPulldown(p *Pulldown, fpsNum, fpsDen uint32) error {
+	if fpsNum == 0 || fpsDen == 0 {
+		return fmt.Errorf("libx264: invalid frame rate %d/%d", fpsNum, fpsDen)
+	}
+	if uint64(fpsNum)*uint64(p.FactorNum)%uint64(p.FactorDen) != 0 {
+		return fmt.Errorf("libx264: pulldown %s: %d/%d fps does not give an integer timebase", p.Name, fpsNum, fpsDen)
+	}
+	param.i_fps_num = ffcommon.FUint32T(fpsNum)
+	param.i_fps_den = ffcommon.FUint32T(fpsDen)
+	param.i_timebase_num = ffcommon.FUint32T(fpsDen)
+	param.i_timebase_den = ffcommon.FUint32T(uint64(fpsNum) * uint64(p.FactorNum) / uint64(p.FactorDen))
+	param.b_vfr_input = 0
+	param.b_pic_struct = 1
+	param.b_pulldown = 1
+	return nil
+}
+
+// PulldownClock assigns pic_struct and timestamps to consecutive input
+// frames.  Timestamps count output frames of the pulldown timebase, the
+// third field of a TBT/BTB frame shifting the following frames by half a
+// tick, rounded like the x264 CLI.
+type PulldownClock struct {
+	Pulldown *Pulldown
+	TFF      bool
+
+	frame  int
+	fields int64
+}
+
+// NewPulldownClock returns a clock starting at frame 0, PTS 0.
+func NewPulldownClock(p *Pulldown, tff bool) *PulldownClock {
+	return &PulldownClock{Pulldown: p, TFF: tff}
+}
+
+// Next returns the pic_struct and PTS of the next frame.
+func (c *PulldownClock) Next() (picStruct int, pts int64) {
+	picStruct = c.Pulldown.PicStruct(c.frame, c.TFF)
+	pts = (c.fields + 1) / 2
+	c.frame++
+	c.fields += picStructFields[picStruct]
+	return picStruct, pts
+}
+
+// Apply sets the pic_struct and PTS of the next frame on pic.
+func (c *PulldownClock) Apply(pic *X264PictureT) {
+	ps, pts := c.Next()
+	pic.i_pic_struct = ffcommon.FInt(ps)
+	pic.IPts = pts
+}
+
+// Frame returns the number of the input frame displayed at pts, the
+// inverse of Next.
+func (c *PulldownClock) Frame(pts int64) int {
+	p := c.Pulldown
+	var cycle int64
+	for i := range p.Pattern {
+		cycle += picStructFields[p.PicStruct(i, c.TFF)]
+	}
+	field := 2 * pts
+	n := int(field/cycle) * len(p.Pattern)
+	field %= cycle
+	for i := 0; ; i++ {
+		d := picStructFields[p.PicStruct(i, c.TFF)]
+		if field < d {
+			return n + i
+		}
+		field -= d
+	}
+}
@@ -0,0 +1,103 @@
+package libx264
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPulldownClock(t *testing.T) {
+	tests := []struct {
+		name    string
+		p       *Pulldown
+		tff     bool
+		structs []int
+		pts     []int64
+	}{
+		{"22 bff", Pulldown22, false, []int{bt, bt, bt, bt}, []int64{0, 1, 2, 3}},
+		{"32 tff", Pulldown32, true, []int{tbt, bt, btb, tb, tbt, bt, btb, tb}, []int64{0, 2, 3, 4, 5, 7, 8, 9}},
+		{"32 bff", Pulldown32, false, []int{btb, tb, tbt, bt, btb}, []int64{0, 2, 3, 4, 5}},
+		{"64", Pulldown64, true, []int{PIC_STRUCT_DOUBLE, PIC_STRUCT_TRIPLE, PIC_STRUCT_DOUBLE, PIC_STRUCT_TRIPLE, PIC_STRUCT_DOUBLE},
+			[]int64{0, 2, 5, 7, 10}},
+		{"triple", PulldownTriple, true, []int{PIC_STRUCT_TRIPLE, PIC_STRUCT_TRIPLE, PIC_STRUCT_TRIPLE}, []int64{0, 3, 6}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewPulldownClock(tt.p, tt.tff)
+			var structs []int
+			var pts []int64
+			for range tt.structs {
+				var pic X264PictureT
+				c.Apply(&pic)
+				structs = append(structs, pic.PicStruct())
+				pts = append(pts, pic.IPts)
+			}
+			if !reflect.DeepEqual(structs, tt.structs) || !reflect.DeepEqual(pts, tt.pts) {
+				t.Errorf("pic_struct %v pts %v, want %v %v", structs, pts, tt.structs, tt.pts)
+			}
+			/* Frame maps every tick to the frame displayed then */
+			for n := range tt.pts {
+				end := tt.pts[len(tt.pts)-1] + 1
+				if n+1 < len(tt.pts) {
+					end = tt.pts[n+1]
+				}
+				for p := tt.pts[n]; p < end; p++ {
+					if f := c.Frame(p); f != n {
+						t.Errorf("Frame(%d) = %d, want %d", p, f, n)
+					}
+				}
+			}
+		})
+	}
+
+	/* euro pulldown shows 24 frames in 25 */
+	c := NewPulldownClock(PulldownEuro, true)
+	for i := 0; i < 24; i++ {
+		c.Next()
+	}
+	if ps, pts := c.Next(); ps != tbt || pts != 25 || c.Frame(25) != 24 || c.Frame(24) != 23 {
+		t.Errorf("euro frame 24: pic_struct %d pts %d, Frame(25) %d", ps, pts, c.Frame(25))
+	}
+}
+
+func TestSetPulldown(t *testing.T) {
+	tests := []struct {
+		name           string
+		p              string
+		fpsNum, fpsDen uint32
+		tbNum, tbDen   uint32 /* 0 if rejected */
+	}{
+		{"32 film", "32", 24000, 1001, 1001, 30000},
+		{"euro", "EURO", 24, 1, 1, 25},
+		{"double", "double", 30, 1, 1, 60},
+		{"32 at 25", "32", 25, 1, 0, 0},
+		{"zero rate", "22", 0, 1, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParsePulldown(tt.p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			param := new(X264ParamT)
+			err = param.SetPulldown(p, tt.fpsNum, tt.fpsDen)
+			if (err == nil) != (tt.tbDen != 0) {
+				t.Fatalf("SetPulldown: %v", err)
+			}
+			if err != nil {
+				return
+			}
+			if uint32(param.i_timebase_num) != tt.tbNum || uint32(param.i_timebase_den) != tt.tbDen ||
+				param.b_pic_struct == 0 || param.b_pulldown == 0 || param.b_vfr_input != 0 {
+				t.Errorf("timebase %d/%d pic_struct %d pulldown %d vfr %d", param.i_timebase_num, param.i_timebase_den,
+					param.b_pic_struct, param.b_pulldown, param.b_vfr_input)
+			}
+		})
+	}
+	if _, err := ParsePulldown("24"); err == nil {
+		t.Error("unknown pulldown parsed")
+	}
+	var pic X264PictureT
+	if err := pic.SetPicStruct(3); err == nil {
+		t.Error("invalid pic_struct accepted")
+	}
+}
@@ -0,0 +1,268 @@
+package libx264
+
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/moonfdd/ffmpeg-go/ffcommon"
+	"github.com/moonfdd/x264-go/libx264common"
+)
+
+// Level is an H.264 level definition (table A-1) as in x264_levels.
+type Level struct {
+	IDC       int   /* level_idc, 9 for level 1b */
+	MBPS      int64 /* max macroblock processing rate (macroblocks/sec) */
+	FrameSize int64 /* max frame size (macroblocks) */
+	DPB       int64 /* max decoded picture buffer (macroblocks) */
+	Bitrate   int64 /* max bitrate (kbit/sec), Baseline/Main */
+	CPB       int64 /* max vbv buffer (kbit), Baseline/Main */
+	MVRange   int   /* max vertical mv component range (pixels) */
+	MVsPer2MB int   /* max mvs per 2 consecutive mbs */
+	SliceRate int
+	MinCR     int /* min compression ratio */
+	Bipred8x8 bool
+	Direct8x8 bool
+	FrameOnly bool /* interlacing forbidden */
+}
+
+// Name returns the level as written in profiles, e.g. "3.1" or "1b".
+func (l Level) Name() string {
+	if l.IDC == 9 {
+		return "1b"
+	}
+	if l.IDC%10 == 0 {
+		return fmt.Sprint(l.IDC / 10)
+	}
+	return fmt.Sprintf("%d.%d", l.IDC/10, l.IDC%10)
+}
+
+func (l Level) String() string {
+	return "level " + l.Name()
+}
+
+/* table A-1 as x264 ships it, for when the library cannot be loaded */
+var builtinLevels = []X264LevelT{
+	{10, 1485, 99, 396, 64, 175, 64, 64, 0, 2, 0, 0, 1},
+	{9, 1485, 99, 396, 128, 350, 64, 64, 0, 2, 0, 0, 1},
+	{11, 3000, 396, 900, 192, 500, 128, 64, 0, 2, 0, 0, 1},
+	{12, 6000, 396, 2376, 384, 1000, 128, 64, 0, 2, 0, 0, 1},
+	{13, 11880, 396, 2376, 768, 2000, 128, 64, 0, 2, 0, 0, 1},
+	{20, 11880, 396, 2376, 2000, 2000, 128, 64, 0, 2, 0, 0, 1},
+	{21, 19800, 792, 4752, 4000, 4000, 256, 64, 0, 2, 0, 0, 0},
+	{22, 20250, 1620, 8100, 4000, 4000, 256, 64, 0, 2, 0, 0, 0},
+	{30, 40500, 1620, 8100, 10000, 10000, 256, 32, 22, 2, 0, 1, 0},
+	{31, 108000, 3600, 18000, 14000, 14000, 512, 16, 60, 4, 1, 1, 0},
+	{32, 216000, 5120, 20480, 20000, 20000, 512, 16, 60, 4, 1, 1, 0},
+	{40, 245760, 8192, 32768, 20000, 25000, 512, 16, 60, 4, 1, 1, 0},
+	{41, 245760, 8192, 32768, 50000, 62500, 512, 16, 24, 2, 1, 1, 0},
+	{42, 522240, 8704, 34816, 50000, 62500, 512, 16, 24, 2, 1, 1, 1},
+	{50, 589824, 22080, 110400, 135000, 135000, 512, 16, 24, 2, 1, 1, 1},
+	{51, 983040, 36864, 184320, 240000, 240000, 512, 16, 24, 2, 1, 1, 1},
+	{52, 2073600, 36864, 184320, 240000, 240000, 512, 16, 24, 2, 1, 1, 1},
+	{60, 4177920, 139264, 696320, 240000, 240000, 8192, 16, 24, 2, 1, 1, 1},
+	{61, 8355840, 139264, 696320, 480000, 480000, 8192, 16, 24, 2, 1, 1, 1},
+	{62, 16711680, 139264, 696320, 800000, 800000, 8192, 16, 24, 2, 1, 1, 1},
+}
+
+// X264Levels returns a copy of the x264_levels table exported by the
+// library, without the terminating entry.
+//
+// X264_API extern const x264_level_t x264_levels[];
+func X264Levels() ([]X264LevelT, error) {
+	proc := libx264common.GetLibx264Dll().NewProc("x264_levels")
+	if err := proc.Find(); err != nil {
+		return nil, err
+	}
+	addr := proc.Addr()
+	p := *(*unsafe.Pointer)(unsafe.Pointer(&addr))
+	var levels []X264LevelT
+	for i := 0; i < 64; i++ {
+		l := *(*X264LevelT)(unsafe.Pointer(uintptr(p) + uintptr(i)*unsafe.Sizeof(X264LevelT{})))
+		if l.level_idc == 0 {
+			return levels, nil
+		}
+		levels = append(levels, l)
+	}
+	return nil, fmt.Errorf("libx264: x264_levels is not terminated")
+}
+
+// Level converts an x264_level_t.
+func (l *X264LevelT) Level() Level {
+	return Level{
+		IDC:       int(l.level_idc),
+		MBPS:      int64(l.mbps),
+		FrameSize: int64(l.frame_size),
+		DPB:       int64(l.dpb),
+		Bitrate:   int64(l.bitrate),
+		CPB:       int64(l.cpb),
+		MVRange:   int(l.mv_range),
+		MVsPer2MB: int(l.mvs_per_2mb),
+		SliceRate: int(l.slice_rate),
+		MinCR:     int(l.mincr),
+		Bipred8x8: l.bipred8x8 != 0,
+		Direct8x8: l.direct8x8 != 0,
+		FrameOnly: l.frame_only != 0,
+	}
+}
+
+// Levels returns the level definitions of the library, or the built-in
+// copy of table A-1 if it cannot be loaded, in increasing order.
+func Levels() []Level {
+	table, err := X264Levels()
+	if err != nil || len(table) == 0 {
+		table = builtinLevels
+	}
+	levels := make([]Level, len(table))
+	for i := range table {
+		levels[i] = table[i].Level()
+	}
+	return levels
+}
+
+// LevelByName returns the level called name ("3.1", "31", "1b").
+func LevelByName(name string) (Level, error) {
+	for _, l := range Levels() {
+		if name == l.Name() || name == fmt.Sprint(l.IDC) && l.IDC != 9 {
+			return l, nil
+		}
+	}
+	return Level{}, fmt.Errorf("libx264: unknown level %q", name)
+}
+
+// LevelConstraints describes a stream for checking it against levels.
+type LevelConstraints struct {
+	Width, Height  int
+	FpsNum, FpsDen uint32
+	Refs           int  /* reference frames held in the DPB */
+	Interlaced     bool /* field coding, including fake interlaced */
+	MaxBitrate     int  /* VBV max rate in kbit/s, 0 if unknown */
+	BufferSize     int  /* VBV buffer in kbit, 0 if unknown */
+	MVRange        int  /* vertical mv range in pixels, 0 if automatic */
+
+	// CPBFactor scales the Baseline/Main bitrate and CPB limits by
+	// CPBFactor/4: 4 for Baseline and Main, 5 for High, 12 for High 10
+	// and 16 for High 4:2:2 and 4:4:4.
+	CPBFactor int
+}
+
+// LevelViolation is the constraint a stream breaks at a level.
+type LevelViolation struct {
+	Level      Level
+	Constraint string
+	Value      int64
+	Limit      int64
+}
+
+func (v *LevelViolation) Error() string {
+	return fmt.Sprintf("libx264: %v: %s %d exceeds %d", v.Level, v.Constraint, v.Value, v.Limit)
+}
+
+// Check returns the first constraint c violates at level l as a
+// *LevelViolation, or nil.
+func (l Level) Check(c LevelConstraints) error {
+	mbw := int64(c.Width+15) / 16
+	mbh := int64(c.Height+15) / 16
+	if c.Interlaced {
+		mbh = int64(c.Height+31) / 32 * 2
+	}
+	mbs := mbw * mbh
+	factor := int64(c.CPBFactor)
+	if factor <= 0 {
+		factor = 4
+	}
+	violation := func(constraint string, value, limit int64) error {
+		return &LevelViolation{Level: l, Constraint: constraint, Value: value, Limit: limit}
+	}
+	switch {
+	case mbs > l.FrameSize:
+		return violation("frame size in macroblocks", mbs, l.FrameSize)
+	case mbw*mbw > 8*l.FrameSize:
+		return violation("squared width in macroblocks", mbw*mbw, 8*l.FrameSize)
+	case mbh*mbh > 8*l.FrameSize:
+		return violation("squared height in macroblocks", mbh*mbh, 8*l.FrameSize)
+	case int64(c.Refs)*mbs > l.DPB:
+		return violation("DPB size in macroblocks", int64(c.Refs)*mbs, l.DPB)
+	case c.FpsDen > 0 && mbs*int64(c.FpsNum) > l.MBPS*int64(c.FpsDen):
+		return violation("macroblock rate", (mbs*int64(c.FpsNum)+int64(c.FpsDen)-1)/int64(c.FpsDen), l.MBPS)
+	case int64(c.MaxBitrate)*4 > l.Bitrate*factor:
+		return violation("VBV max rate (kbit/s)", int64(c.MaxBitrate), l.Bitrate*factor/4)
+	case int64(c.BufferSize)*4 > l.CPB*factor:
+		return violation("VBV buffer (kbit)", int64(c.BufferSize), l.CPB*factor/4)
+	case c.MVRange > l.MVRange:
+		return violation("MV range", int64(c.MVRange), int64(l.MVRange))
+	case c.Interlaced && l.FrameOnly:
+		return violation("interlaced coding", 1, 0)
+	}
+	return nil
+}
+
+// SelectLevel returns the lowest level c complies with, or the violation
+// at the highest level.
+func SelectLevel(c LevelConstraints) (Level, error) {
+	levels := Levels()
+	var err error
+	for _, l := range levels {
+		if err = l.Check(c); err == nil {
+			return l, nil
+		}
+	}
+	return Level{}, err
+}
+
+// LevelConstraints returns the constraints of an encode with param.  The
+// CPB factor follows the profile x264 picks from the bit depth, chroma
+// format and 8x8 transform.
+func (param *X264ParamT) LevelConstraints() LevelConstraints {
+	fpsNum, fpsDen := param.FPS()
+	refs := int(param.i_frame_reference)
+	if int(param.i_dpb_size) > refs {
+		refs = int(param.i_dpb_size)
+	}
+	mode, _ := param.Scan()
+	maxrate, bufsize := param.VBV()
+	c := LevelConstraints{
+		Width: int(param.IWidth), Height: int(param.IHeight),
+		FpsNum: fpsNum, FpsDen: fpsDen,
+		Refs:       refs,
+		Interlaced: mode != ScanProgressive,
+		MaxBitrate: maxrate, BufferSize: bufsize,
+		CPBFactor: 4,
+	}
+	if param.analyse.i_mv_range > 0 {
+		c.MVRange = int(param.analyse.i_mv_range)
+	}
+	switch csp := param.ICsp & X264_CSP_MASK; {
+	case csp >= X264_CSP_I422:
+		c.CPBFactor = 16
+	case param.i_bitdepth > 8:
+		c.CPBFactor = 12
+	case param.analyse.b_transform_8x8 != 0 || param.i_cqm_preset != 0:
+		c.CPBFactor = 5
+	}
+	return c
+}
+
+// SelectLevel sets i_level_idc to the lowest level the encode complies
+// with.
+func (param *X264ParamT) SelectLevel() (Level, error) {
+	l, err := SelectLevel(param.LevelConstraints())
+	if err != nil {
+		return l, err
+	}
+	param.i_level_idc = ffcommon.FInt(l.IDC)
+	return l, nil
+}
+
+// CheckLevel checks the encode against the level set in i_level_idc; -1
+// (auto) always passes.
+func (param *X264ParamT) CheckLevel() error {
+	if param.i_level_idc <= 0 {
+		return nil
+	}
+	for _, l := range Levels() {
+		if l.IDC == int(param.i_level_idc) {
+			return l.Check(param.LevelConstraints())
+		}
+	}
+	return fmt.Errorf("libx264: unknown level_idc %d", param.i_level_idc)
+}
@@ -0,0 +1,134 @@
+package libx264
+
+import (
+	"testing"
+)
+
+func TestLevelName(t *testing.T) {
+	tests := []struct {
+		idc  int
+		name string
+	}{
+		{9, "1b"}, {10, "1"}, {13, "1.3"}, {30, "3"}, {31, "3.1"}, {62, "6.2"},
+	}
+	for _, tt := range tests {
+		if got := (Level{IDC: tt.idc}).Name(); got != tt.name {
+			t.Errorf("level_idc %d: %q, want %q", tt.idc, got, tt.name)
+		}
+	}
+	for _, name := range []string{"3.1", "31", "1b"} {
+		if _, err := LevelByName(name); err != nil {
+			t.Error(err)
+		}
+	}
+	for _, name := range []string{"9", "7", ""} {
+		if l, err := LevelByName(name); err == nil {
+			t.Errorf("LevelByName(%q) = %v", name, l)
+		}
+	}
+}
+
+func TestSelectLevel(t *testing.T) {
+	tests := []struct {
+		name       string
+		c          LevelConstraints
+		level      string /* empty if no level fits */
+		constraint string /* first violation at level 3, or at 6.2 if none fits */
+	}{
+		{"240p30", LevelConstraints{Width: 320, Height: 240, FpsNum: 30, FpsDen: 1, Refs: 4}, "1.3", ""},
+		{"720p30", LevelConstraints{Width: 1280, Height: 720, FpsNum: 30, FpsDen: 1, Refs: 4}, "3.1", "frame size in macroblocks"},
+		{"1080p29.97", LevelConstraints{Width: 1920, Height: 1080, FpsNum: 30000, FpsDen: 1001, Refs: 4}, "4", "frame size in macroblocks"},
+		{"1080i", LevelConstraints{Width: 1920, Height: 1080, FpsNum: 30, FpsDen: 1, Refs: 4, Interlaced: true}, "4", "frame size in macroblocks"},
+		{"1080p high bitrate", LevelConstraints{Width: 1920, Height: 1080, FpsNum: 25, FpsDen: 1, Refs: 4, MaxBitrate: 25000, BufferSize: 25000, CPBFactor: 4}, "4.1", "frame size in macroblocks"},
+		{"1080p high profile", LevelConstraints{Width: 1920, Height: 1080, FpsNum: 25, FpsDen: 1, Refs: 4, MaxBitrate: 25000, BufferSize: 25000, CPBFactor: 5}, "4", "frame size in macroblocks"},
+		{"1080p60", LevelConstraints{Width: 1920, Height: 1080, FpsNum: 60, FpsDen: 1, Refs: 4}, "4.2", "frame size in macroblocks"},
+		/* levels 4.2 and up forbid interlacing */
+		{"1080i60 frames", LevelConstraints{Width: 1920, Height: 1080, FpsNum: 60, FpsDen: 1, Refs: 4, Interlaced: true}, "", "interlaced coding"},
+		{"dpb", LevelConstraints{Width: 640, Height: 480, FpsNum: 25, FpsDen: 1, Refs: 16}, "3.2", "DPB size in macroblocks"},
+		{"wide strip", LevelConstraints{Width: 4096, Height: 16, FpsNum: 25, FpsDen: 1, Refs: 1}, "4", "squared width in macroblocks"},
+		{"mv range", LevelConstraints{Width: 640, Height: 480, FpsNum: 25, FpsDen: 1, Refs: 1, MVRange: 1024}, "6", "MV range"},
+		{"too fast", LevelConstraints{Width: 8192, Height: 4320, FpsNum: 240, FpsDen: 1, Refs: 1}, "", "macroblock rate"},
+	}
+	level3, err := LevelByName("3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := SelectLevel(tt.c)
+			if tt.level == "" {
+				v, ok := err.(*LevelViolation)
+				if !ok || v.Level.Name() != "6.2" || v.Constraint != tt.constraint {
+					t.Fatalf("SelectLevel = %v, %v", l, err)
+				}
+				return
+			}
+			if err != nil || l.Name() != tt.level {
+				t.Fatalf("SelectLevel = %v, %v, want level %s", l, err, tt.level)
+			}
+			err = level3.Check(tt.c)
+			if tt.constraint == "" {
+				if err != nil {
+					t.Errorf("level 3: %v", err)
+				}
+				return
+			}
+			if v, ok := err.(*LevelViolation); !ok || v.Constraint != tt.constraint || v.Value <= v.Limit {
+				t.Errorf("level 3: %v, want a %s violation", err, tt.constraint)
+			}
+		})
+	}
+}
+
+func TestParamLevel(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  func(param *X264ParamT)
+		factor int
+		level  string
+	}{
+		{"main", func(param *X264ParamT) {}, 4, "4.1"},
+		{"high", func(param *X264ParamT) { param.analyse.b_transform_8x8 = 1 }, 5, "4"},
+		{"high 10", func(param *X264ParamT) { param.i_bitdepth = 10 }, 12, "4"},
+		{"high 4:2:2", func(param *X264ParamT) { param.ICsp = X264_CSP_I422 }, 16, "4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			param := new(X264ParamT)
+			param.IWidth, param.IHeight = 1920, 1080
+			param.ICsp = X264_CSP_I420
+			param.i_bitdepth = 8
+			param.i_frame_reference = 3
+			param.i_dpb_size = 4
+			param.SetBitrate(22000)
+			param.SetVBV(22000, 22000)
+			if err := param.SetFPS(25, 1); err != nil {
+				t.Fatal(err)
+			}
+			tt.setup(param)
+			c := param.LevelConstraints()
+			if c.CPBFactor != tt.factor || c.Refs != 4 || c.Interlaced || c.MaxBitrate != 22000 {
+				t.Errorf("constraints %+v", c)
+			}
+			l, err := param.SelectLevel()
+			if err != nil || l.Name() != tt.level || int(param.i_level_idc) != l.IDC {
+				t.Fatalf("SelectLevel = %v, %v; level_idc %d", l, err, param.i_level_idc)
+			}
+			if err := param.CheckLevel(); err != nil {
+				t.Error(err)
+			}
+			param.i_level_idc = 30
+			if err := param.CheckLevel(); err == nil {
+				t.Error("1080p passed level 3")
+			}
+			param.i_level_idc = 99
+			if err := param.CheckLevel(); err == nil {
+				t.Error("unknown level passed")
+			}
+			param.i_level_idc = -1
+			if err := param.CheckLevel(); err != nil {
+				t.Errorf("auto level: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package libx264
+
+import (
+	"bytes"
+	"image"
+
+	"github.com/moonfdd/ffmpeg-go/ffcommon"
+)
+
+// SetMbInfo sets analyse.b_mb_info, needed for x264 to use the mb_info of
+// input pictures, and analyse.b_mb_info_update, making x264 clear
+// X264_MBINFO_CONSTANT on macroblocks whose decoded pixels changed.
+func (param *X264ParamT) SetMbInfo(enable, update bool) {
+	param.analyse.b_mb_info = ffcommon.FInt(bool2int(enable))
+	param.analyse.b_mb_info_update = ffcommon.FInt(bool2int(update && enable))
+}
+
+// MbInfo holds per-macroblock flags (X264_MBINFO_*) in raster order.
+type MbInfo struct {
+	MbWidth  int
+	MbHeight int
+	Flags    []byte
+}
+
+// NewMbInfo returns flags for a width x height picture with every
+// macroblock marked X264_MBINFO_CONSTANT.  interlaced must match
+// b_interlaced, which makes x264 expect pairs of macroblock rows.
+func NewMbInfo(width, height int, interlaced bool) *MbInfo {
+	q := NewQuantOffsets(width, height, interlaced)
+	m := &MbInfo{MbWidth: q.MbWidth, MbHeight: q.MbHeight}
+	m.Flags = bytes.Repeat([]byte{X264_MBINFO_CONSTANT}, m.MbWidth*m.MbHeight)
+	return m
+}
+
+// NewMbInfo returns constant flags matching the encoder's picture size.
+func (e *Encoder) NewMbInfo() (*MbInfo, error) {
+	param, err := e.Parameters()
+	if err != nil {
+		return nil, err
+	}
+	return NewMbInfo(int(param.IWidth), int(param.IHeight), param.b_interlaced != 0), nil
+}
+
+// MbInfoFromDamage marks every macroblock constant except those touched by
+// the damaged rectangles (in luma pixels), e.g. from a screen capture API.
+func MbInfoFromDamage(width, height int, interlaced bool, damage []image.Rectangle) *MbInfo {
+	m := NewMbInfo(width, height, interlaced)
+	for _, r := range damage {
+		m.Damage(r)
+	}
+	return m
+}
+
+// Damage clears X264_MBINFO_CONSTANT on every macroblock touched by r.
+func (m *MbInfo) Damage(r image.Rectangle) {
+	mbs := image.Rect(r.Min.X/16, r.Min.Y/16, (r.Max.X+15)/16, (r.Max.Y+15)/16).
+		Intersect(image.Rect(0, 0, m.MbWidth, m.MbHeight))
+	for y := mbs.Min.Y; y < mbs.Max.Y; y++ {
+		for x := mbs.Min.X; x < mbs.Max.X; x++ {
+			m.Flags[y*m.MbWidth+x] &^= X264_MBINFO_CONSTANT
+		}
+	}
+}
+
+// Constant reports whether macroblock (x, y) is flagged constant.
+func (m *MbInfo) Constant(x, y int) bool {
+	return m.Flags[y*m.MbWidth+x]&X264_MBINFO_CONSTANT != 0
+}
+
+// SetMbInfo attaches m to an input picture; nil detaches it.  x264 uses
+// (and with b_mb_info_update rewrites) the flags until the frame leaves
+// the encoder, so Encoder.Encode takes over m and detaches it from the
+// picture; the updated flags come back in Frame.MbInfo.  m must not be
+// modified or attached again before then, and must cover the encoder's
+// macroblock grid, see Encoder.NewMbInfo.
+func (pic *X264PictureT) SetMbInfo(m *MbInfo) {
+	if m == nil || len(m.Flags) == 0 {
+		pic.prop.mb_info = nil
+	} else {
+		pic.prop.mb_info = &m.Flags[0]
+	}
+	pic.prop.mb_info_free = 0
+}
+
+// FrameDiffer builds mb_info by comparing each input picture with the
+// previous one.  Only 8-bit I420, NV12, I422 and I444 pictures are
+// supported.
+type FrameDiffer struct {
+	Width, Height int
+	Csp           ffcommon.FInt
+	Interlaced    bool /* b_interlaced of the encoder */
+
+	prev [][]byte
+}
+
+// NewFrameDiffer returns a differ for width x height pictures of csp.
+func NewFrameDiffer(width, height int, csp ffcommon.FInt, interlaced bool) *FrameDiffer {
+	return &FrameDiffer{Width: width, Height: height, Csp: csp, Interlaced: interlaced}
+}
+
+type diffPlane struct {
+	width, height int /* bytes and rows of the plane */
+	mbw, mbh      int /* bytes and rows per macroblock */
+}
+
+func (d *FrameDiffer) planes() []diffPlane {
+	w, h := d.Width, d.Height
+	cw, ch := (w+1)/2, (h+1)/2
+	switch d.Csp & X264_CSP_MASK {
+	case X264_CSP_NV12:
+		return []diffPlane{{w, h, 16, 16}, {cw * 2, ch, 16, 8}}
+	case X264_CSP_I422:
+		return []diffPlane{{w, h, 16, 16}, {cw, h, 8, 16}, {cw, h, 8, 16}}
+	case X264_CSP_I444:
+		return []diffPlane{{w, h, 16, 16}, {w, h, 16, 16}, {w, h, 16, 16}}
+	}
+	return []diffPlane{{w, h, 16, 16}, {cw, ch, 8, 8}, {cw, ch, 8, 8}}
+}
+
+// Diff returns the flags for pic and remembers its pixels.  The first
+// picture is all damaged.
+func (d *FrameDiffer) Diff(pic *X264PictureT) *MbInfo {
+	m := NewMbInfo(d.Width, d.Height, d.Interlaced)
+	planes := d.planes()
+	first := d.prev == nil
+	if first {
+		d.prev = make([][]byte, len(planes))
+	}
+	for i, p := range planes {
+		stride := int(pic.Img.IStride[i])
+		src := ffcommon.ByteSliceFromByteP(pic.Img.Plane[i], stride*(p.height-1)+p.width)
+		if first {
+			d.prev[i] = make([]byte, p.width*p.height)
+		}
+		prev := d.prev[i]
+		for y := 0; y < p.height; y++ {
+			row := src[y*stride : y*stride+p.width]
+			old := prev[y*p.width : (y+1)*p.width]
+			if !first {
+				for x := 0; x < p.width; x += p.mbw {
+					end := x + p.mbw
+					if end > p.width {
+						end = p.width
+					}
+					if !bytes.Equal(row[x:end], old[x:end]) {
+						m.Flags[y/p.mbh*m.MbWidth+x/p.mbw] &^= X264_MBINFO_CONSTANT
+					}
+				}
+			}
+			copy(old, row)
+		}
+	}
+	if first {
+		for i := range m.Flags {
+			m.Flags[i] = 0
+		}
+	}
+	return m
+}
@@ -0,0 +1,95 @@
+package libx264
+
+import (
+	"bytes"
+	"image"
+	"reflect"
+	"testing"
+
+	"github.com/moonfdd/ffmpeg-go/ffcommon"
+)
+
+func TestMbInfoFromDamage(t *testing.T) {
+	const c = X264_MBINFO_CONSTANT
+	tests := []struct {
+		name          string
+		width, height int
+		interlaced    bool
+		damage        []image.Rectangle
+		mbw, mbh      int
+		want          []byte
+	}{
+		{"undamaged", 32, 32, false, nil, 2, 2, []byte{c, c, c, c}},
+		{"one pixel", 32, 32, false, []image.Rectangle{image.Rect(17, 3, 18, 4)}, 2, 2, []byte{c, 0, c, c}},
+		{"across macroblocks", 48, 32, false, []image.Rectangle{image.Rect(15, 15, 17, 17)}, 3, 2,
+			[]byte{0, 0, c, 0, 0, c}},
+		{"clipped", 32, 32, false, []image.Rectangle{image.Rect(-10, 20, 100, 100)}, 2, 2, []byte{c, c, 0, 0}},
+		/* x264 pads interlaced pictures to pairs of macroblock rows */
+		{"interlaced", 32, 40, true, []image.Rectangle{image.Rect(0, 32, 1, 40)}, 2, 4,
+			[]byte{c, c, c, c, 0, c, c, c}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := MbInfoFromDamage(tt.width, tt.height, tt.interlaced, tt.damage)
+			if m.MbWidth != tt.mbw || m.MbHeight != tt.mbh || !reflect.DeepEqual(m.Flags, tt.want) {
+				t.Errorf("%dx%d %v, want %dx%d %v", m.MbWidth, m.MbHeight, m.Flags, tt.mbw, tt.mbh, tt.want)
+			}
+		})
+	}
+	m := NewMbInfo(32, 16, false)
+	m.Damage(image.Rect(16, 0, 32, 16))
+	if !m.Constant(0, 0) || m.Constant(1, 0) {
+		t.Errorf("Constant: %v", m.Flags)
+	}
+}
+
+func TestFrameDiffer(t *testing.T) {
+	const c = X264_MBINFO_CONSTANT
+	tests := []struct {
+		name          string
+		width, height int
+		csp           ffcommon.FInt
+		interlaced    bool
+		plane, x, y   int /* byte changed between the pictures */
+		want          []byte
+	}{
+		{"i420 luma", 32, 32, X264_CSP_I420, false, 0, 20, 5, []byte{c, 0, c, c}},
+		{"i420 chroma", 32, 32, X264_CSP_I420, false, 2, 3, 10, []byte{c, c, 0, c}},
+		{"nv12 chroma", 32, 32, X264_CSP_NV12, false, 1, 20, 3, []byte{c, 0, c, c}},
+		{"i422 chroma", 32, 32, X264_CSP_I422, false, 1, 9, 17, []byte{c, c, c, 0}},
+		{"i444 chroma", 32, 32, X264_CSP_I444, false, 2, 16, 0, []byte{c, 0, c, c}},
+		{"interlaced", 32, 40, X264_CSP_I420, true, 0, 31, 39, []byte{c, c, c, c, c, 0, c, c}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewFrameDiffer(tt.width, tt.height, tt.csp, tt.interlaced)
+			/* planes with padded strides */
+			var pic X264PictureT
+			planes := make([][]byte, len(d.planes()))
+			for i, p := range d.planes() {
+				stride := p.width + 8
+				planes[i] = make([]byte, stride*p.height)
+				pic.Img.IStride[i] = ffcommon.FInt(stride)
+				pic.Img.Plane[i] = (*ffcommon.FUint8T)(&planes[i][0])
+			}
+			first := d.Diff(&pic)
+			if len(first.Flags) != len(tt.want) {
+				t.Fatalf("%d flags, want %d", len(first.Flags), len(tt.want))
+			}
+			for i, f := range first.Flags {
+				if f != 0 {
+					t.Fatalf("first picture: macroblock %d constant", i)
+				}
+			}
+			/* padding bytes are not compared */
+			planes[0][tt.width] = 1
+			if m := d.Diff(&pic); !bytes.Equal(m.Flags, bytes.Repeat([]byte{c}, len(tt.want))) {
+				t.Errorf("unchanged picture: %v", m.Flags)
+			}
+			planes[tt.plane][tt.y*int(pic.Img.IStride[tt.plane])+tt.x] = 1
+			if m := d.Diff(&pic); !reflect.DeepEqual(m.Flags, tt.want) {
+				t.Errorf("%v, want %v", m.Flags, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package libx264
+
+import (
+	"encoding/binary"
+	"unsafe"
+
+	"github.com/moonfdd/ffmpeg-go/ffcommon"
+)
+
+// X264NalSlice returns the NAL array filled in by X264EncoderEncode or
+// X264EncoderHeaders (pp_nal, pi_nal) as a Go slice.
+// The slice aliases x264 memory and is only valid until the next
+// x264_encoder_encode or x264_encoder_headers call.
+func X264NalSlice(p_nal *X264NalT, i_nal ffcommon.FInt) []X264NalT {
+	if p_nal == nil || i_nal <= 0 {
+		return nil
+	}
+	var sh struct {
+		Data *X264NalT
+		Len  int
+		Cap  int
+	}
+	sh.Data = p_nal
+	sh.Len = int(i_nal)
+	sh.Cap = int(i_nal)
+	return *(*[]X264NalT)(unsafe.Pointer(&sh))
+}
+
+// Payload returns the encapsulated NAL as written by x264, including the
+// Annex-B start code or the 4-byte size prefix.
+// The bytes alias x264 memory, copy them if they must outlive the next encode call.
+func (nal *X264NalT) Payload() []byte {
+	return ffcommon.ByteSliceFromByteP(nal.PPayload, int(nal.IPayload))
+}
+
+// Unit returns the NAL unit (header byte and RBSP with emulation prevention)
+// without the Annex-B start code or 4-byte size prefix, whichever b_annexb
+// selected.
+func (nal *X264NalT) Unit() []byte {
+	p := nal.Payload()
+	hdr := byte(nal.IRefIdc<<5 | nal.IType)
+	if len(p) >= 5 && p[0] == 0 && p[1] == 0 && p[2] == 0 && p[3] == 1 && p[4] == hdr {
+		return p[4:]
+	}
+	/* a size prefix can look like a 3-byte start code followed by the
+	 * header, so it is tested first and must be followed by the header */
+	if len(p) >= 5 && int(binary.BigEndian.Uint32(p)) == len(p)-4 && p[4] == hdr {
+		return p[4:]
+	}
+	if len(p) >= 4 && p[0] == 0 && p[1] == 0 && p[2] == 1 && p[3] == hdr {
+		return p[3:]
+	}
+	return p
+}
+
+// AppendAnnexB appends the NAL unit with an Annex-B start code to dst, so
+// that the result is the same whether or not b_annexb was set.  The start
+// code is 4 bytes if b_long_startcode is set, as x264 writes it.
+func (nal *X264NalT) AppendAnnexB(dst []byte) []byte {
+	if nal.BLongStartcode != 0 {
+		dst = append(dst, 0, 0, 0, 1)
+	} else {
+		dst = append(dst, 0, 0, 1)
+	}
+	return append(dst, nal.Unit()...)
+}
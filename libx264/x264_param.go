@@ -0,0 +1,70 @@
+package libx264
+
+import (
+	"sync"
+	"unsafe"
+
+	"github.com/moonfdd/ffmpeg-go/ffcommon"
+)
+
+// Go memory referenced from an x264_param_t (strings, zones, ...).  x264
+// only sees raw pointers, so the buffers are kept reachable here until an
+// encoder opened with the param takes them over for its lifetime, or the
+// param is released.
+var paramMem = struct {
+	sync.Mutex
+	m map[*X264ParamT][]interface{}
+}{m: make(map[*X264ParamT][]interface{})}
+
+func (param *X264ParamT) keep(v interface{}) {
+	paramMem.Lock()
+	paramMem.m[param] = append(paramMem.m[param], v)
+	paramMem.Unlock()
+}
+
+func (param *X264ParamT) kept() []interface{} {
+	paramMem.Lock()
+	defer paramMem.Unlock()
+	return append([]interface{}(nil), paramMem.m[param]...)
+}
+
+// take removes and returns the Go memory referenced by param, handing its
+// ownership to the caller.
+func (param *X264ParamT) take() []interface{} {
+	paramMem.Lock()
+	defer paramMem.Unlock()
+	v := paramMem.m[param]
+	delete(paramMem.m, param)
+	return v
+}
+
+// cString returns a NUL terminated copy of s kept alive with param, or 0
+// for an empty string.
+func (param *X264ParamT) cString(s string) ffcommon.FCharPStruct {
+	if s == "" {
+		return 0
+	}
+	b := make([]byte, len(s)+1)
+	copy(b, s)
+	param.keep(b)
+	return ffcommon.FCharPStruct(unsafe.Pointer(&b[0]))
+}
+
+// Copy returns a copy of param sharing the Go memory it references.  Only
+// one of the two may be passed to x264_param_cleanup.
+func (param *X264ParamT) Copy() *X264ParamT {
+	p := new(X264ParamT)
+	*p = *param
+	for _, v := range param.kept() {
+		p.keep(v)
+	}
+	return p
+}
+
+// Release drops the Go memory referenced by param without opening an
+// encoder.  param must not be used to open an encoder afterwards.
+func (param *X264ParamT) Release() {
+	paramMem.Lock()
+	delete(paramMem.m, param)
+	paramMem.Unlock()
+}
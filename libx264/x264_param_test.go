@@ -0,0 +1,30 @@
+package libx264
+
+import "testing"
+
+func TestParamMem(t *testing.T) {
+	param := new(X264ParamT)
+	if param.cString("") != 0 {
+		t.Error("empty string allocated")
+	}
+	param.cString("stats.log")
+	param.cString("zones")
+	cp := param.Copy()
+
+	if got := param.take(); len(got) != 2 {
+		t.Errorf("take returned %d buffers, want 2", len(got))
+	}
+	if got := param.kept(); len(got) != 0 {
+		t.Errorf("%d buffers left after take", len(got))
+	}
+	if got := cp.kept(); len(got) != 2 {
+		t.Errorf("copy keeps %d buffers, want 2", len(got))
+	}
+	cp.Release()
+	paramMem.Lock()
+	n := len(paramMem.m)
+	paramMem.Unlock()
+	if n != 0 {
+		t.Errorf("%d params still referenced", n)
+	}
+}
@@ -0,0 +1,186 @@
+package libx264
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/moonfdd/ffmpeg-go/ffcommon"
+)
+
+// SetPass configures multipass rate control like the x264 --pass and
+// --stats options: pass 1 writes the stats file, 2 reads it and 3 reads
+// and rewrites it.  pass 0 disables multipass.
+func (param *X264ParamT) SetPass(pass int, statsFile string) error {
+	if pass < 0 || pass > 3 {
+		return fmt.Errorf("libx264: invalid pass %d", pass)
+	}
+	if pass != 0 && statsFile == "" {
+		return errors.New("libx264: multipass requires a stats file")
+	}
+	param.rc.b_stat_write = ffcommon.FInt(pass & 1)
+	param.rc.b_stat_read = ffcommon.FInt(pass >> 1 & 1)
+	param.rc.psz_stat_out = param.cString(statsFile)
+	param.rc.psz_stat_in = param.rc.psz_stat_out
+	return nil
+}
+
+// Pass returns the pass set by SetPass (rc.b_stat_write | rc.b_stat_read<<1).
+func (param *X264ParamT) Pass() int {
+	return int(param.rc.b_stat_write&1) | int(param.rc.b_stat_read&1)<<1
+}
+
+// StatOut returns rc.psz_stat_out.
+func (param *X264ParamT) StatOut() string {
+	return ffcommon.StringFromPtr(param.rc.psz_stat_out)
+}
+
+// StatIn returns rc.psz_stat_in.
+func (param *X264ParamT) StatIn() string {
+	return ffcommon.StringFromPtr(param.rc.psz_stat_in)
+}
+
+// SetBitrate selects average bitrate rate control at kbps kbit/s.
+func (param *X264ParamT) SetBitrate(kbps int) {
+	param.rc.i_rc_method = X264_RC_ABR
+	param.rc.i_bitrate = ffcommon.FInt(kbps)
+}
+
+// FrameTotal returns i_frame_total, the number of frames to encode if known.
+func (param *X264ParamT) FrameTotal() int {
+	return int(param.i_frame_total)
+}
+
+// SetFrameTotal sets i_frame_total.  x264 uses it for progress and the
+// final passes of multipass rate control.
+func (param *X264ParamT) SetFrameTotal(n int) {
+	param.i_frame_total = ffcommon.FInt(n)
+}
+
+// PassProgress is reported by MultiPass after every output frame.
+type PassProgress struct {
+	Pass        int /* 1-based */
+	Passes      int
+	Frames      int /* frames output in this pass */
+	TotalFrames int /* i_frame_total, 0 if unknown */
+	Bytes       int64
+	Elapsed     time.Duration /* since the start of the pass */
+}
+
+// PassInput feeds every picture of the clip to enc.  It is called once per
+// pass and must produce the same pictures each time.
+type PassInput func(pass int, enc *Encoder) error
+
+// MultiPass runs an N-pass average bitrate encode: a first pass writing
+// the stats file (with x264_param_apply_fastfirstpass unless
+// SlowFirstPass), optional middle passes refining it and a final pass
+// reading it.  Only the final pass output reaches the sink.
+type MultiPass struct {
+	Passes        int    /* total number of passes, default 2 */
+	Bitrate       int    /* target kbit/s */
+	StatsFile     string /* default: a temporary file removed by Run */
+	SlowFirstPass bool
+
+	Progress func(p PassProgress)
+}
+
+// Run encodes with a copy of param for every pass.
+func (m *MultiPass) Run(param *X264ParamT, input PassInput, sink Sink) error {
+	passes := m.Passes
+	if passes == 0 {
+		passes = 2
+	}
+	if passes < 2 {
+		sink.Close()
+		return fmt.Errorf("libx264: invalid number of passes %d", passes)
+	}
+	if m.Bitrate <= 0 {
+		sink.Close()
+		return errors.New("libx264: multipass requires a target bitrate")
+	}
+	stats := m.StatsFile
+	if stats == "" {
+		f, err := os.CreateTemp("", "x264-*.stats")
+		if err != nil {
+			sink.Close()
+			return err
+		}
+		stats = f.Name()
+		f.Close()
+		defer removeStats(stats)
+	}
+
+	for pass := 1; pass <= passes; pass++ {
+		mode := 3
+		out := Sink(discardSink{})
+		switch pass {
+		case 1:
+			mode = 1
+		case passes:
+			mode = 2
+			out = sink
+		}
+		p := param.Copy()
+		p.SetBitrate(m.Bitrate)
+		p.SetPass(mode, stats)
+		if pass == 1 && !m.SlowFirstPass {
+			p.X264ParamApplyFastfirstpass()
+		}
+		err := m.run(p, pass, passes, input, out)
+		p.Release()
+		if err != nil {
+			if pass != passes {
+				sink.Close()
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MultiPass) run(param *X264ParamT, pass, passes int, input PassInput, out Sink) error {
+	ps := &progressSink{Sink: out, start: time.Now(), report: m.Progress}
+	ps.p = PassProgress{Pass: pass, Passes: passes, TotalFrames: param.FrameTotal()}
+	enc, err := NewEncoder(param, ps)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	if err = input(pass, enc); err != nil {
+		enc.Close()
+		return err
+	}
+	return enc.Close()
+}
+
+func removeStats(name string) {
+	for _, suffix := range []string{"", ".temp", ".mbtree", ".mbtree.temp"} {
+		os.Remove(name + suffix)
+	}
+}
+
+type progressSink struct {
+	Sink
+	p      PassProgress
+	start  time.Time
+	report func(p PassProgress)
+}
+
+func (s *progressSink) WriteFrame(f *Frame) error {
+	s.p.Frames++
+	for i := range f.Nals {
+		s.p.Bytes += int64(f.Nals[i].IPayload)
+	}
+	if s.report != nil {
+		s.p.Elapsed = time.Since(s.start)
+		s.report(s.p)
+	}
+	return s.Sink.WriteFrame(f)
+}
+
+type discardSink struct{}
+
+func (discardSink) WriteHeaders(nals []X264NalT) error { return nil }
+func (discardSink) WriteFrame(f *Frame) error          { return nil }
+func (discardSink) Close() error                       { return nil }
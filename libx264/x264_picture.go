@@ -0,0 +1,69 @@
+package libx264
+
+import (
+	"fmt"
+
+	"github.com/moonfdd/ffmpeg-go/ffcommon"
+)
+
+// QPMax is the highest quantizer of any bit depth x264 supports (10-bit);
+// the limit of a given encode is X264ParamT.MaxQP.
+const QPMax = 51 + 6*2
+
+// Type returns the picture type: the forced type of an input picture or the
+// X264_TYPE_* the frame was coded as for an output picture.
+func (pic *X264PictureT) Type() ffcommon.FInt {
+	return pic.i_type
+}
+
+// SetType forces the picture type (X264_TYPE_*) of an input picture.
+// x264 does not reset the field, so pictures reused across frames must be
+// set back to X264_TYPE_AUTO afterwards.
+func (pic *X264PictureT) SetType(i_type ffcommon.FInt) {
+	pic.i_type = i_type
+}
+
+// ForceKeyframe forces an IDR for an input picture, e.g. at a scene change
+// or segment boundary.  Like SetType it sticks until reset.
+func (pic *X264PictureT) ForceKeyframe() {
+	pic.i_type = X264_TYPE_IDR
+}
+
+// QP returns the forced quantizer of an input picture, or -1 if x264
+// chooses it (i_qpplus1 == X264_QP_AUTO).
+func (pic *X264PictureT) QP() int {
+	return int(pic.i_qpplus1) - 1
+}
+
+// SetQP forces the quantizer of an input picture.  qpMax is the highest
+// QP allowed by the bit depth, see X264ParamT.MaxQP.  A negative qp
+// restores X264_QP_AUTO.  The value sticks until reset, like SetType.
+func (pic *X264PictureT) SetQP(qp, qpMax int) error {
+	if qp > qpMax {
+		return fmt.Errorf("libx264: QP %d out of range 0-%d", qp, qpMax)
+	}
+	if qp < 0 {
+		pic.i_qpplus1 = X264_QP_AUTO
+		return nil
+	}
+	pic.i_qpplus1 = ffcommon.FInt(qp + 1)
+	return nil
+}
+
+// ResetControls sets the forced type and quantizer of an input picture
+// back to automatic, for pictures reused across Encode calls.
+func (pic *X264PictureT) ResetControls() {
+	pic.i_type = X264_TYPE_AUTO
+	pic.i_qpplus1 = X264_QP_AUTO
+}
+
+// IsKeyframe reports whether an output picture is a keyframe.
+func (pic *X264PictureT) IsKeyframe() bool {
+	return pic.b_keyframe != 0
+}
+
+// Dts returns the decoding timestamp of an output picture, in the encoder
+// timebase.  It may be negative for the first frames when B-frames are used.
+func (pic *X264PictureT) Dts() ffcommon.FInt64T {
+	return pic.i_dts
+}
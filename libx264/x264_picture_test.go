@@ -0,0 +1,39 @@
+package libx264
+
+import (
+	"testing"
+
+	"github.com/moonfdd/ffmpeg-go/ffcommon"
+)
+
+func TestSetQP(t *testing.T) {
+	tests := []struct {
+		name  string
+		depth int
+		qp    int
+		want  int /* QP() afterwards */
+		ok    bool
+	}{
+		{"8-bit", 8, 30, 30, true},
+		{"8-bit max", 8, 51, 51, true},
+		{"8-bit above max", 8, 52, -1, false},
+		{"10-bit max", 10, 63, 63, true},
+		{"10-bit above max", 10, 64, -1, false},
+		{"auto", 8, -1, -1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			param := new(X264ParamT)
+			param.i_bitdepth = ffcommon.FInt(tt.depth)
+			var pic X264PictureT
+			pic.ResetControls()
+			err := pic.SetQP(tt.qp, param.MaxQP())
+			if (err == nil) != tt.ok {
+				t.Fatalf("SetQP(%d): %v", tt.qp, err)
+			}
+			if pic.QP() != tt.want {
+				t.Errorf("QP %d, want %d", pic.QP(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package libx264
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/moonfdd/ffmpeg-go/ffcommon"
+)
+
+// SetQualityMetrics sets analyse.b_psnr and analyse.b_ssim.  x264 only
+// fills in the per-frame PSNR/SSIM when they are enabled; both are off by
+// default and cost some speed.
+func (param *X264ParamT) SetQualityMetrics(psnr, ssim bool) {
+	param.analyse.b_psnr = ffcommon.FInt(bool2int(psnr))
+	param.analyse.b_ssim = ffcommon.FInt(bool2int(ssim))
+}
+
+// QualityMetrics returns analyse.b_psnr and analyse.b_ssim.
+func (param *X264ParamT) QualityMetrics() (psnr, ssim bool) {
+	return param.analyse.b_psnr != 0, param.analyse.b_ssim != 0
+}
+
+// FrameQuality is the quality information x264 returns with an output
+// picture.
+type FrameQuality struct {
+	PSNR    [3]float64 /* Y, U, V in dB, if b_psnr */
+	PSNRAvg float64    /* over all planes, if b_psnr */
+	SSIM    float64    /* luma, if b_ssim */
+	CRFAvg  float64    /* average effective CRF */
+}
+
+// Quality returns the quality information of an output picture.
+func (pic *X264PictureT) Quality() FrameQuality {
+	return FrameQuality{
+		PSNR:    [3]float64{pic.prop.f_psnr[0], pic.prop.f_psnr[1], pic.prop.f_psnr[2]},
+		PSNRAvg: pic.prop.f_psnr_avg,
+		SSIM:    pic.prop.f_ssim,
+		CRFAvg:  pic.prop.f_crf_avg,
+	}
+}
+
+// FrameClass folds X264_TYPE_* into the I, P and B classes the x264 CLI
+// reports: IDR and keyframes count as I, BREF as B.
+func FrameClass(typ int) int {
+	switch typ {
+	case X264_TYPE_IDR, X264_TYPE_I, X264_TYPE_KEYFRAME:
+		return X264_TYPE_I
+	case X264_TYPE_BREF, X264_TYPE_B:
+		return X264_TYPE_B
+	}
+	return X264_TYPE_P
+}
+
+// QualityClassStats accumulates the frames of one class.
+type QualityClassStats struct {
+	Frames  int
+	Bytes   int64
+	PSNR    [3]float64 /* sums */
+	PSNRAvg float64
+	MSE     float64 /* sum of per-frame MSE, for the global PSNR */
+	SSIM    float64
+	CRF     float64
+}
+
+// QualityStats aggregates per-frame quality like the x264 CLI summary.
+type QualityStats struct {
+	PSNR bool /* analyse.b_psnr was set */
+	SSIM bool /* analyse.b_ssim was set */
+
+	All   QualityClassStats
+	Class map[int]*QualityClassStats /* by FrameClass */
+}
+
+// NewQualityStats returns an aggregator for an encoder opened with param.
+func NewQualityStats(param *X264ParamT) *QualityStats {
+	psnr, ssim := param.QualityMetrics()
+	return &QualityStats{PSNR: psnr, SSIM: ssim, Class: make(map[int]*QualityClassStats)}
+}
+
+// Add accounts one output frame.
+func (s *QualityStats) Add(f *Frame) {
+	size := 0
+	for i := range f.Nals {
+		size += int(f.Nals[i].IPayload)
+	}
+	c := s.Class[FrameClass(f.Type)]
+	if c == nil {
+		c = new(QualityClassStats)
+		s.Class[FrameClass(f.Type)] = c
+	}
+	for _, st := range []*QualityClassStats{&s.All, c} {
+		st.Frames++
+		st.Bytes += int64(size)
+		for i := range st.PSNR {
+			st.PSNR[i] += f.Quality.PSNR[i]
+		}
+		st.PSNRAvg += f.Quality.PSNRAvg
+		st.MSE += psnrToMSE(f.Quality.PSNRAvg)
+		st.SSIM += f.Quality.SSIM
+		st.CRF += f.Quality.CRFAvg
+	}
+}
+
+/* MSE relative to a peak of 1, the inverse of x264's psnr() */
+func psnrToMSE(psnr float64) float64 {
+	return math.Pow(10, -psnr/10)
+}
+
+// MeanPSNR returns the mean Y, U, V and average PSNR of the class.
+func (c *QualityClassStats) MeanPSNR() (y, u, v, avg float64) {
+	if c.Frames == 0 {
+		return
+	}
+	n := float64(c.Frames)
+	return c.PSNR[0] / n, c.PSNR[1] / n, c.PSNR[2] / n, c.PSNRAvg / n
+}
+
+// GlobalPSNR returns the PSNR of the mean squared error over all frames.
+func (c *QualityClassStats) GlobalPSNR() float64 {
+	if c.Frames == 0 || c.MSE == 0 {
+		return 0
+	}
+	return -10 * math.Log10(c.MSE/float64(c.Frames))
+}
+
+// MeanSSIM returns the mean luma SSIM and its value in dB.
+func (c *QualityClassStats) MeanSSIM() (ssim, db float64) {
+	if c.Frames == 0 {
+		return
+	}
+	ssim = c.SSIM / float64(c.Frames)
+	if ssim < 1 {
+		db = -10 * math.Log10(1-ssim)
+	} else {
+		db = math.Inf(1)
+	}
+	return
+}
+
+// Kbps returns the bitrate of the class at fps frames per second.
+func (c *QualityClassStats) Kbps(fps float64) float64 {
+	if c.Frames == 0 {
+		return 0
+	}
+	return float64(c.Bytes) * 8 * fps / float64(c.Frames) / 1000
+}
+
+// Report prints the summary in the layout of the x264 CLI.
+func (s *QualityStats) Report(w io.Writer, fps float64) error {
+	for _, t := range []struct {
+		typ  int
+		name string
+	}{{X264_TYPE_I, "I"}, {X264_TYPE_P, "P"}, {X264_TYPE_B, "B"}} {
+		c := s.Class[t.typ]
+		if c == nil || c.Frames == 0 {
+			continue
+		}
+		line := fmt.Sprintf("frame %s:%-5d Avg size:%8d", t.name, c.Frames, c.Bytes/int64(c.Frames))
+		if s.PSNR {
+			y, u, v, avg := c.MeanPSNR()
+			line += fmt.Sprintf("  PSNR Mean Y:%5.2f U:%5.2f V:%5.2f Avg:%5.2f Global:%5.2f", y, u, v, avg, c.GlobalPSNR())
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	if s.SSIM && s.All.Frames > 0 {
+		ssim, db := s.All.MeanSSIM()
+		if _, err := fmt.Fprintf(w, "SSIM Mean Y:%.7f (%6.3fdb)\n", ssim, db); err != nil {
+			return err
+		}
+	}
+	if s.PSNR && s.All.Frames > 0 {
+		y, u, v, avg := s.All.MeanPSNR()
+		_, err := fmt.Fprintf(w, "PSNR Mean Y:%6.3f U:%6.3f V:%6.3f Avg:%6.3f Global:%6.3f kb/s:%.2f\n",
+			y, u, v, avg, s.All.GlobalPSNR(), s.All.Kbps(fps))
+		return err
+	}
+	return nil
+}
+
+type qualitySink struct {
+	Sink
+	s *QualityStats
+}
+
+// QualitySink returns sink adding every frame to stats.
+func QualitySink(sink Sink, stats *QualityStats) Sink {
+	return qualitySink{sink, stats}
+}
+
+func (k qualitySink) WriteFrame(f *Frame) error {
+	k.s.Add(f)
+	return k.Sink.WriteFrame(f)
+}
@@ -0,0 +1,101 @@
+package libx264
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/moonfdd/ffmpeg-go/ffcommon"
+)
+
+func TestFrameClass(t *testing.T) {
+	tests := []struct{ typ, class int }{
+		{X264_TYPE_IDR, X264_TYPE_I}, {X264_TYPE_I, X264_TYPE_I}, {X264_TYPE_KEYFRAME, X264_TYPE_I},
+		{X264_TYPE_P, X264_TYPE_P}, {X264_TYPE_BREF, X264_TYPE_B}, {X264_TYPE_B, X264_TYPE_B},
+	}
+	for _, tt := range tests {
+		if got := FrameClass(tt.typ); got != tt.class {
+			t.Errorf("FrameClass(%d) = %d, want %d", tt.typ, got, tt.class)
+		}
+	}
+}
+
+func TestQualityStats(t *testing.T) {
+	frame := func(typ, size int, y, avg, ssim float64) *Frame {
+		return &Frame{
+			Type:    typ,
+			Nals:    []X264NalT{{IPayload: ffcommon.FInt(size)}},
+			Quality: FrameQuality{PSNR: [3]float64{y, 45, 46}, PSNRAvg: avg, SSIM: ssim, CRFAvg: 23},
+		}
+	}
+	param := new(X264ParamT)
+	param.SetQualityMetrics(true, true)
+	s := NewQualityStats(param)
+	for _, f := range []*Frame{
+		frame(X264_TYPE_IDR, 3000, 32, 30, 0.9),
+		frame(X264_TYPE_P, 1000, 42, 40, 0.99),
+		frame(X264_TYPE_B, 200, 42, 40, 0.99),
+		frame(X264_TYPE_BREF, 600, 32, 30, 0.9),
+	} {
+		s.Add(f)
+	}
+
+	near := func(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+	tests := []struct {
+		name   string
+		c      *QualityClassStats
+		frames int
+		y, avg float64
+		global float64 /* -10*log10 of the mean of 10^(-avg/10) */
+		kbps   float64 /* at 25 fps */
+	}{
+		{"all", &s.All, 4, 37, 35, -10 * math.Log10(0.00055), 4800 * 8 * 25 / 4 / 1000.0},
+		{"I", s.Class[X264_TYPE_I], 1, 32, 30, 30, 600},
+		{"P", s.Class[X264_TYPE_P], 1, 42, 40, 40, 200},
+		{"B", s.Class[X264_TYPE_B], 2, 37, 35, -10 * math.Log10(0.00055), 80},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.c == nil || tt.c.Frames != tt.frames {
+				t.Fatalf("stats %+v, want %d frames", tt.c, tt.frames)
+			}
+			y, u, v, avg := tt.c.MeanPSNR()
+			if !near(y, tt.y) || !near(u, 45) || !near(v, 46) || !near(avg, tt.avg) {
+				t.Errorf("mean PSNR %g %g %g %g", y, u, v, avg)
+			}
+			if g := tt.c.GlobalPSNR(); !near(g, tt.global) {
+				t.Errorf("global PSNR %g, want %g", g, tt.global)
+			}
+			if k := tt.c.Kbps(25); !near(k, tt.kbps) {
+				t.Errorf("%g kb/s, want %g", k, tt.kbps)
+			}
+		})
+	}
+
+	if ssim, db := s.All.MeanSSIM(); !near(ssim, 0.945) || !near(db, -10*math.Log10(0.055)) {
+		t.Errorf("mean SSIM %g (%g dB)", ssim, db)
+	}
+	if _, db := (&QualityClassStats{Frames: 1, SSIM: 1}).MeanSSIM(); !math.IsInf(db, 1) {
+		t.Errorf("perfect SSIM %g dB", db)
+	}
+	var empty QualityClassStats
+	if y, _, _, _ := empty.MeanPSNR(); y != 0 || empty.GlobalPSNR() != 0 || empty.Kbps(25) != 0 {
+		t.Error("empty class has statistics")
+	}
+
+	var out bytes.Buffer
+	if err := s.Report(&out, 25); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"frame I:1     Avg size:    3000  PSNR Mean Y:32.00 U:45.00 V:46.00 Avg:30.00 Global:30.00",
+		"frame B:2     Avg size:     400  PSNR Mean Y:37.00 U:45.00 V:46.00 Avg:35.00 Global:32.60",
+		"SSIM Mean Y:0.9450000 (12.596db)",
+		"PSNR Mean Y:37.000 U:45.000 V:46.000 Avg:35.000 Global:32.596 kb/s:240.00",
+	} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("report lacks %q:\n%s", line, out.String())
+		}
+	}
+}
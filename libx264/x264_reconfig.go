@@ -0,0 +1,160 @@
+package libx264
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/moonfdd/ffmpeg-go/ffcommon"
+)
+
+// ReconfigFields lists the x264_param_t fields x264_encoder_reconfig
+// copies into a running encoder; everything else is ignored.
+//
+// The rate control method cannot change.  VBV fields (and rc.i_bitrate,
+// which x264 copies together with them) are only taken if VBV was enabled
+// when the encoder was opened and stays enabled.
+var ReconfigFields = []string{
+	"i_frame_reference", "i_bframe_bias", "i_scenecut_threshold",
+	"b_deblocking_filter", "i_deblocking_filter_alphac0", "i_deblocking_filter_beta",
+	"i_slice_max_size", "i_slice_max_mbs", "i_slice_min_mbs", "i_slice_count", "i_slice_count_max",
+	"analyse.*",
+	"rc.f_rf_constant", "rc.f_rf_constant_max",
+	"rc.i_vbv_max_bitrate", "rc.i_vbv_buffer_size", "rc.i_bitrate",
+}
+
+var ErrNotReconfigurable = errors.New("libx264: parameter cannot be changed on this encoder")
+
+// RCMethod returns rc.i_rc_method (X264_RC_*).
+func (param *X264ParamT) RCMethod() int {
+	return int(param.rc.i_rc_method)
+}
+
+// Bitrate returns rc.i_bitrate in kbit/s.
+func (param *X264ParamT) Bitrate() int {
+	return int(param.rc.i_bitrate)
+}
+
+// CRF returns rc.f_rf_constant.
+func (param *X264ParamT) CRF() float32 {
+	return float32(param.rc.f_rf_constant)
+}
+
+// SetCRF selects constant rate factor rate control.
+func (param *X264ParamT) SetCRF(crf float32) {
+	param.rc.i_rc_method = X264_RC_CRF
+	param.rc.f_rf_constant = ffcommon.FFloat(crf)
+}
+
+// VBV returns rc.i_vbv_max_bitrate and rc.i_vbv_buffer_size in kbit/s and
+// kbit.
+func (param *X264ParamT) VBV() (maxBitrate, bufferSize int) {
+	return int(param.rc.i_vbv_max_bitrate), int(param.rc.i_vbv_buffer_size)
+}
+
+// SetVBV sets rc.i_vbv_max_bitrate and rc.i_vbv_buffer_size.
+func (param *X264ParamT) SetVBV(maxBitrate, bufferSize int) {
+	param.rc.i_vbv_max_bitrate = ffcommon.FInt(maxBitrate)
+	param.rc.i_vbv_buffer_size = ffcommon.FInt(bufferSize)
+}
+
+func (param *X264ParamT) vbvEnabled() bool {
+	return param.rc.i_vbv_max_bitrate > 0 && param.rc.i_vbv_buffer_size > 0
+}
+
+// Parameters returns the current parameters of the encoder
+// (x264_encoder_parameters).  Pointers in the result reference encoder
+// memory: the param must not be passed to x264_param_cleanup.
+func (e *Encoder) Parameters() (*X264ParamT, error) {
+	if e.closed {
+		return nil, ErrEncoderClosed
+	}
+	param := new(X264ParamT)
+	e.h.X264EncoderParameters(param)
+	return param, nil
+}
+
+// Reconfig applies param with x264_encoder_reconfig, see ReconfigFields.
+// It takes effect on the next frame x264 encodes, which because of the
+// lookahead may not be the next frame passed to Encode.  Like NewEncoder it
+// takes over the Go memory param references.  It must not be called
+// concurrently with Encode.
+func (e *Encoder) Reconfig(param *X264ParamT) error {
+	if e.closed {
+		return ErrEncoderClosed
+	}
+	if ret := e.h.X264EncoderReconfig(param); ret < 0 {
+		return fmt.Errorf("libx264: x264_encoder_reconfig failed (%d)", ret)
+	}
+	e.keep = append(e.keep, param.take()...)
+	return nil
+}
+
+// SetBitrate changes the average bitrate and the VBV of a running encoder,
+// all in kbit/s (bufferSize in kbit), see ReconfigBitrate.  As with
+// Reconfig the change is applied with the next frame x264 encodes, so
+// Parameters reports the old values until then.
+func (e *Encoder) SetBitrate(bitrate, maxBitrate, bufferSize int) error {
+	param, err := e.Parameters()
+	if err != nil {
+		return err
+	}
+	if err = param.ReconfigBitrate(bitrate, maxBitrate, bufferSize); err != nil {
+		return err
+	}
+	return e.Reconfig(param)
+}
+
+// ReconfigBitrate applies a bitrate and VBV change to param, the current
+// parameters of a running encoder.  The encoder must have been opened with
+// VBV; bitrate is ignored in CRF mode and may then be 0.
+func (param *X264ParamT) ReconfigBitrate(bitrate, maxBitrate, bufferSize int) error {
+	if !param.vbvEnabled() {
+		return fmt.Errorf("%w: VBV was not enabled at open", ErrNotReconfigurable)
+	}
+	if maxBitrate <= 0 || bufferSize <= 0 {
+		return fmt.Errorf("libx264: invalid VBV %d/%d", maxBitrate, bufferSize)
+	}
+	switch param.rc.i_rc_method {
+	case X264_RC_ABR:
+		if bitrate <= 0 {
+			return fmt.Errorf("libx264: invalid bitrate %d", bitrate)
+		}
+		if bitrate > maxBitrate {
+			return fmt.Errorf("libx264: bitrate %d above VBV max bitrate %d", bitrate, maxBitrate)
+		}
+		param.rc.i_bitrate = ffcommon.FInt(bitrate)
+	case X264_RC_CRF:
+	default:
+		return fmt.Errorf("%w: constant QP", ErrNotReconfigurable)
+	}
+	param.SetVBV(maxBitrate, bufferSize)
+	return nil
+}
+
+// SetCRF changes the rate factor of a running CRF encoder, see
+// ReconfigCRF.  Like SetBitrate it is applied with the next frame x264
+// encodes.
+func (e *Encoder) SetCRF(crf float32) error {
+	param, err := e.Parameters()
+	if err != nil {
+		return err
+	}
+	if err = param.ReconfigCRF(crf); err != nil {
+		return err
+	}
+	return e.Reconfig(param)
+}
+
+// ReconfigCRF applies a rate factor change to param, the current
+// parameters of a running CRF encoder.  Bit depths beyond 8 extend the
+// range below 0 by QP_BD_OFFSET.
+func (param *X264ParamT) ReconfigCRF(crf float32) error {
+	if param.rc.i_rc_method != X264_RC_CRF {
+		return fmt.Errorf("%w: not in CRF mode", ErrNotReconfigurable)
+	}
+	if min := -param.qpBDOffset(); crf < float32(min) || crf > 51 {
+		return fmt.Errorf("libx264: CRF %g out of range %d-51", crf, min)
+	}
+	param.rc.f_rf_constant = ffcommon.FFloat(crf)
+	return nil
+}
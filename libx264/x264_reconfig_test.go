@@ -0,0 +1,82 @@
+package libx264
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/moonfdd/ffmpeg-go/ffcommon"
+)
+
+func TestReconfigBitrate(t *testing.T) {
+	tests := []struct {
+		name                string
+		method              ffcommon.FInt
+		vbvMax, vbvBuf      int
+		bitrate, max, buf   int
+		ok, notReconfigured bool
+	}{
+		{"abr", X264_RC_ABR, 2000, 2000, 1500, 1500, 1500, true, false},
+		{"abr increase", X264_RC_ABR, 2000, 2000, 3000, 3000, 1500, true, false},
+		{"abr above max", X264_RC_ABR, 2000, 2000, 2500, 2000, 2000, false, false},
+		{"abr zero bitrate", X264_RC_ABR, 2000, 2000, 0, 2000, 2000, false, false},
+		{"crf ignores bitrate", X264_RC_CRF, 2000, 2000, 0, 1000, 1000, true, false},
+		{"invalid vbv", X264_RC_ABR, 2000, 2000, 1000, 1000, 0, false, false},
+		{"no vbv at open", X264_RC_ABR, 0, 0, 1000, 1000, 1000, false, true},
+		{"constant qp", X264_RC_CQP, 2000, 2000, 1000, 1000, 1000, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			param := new(X264ParamT)
+			param.rc.i_rc_method = tt.method
+			param.rc.i_bitrate = 2000
+			param.SetVBV(tt.vbvMax, tt.vbvBuf)
+			err := param.ReconfigBitrate(tt.bitrate, tt.max, tt.buf)
+			if (err == nil) != tt.ok || errors.Is(err, ErrNotReconfigurable) != tt.notReconfigured {
+				t.Fatalf("ReconfigBitrate: %v", err)
+			}
+			wantBitrate, wantMax, wantBuf := 2000, tt.vbvMax, tt.vbvBuf
+			if tt.ok {
+				wantMax, wantBuf = tt.max, tt.buf
+				if tt.method == X264_RC_ABR {
+					wantBitrate = tt.bitrate
+				}
+			}
+			m, b := param.VBV()
+			if param.Bitrate() != wantBitrate || m != wantMax || b != wantBuf {
+				t.Errorf("bitrate %d VBV %d/%d, want %d %d/%d", param.Bitrate(), m, b, wantBitrate, wantMax, wantBuf)
+			}
+		})
+	}
+}
+
+func TestReconfigCRF(t *testing.T) {
+	tests := []struct {
+		name   string
+		method ffcommon.FInt
+		depth  int
+		crf    float32
+		ok     bool
+	}{
+		{"8-bit", X264_RC_CRF, 8, 23, true},
+		{"8-bit max", X264_RC_CRF, 8, 51, true},
+		{"8-bit negative", X264_RC_CRF, 8, -1, false},
+		{"10-bit negative", X264_RC_CRF, 10, -12, true},
+		{"10-bit below range", X264_RC_CRF, 10, -12.5, false},
+		{"above 51", X264_RC_CRF, 10, 51.5, false},
+		{"not crf", X264_RC_ABR, 8, 23, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			param := new(X264ParamT)
+			param.rc.i_rc_method = tt.method
+			param.i_bitdepth = ffcommon.FInt(tt.depth)
+			err := param.ReconfigCRF(tt.crf)
+			if (err == nil) != tt.ok {
+				t.Fatalf("ReconfigCRF(%g): %v", tt.crf, err)
+			}
+			if tt.ok && param.CRF() != tt.crf {
+				t.Errorf("CRF %g, want %g", param.CRF(), tt.crf)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package libx264
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+// QuantOffsets is a per-macroblock quantizer offset map (prop.quant_offsets)
+// in raster order.  Negative offsets spend more bits, positive ones fewer.
+// x264 only applies it when adaptive quantization is enabled.
+type QuantOffsets struct {
+	MbWidth  int
+	MbHeight int
+	Offsets  []float32
+}
+
+// ROI is a region of interest in luma pixels and its quantizer offset.
+type ROI struct {
+	Rect   image.Rectangle
+	Offset float32
+}
+
+// NewQuantOffsets returns a zero map for a width x height picture.  Like
+// x264, sizes are rounded up to whole macroblocks, and interlaced heights
+// to pairs of them.
+func NewQuantOffsets(width, height int, interlaced bool) *QuantOffsets {
+	mbh := (height + 15) / 16
+	if interlaced {
+		mbh = (height + 31) / 32 * 2
+	}
+	q := &QuantOffsets{MbWidth: (width + 15) / 16, MbHeight: mbh}
+	q.Offsets = make([]float32, q.MbWidth*q.MbHeight)
+	return q
+}
+
+// NewQuantOffsets returns a zero map matching the encoder's picture size.
+func (e *Encoder) NewQuantOffsets() (*QuantOffsets, error) {
+	param, err := e.Parameters()
+	if err != nil {
+		return nil, err
+	}
+	return NewQuantOffsets(int(param.IWidth), int(param.IHeight), param.b_interlaced != 0), nil
+}
+
+// Fill sets every macroblock to offset.
+func (q *QuantOffsets) Fill(offset float32) {
+	for i := range q.Offsets {
+		q.Offsets[i] = offset
+	}
+}
+
+// AddRect adds offset to every macroblock touched by r (in luma pixels).
+func (q *QuantOffsets) AddRect(r image.Rectangle, offset float32) {
+	q.rect(r, func(v *float32) { *v += offset })
+}
+
+// SetRect sets every macroblock touched by r (in luma pixels) to offset.
+func (q *QuantOffsets) SetRect(r image.Rectangle, offset float32) {
+	q.rect(r, func(v *float32) { *v = offset })
+}
+
+func (q *QuantOffsets) rect(r image.Rectangle, f func(v *float32)) {
+	mbs := image.Rect(r.Min.X/16, r.Min.Y/16, (r.Max.X+15)/16, (r.Max.Y+15)/16).
+		Intersect(image.Rect(0, 0, q.MbWidth, q.MbHeight))
+	for y := mbs.Min.Y; y < mbs.Max.Y; y++ {
+		for x := mbs.Min.X; x < mbs.Max.X; x++ {
+			f(&q.Offsets[y*q.MbWidth+x])
+		}
+	}
+}
+
+// Validate checks the size of the map and that offsets are finite and
+// within +-QPMax.
+func (q *QuantOffsets) Validate() error {
+	if q.MbWidth <= 0 || q.MbHeight <= 0 || len(q.Offsets) != q.MbWidth*q.MbHeight {
+		return fmt.Errorf("libx264: quant offsets: %d values for %dx%d macroblocks", len(q.Offsets), q.MbWidth, q.MbHeight)
+	}
+	for i, v := range q.Offsets {
+		if math.IsNaN(float64(v)) || v < -QPMax || v > QPMax {
+			return fmt.Errorf("libx264: quant offsets: invalid offset %g at macroblock %d", v, i)
+		}
+	}
+	return nil
+}
+
+// SetQuantOffsets attaches q to an input picture; nil detaches it.  x264
+// reads the map during the next Encode only, and the picture keeps q
+// reachable, so no free callback is needed.  The map stays attached until
+// replaced, so reused pictures keep their offsets.
+func (pic *X264PictureT) SetQuantOffsets(q *QuantOffsets) error {
+	if q == nil {
+		pic.prop.quant_offsets = nil
+		pic.prop.quant_offsets_free = 0
+		return nil
+	}
+	if err := q.Validate(); err != nil {
+		return err
+	}
+	pic.prop.quant_offsets = &q.Offsets[0]
+	pic.prop.quant_offsets_free = 0
+	return nil
+}
+
+// SetROI builds a map for a width x height progressive picture from rois,
+// overlapping regions adding up, and attaches it to the picture.
+func (pic *X264PictureT) SetROI(width, height int, rois ...ROI) error {
+	if len(rois) == 0 {
+		return pic.SetQuantOffsets(nil)
+	}
+	q := NewQuantOffsets(width, height, false)
+	for _, r := range rois {
+		q.AddRect(r.Rect, r.Offset)
+	}
+	return pic.SetQuantOffsets(q)
+}
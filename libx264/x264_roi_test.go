@@ -0,0 +1,83 @@
+package libx264
+
+import (
+	"image"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestQuantOffsets(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		interlaced    bool
+		rois          []ROI
+		mbw, mbh      int
+		want          []float32
+	}{
+		{"round up", 40, 20, false, nil, 3, 2, []float32{0, 0, 0, 0, 0, 0}},
+		{"interlaced pairs", 40, 20, true, nil, 3, 2, []float32{0, 0, 0, 0, 0, 0}},
+		{"interlaced odd rows", 32, 40, true, nil, 2, 4, []float32{0, 0, 0, 0, 0, 0, 0, 0}},
+		{"partial macroblocks", 48, 32, false, []ROI{{image.Rect(10, 10, 20, 17), -4}}, 3, 2,
+			[]float32{-4, -4, 0, -4, -4, 0}},
+		{"overlap adds", 48, 32, false, []ROI{{image.Rect(0, 0, 32, 16), -2}, {image.Rect(16, 0, 48, 32), 3}}, 3, 2,
+			[]float32{-2, 1, 3, 0, 3, 3}},
+		{"clipped", 32, 32, false, []ROI{{image.Rect(-50, 20, 100, 200), 5}}, 2, 2,
+			[]float32{0, 0, 5, 5}},
+		{"outside", 32, 32, false, []ROI{{image.Rect(40, 40, 80, 80), 5}}, 2, 2,
+			[]float32{0, 0, 0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewQuantOffsets(tt.width, tt.height, tt.interlaced)
+			for _, r := range tt.rois {
+				q.AddRect(r.Rect, r.Offset)
+			}
+			if q.MbWidth != tt.mbw || q.MbHeight != tt.mbh || !reflect.DeepEqual(q.Offsets, tt.want) {
+				t.Errorf("%dx%d %v, want %dx%d %v", q.MbWidth, q.MbHeight, q.Offsets, tt.mbw, tt.mbh, tt.want)
+			}
+			if err := q.Validate(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	q := NewQuantOffsets(32, 32, false)
+	q.Fill(2)
+	q.SetRect(image.Rect(16, 16, 17, 17), -1)
+	if want := []float32{2, 2, 2, -1}; !reflect.DeepEqual(q.Offsets, want) {
+		t.Errorf("Fill and SetRect: %v, want %v", q.Offsets, want)
+	}
+}
+
+func TestQuantOffsetsValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		q    QuantOffsets
+		ok   bool
+	}{
+		{"limits", QuantOffsets{1, 2, []float32{-QPMax, QPMax}}, true},
+		{"short", QuantOffsets{2, 2, []float32{0, 0, 0}}, false},
+		{"empty", QuantOffsets{0, 0, nil}, false},
+		{"nan", QuantOffsets{1, 1, []float32{float32(math.NaN())}}, false},
+		{"infinite", QuantOffsets{1, 1, []float32{float32(math.Inf(-1))}}, false},
+		{"above qp max", QuantOffsets{1, 1, []float32{QPMax + 1}}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.q.Validate(); (err == nil) != tt.ok {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+
+	var pic X264PictureT
+	if err := pic.SetROI(32, 32, ROI{image.Rect(0, 0, 16, 16), -3}); err != nil || pic.prop.quant_offsets == nil {
+		t.Errorf("SetROI: %v", err)
+	}
+	if err := pic.SetQuantOffsets(&QuantOffsets{1, 1, []float32{100}}); err == nil {
+		t.Error("out of range map attached")
+	}
+	if err := pic.SetROI(32, 32); err != nil || pic.prop.quant_offsets != nil {
+		t.Errorf("SetROI without regions: %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package libx264
+
+import (
+	"errors"
+	"unsafe"
+
+	"github.com/moonfdd/ffmpeg-go/ffcommon"
+)
+
+// SEI payload types (H.264 Annex D) usable in extra_sei.
+const (
+	SEI_USER_DATA_REGISTERED   = 4 /* user_data_registered_itu_t_t35 */
+	SEI_USER_DATA_UNREGISTERED = 5
+)
+
+// SEIPayload is one user SEI message.  Data is the payload without the
+// SEI type/size header and without emulation prevention; x264 adds both.
+type SEIPayload struct {
+	Type int
+	Data []byte
+}
+
+var ErrSEIPayload = errors.New("libx264: empty SEI payload")
+
+// UserDataUnregistered returns a user_data_unregistered SEI: a UUID
+// identifying the format followed by data.
+func UserDataUnregistered(uuid [16]byte, data []byte) SEIPayload {
+	return SEIPayload{Type: SEI_USER_DATA_UNREGISTERED, Data: append(uuid[:], data...)}
+}
+
+// UserDataRegisteredT35 returns a user_data_registered_itu_t_t35 SEI.
+// countryCode 0xff must be followed by countryCodeExtension, which is
+// ignored otherwise.  data starts with the terminal provider code.
+func UserDataRegisteredT35(countryCode, countryCodeExtension byte, data []byte) SEIPayload {
+	b := []byte{countryCode}
+	if countryCode == 0xff {
+		b = append(b, countryCodeExtension)
+	}
+	return SEIPayload{Type: SEI_USER_DATA_REGISTERED, Data: append(b, data...)}
+}
+
+// cc_type values of CEA-708 cc_data.
+const (
+	CCTypeNTSCField1 = 0 /* CEA-608 field 1 */
+	CCTypeNTSCField2 = 1 /* CEA-608 field 2 */
+	CCTypeDTVCCData  = 2 /* CEA-708 packet data */
+	CCTypeDTVCCStart = 3 /* CEA-708 packet start */
+)
+
+// CCData is one cc_data construct: a pair of caption bytes.
+type CCData struct {
+	Valid bool
+	Type  byte /* CCType* */
+	Data  [2]byte
+}
+
+// CEA708 returns the ATSC A/53 caption SEI carrying cc (at most 31
+// constructs): T.35 country 0xb5, provider 0x0031, "GA94", cc_data.
+func CEA708(cc []CCData) SEIPayload {
+	if len(cc) > 31 {
+		cc = cc[:31]
+	}
+	b := []byte{
+		0x00, 0x31, /* ATSC provider code */
+		'G', 'A', '9', '4',
+		0x03,                 /* user_data_type_code: cc_data */
+		0x40 | byte(len(cc)), /* process_cc_data_flag, cc_count */
+		0xff,                 /* em_data */
+	}
+	for _, c := range cc {
+		v := byte(0xf8 | c.Type&3)
+		if c.Valid {
+			v |= 0x04
+		}
+		b = append(b, v, c.Data[0], c.Data[1])
+	}
+	b = append(b, 0xff) /* marker_bits */
+	return UserDataRegisteredT35(0xb5, 0, b)
+}
+
+// CEA608 wraps CEA-608 byte pairs for one field (1 or 2) in a CEA708
+// caption SEI.  The pairs must carry their odd parity bits.
+func CEA608(field int, pairs [][2]byte) SEIPayload {
+	typ := byte(CCTypeNTSCField1)
+	if field == 2 {
+		typ = CCTypeNTSCField2
+	}
+	cc := make([]CCData, len(pairs))
+	for i, p := range pairs {
+		cc[i] = CCData{Valid: true, Type: typ, Data: p}
+	}
+	return CEA708(cc)
+}
+
+// SetSEI attaches user SEI payloads to an input picture (extra_sei); no
+// payloads detaches them.  The payloads are copied into Go memory that
+// Encoder.Encode keeps until the frame leaves the encoder, and the
+// picture is detached by Encode so reused pictures do not repeat them.
+func (pic *X264PictureT) SetSEI(payloads ...SEIPayload) error {
+	pic.extra_sei = X264SeiT{}
+	if len(payloads) == 0 {
+		return nil
+	}
+	sp := make([]X264SeiPayloadT, len(payloads))
+	for i, p := range payloads {
+		if len(p.Data) == 0 {
+			return ErrSEIPayload
+		}
+		data := append([]byte(nil), p.Data...)
+		sp[i] = X264SeiPayloadT{
+			payload_size: ffcommon.FInt(len(data)),
+			payload_type: ffcommon.FInt(p.Type),
+			payload:      &data[0],
+		}
+	}
+	pic.extra_sei.NumPayloads = ffcommon.FInt(len(sp))
+	pic.extra_sei.Payloads = &sp[0]
+	return nil
+}
+
+// SEI returns the payloads attached to an input picture.
+func (pic *X264PictureT) SEI() []SEIPayload {
+	sp := seiPayloads(&pic.extra_sei)
+	payloads := make([]SEIPayload, len(sp))
+	for i := range sp {
+		payloads[i] = SEIPayload{
+			Type: int(sp[i].payload_type),
+			Data: append([]byte(nil), ffcommon.ByteSliceFromByteP(sp[i].payload, int(sp[i].payload_size))...),
+		}
+	}
+	return payloads
+}
+
+func seiPayloads(sei *X264SeiT) []X264SeiPayloadT {
+	if sei.Payloads == nil || sei.NumPayloads <= 0 {
+		return nil
+	}
+	var sh struct {
+		Data *X264SeiPayloadT
+		Len  int
+		Cap  int
+	}
+	sh.Data = sei.Payloads
+	sh.Len = int(sei.NumPayloads)
+	sh.Cap = sh.Len
+	return *(*[]X264SeiPayloadT)(unsafe.Pointer(&sh))
+}
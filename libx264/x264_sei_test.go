@@ -0,0 +1,80 @@
+package libx264
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestCEA708(t *testing.T) {
+	header := []byte{0xb5, 0x00, 0x31, 'G', 'A', '9', '4', 0x03}
+	tests := []struct {
+		name string
+		sei  SEIPayload
+		want []byte /* after the header: cc_count byte, em_data, constructs, marker */
+	}{
+		{"608 field 1", CEA608(1, [][2]byte{{0x94, 0x2c}, {0x94, 0x2c}}),
+			[]byte{0x42, 0xff, 0xfc, 0x94, 0x2c, 0xfc, 0x94, 0x2c, 0xff}},
+		{"608 field 2", CEA608(2, [][2]byte{{0x15, 0x2c}}),
+			[]byte{0x41, 0xff, 0xfd, 0x15, 0x2c, 0xff}},
+		{"708 packet", CEA708([]CCData{
+			{Valid: true, Type: CCTypeDTVCCStart, Data: [2]byte{0x02, 0x21}},
+			{Valid: true, Type: CCTypeDTVCCData, Data: [2]byte{0x41, 0x42}},
+			{Type: CCTypeDTVCCData},
+		}), []byte{0x43, 0xff, 0xff, 0x02, 0x21, 0xfe, 0x41, 0x42, 0xfa, 0x00, 0x00, 0xff}},
+		{"empty", CEA708(nil), []byte{0x40, 0xff, 0xff}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := append(append([]byte(nil), header...), tt.want...)
+			if tt.sei.Type != SEI_USER_DATA_REGISTERED || !bytes.Equal(tt.sei.Data, want) {
+				t.Errorf("type %d\n%x\nwant\n%x", tt.sei.Type, tt.sei.Data, want)
+			}
+		})
+	}
+
+	/* cc_count has 5 bits */
+	sei := CEA708(make([]CCData, 40))
+	if sei.Data[8] != 0x5f || len(sei.Data) != len(header)+2+31*3+1 {
+		t.Errorf("40 constructs: cc_count byte %#x, %d bytes", sei.Data[8], len(sei.Data))
+	}
+}
+
+func TestUserDataSEI(t *testing.T) {
+	uuid := [16]byte{0xdc, 0x45, 0xe9, 0xbd}
+	tests := []struct {
+		name string
+		sei  SEIPayload
+		typ  int
+		want []byte
+	}{
+		{"unregistered", UserDataUnregistered(uuid, []byte("x264")), SEI_USER_DATA_UNREGISTERED,
+			append(append([]byte(nil), uuid[:]...), 'x', '2', '6', '4')},
+		{"t35", UserDataRegisteredT35(0xb5, 0x12, []byte{0, 0x3c}), SEI_USER_DATA_REGISTERED,
+			[]byte{0xb5, 0, 0x3c}},
+		{"t35 extension", UserDataRegisteredT35(0xff, 0x12, []byte{1}), SEI_USER_DATA_REGISTERED,
+			[]byte{0xff, 0x12, 1}},
+	}
+	for _, tt := range tests {
+		if tt.sei.Type != tt.typ || !bytes.Equal(tt.sei.Data, tt.want) {
+			t.Errorf("%s: type %d %x, want %d %x", tt.name, tt.sei.Type, tt.sei.Data, tt.typ, tt.want)
+		}
+	}
+
+	var pic X264PictureT
+	cc := CEA608(1, [][2]byte{{0x80, 0x80}})
+	data := []byte{1, 2, 3}
+	if err := pic.SetSEI(cc, SEIPayload{Type: 6, Data: data}); err != nil {
+		t.Fatal(err)
+	}
+	data[0] = 0 /* SetSEI copied the data */
+	if got := pic.SEI(); !reflect.DeepEqual(got, []SEIPayload{cc, {Type: 6, Data: []byte{1, 2, 3}}}) {
+		t.Errorf("SEI() = %v", got)
+	}
+	if err := pic.SetSEI(SEIPayload{Type: SEI_USER_DATA_UNREGISTERED}); err != ErrSEIPayload {
+		t.Errorf("empty payload: %v", err)
+	}
+	if err := pic.SetSEI(); err != nil || len(pic.SEI()) != 0 {
+		t.Errorf("detach: %v %v", err, pic.SEI())
+	}
+}
@@ -0,0 +1,199 @@
+package libx264
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+)
+
+// Frame is one encoded picture handed to a Sink.
+type Frame struct {
+	/* NALs of the picture.  They alias x264 memory and are only valid
+	 * during the WriteFrame call; sinks must copy what they keep. */
+	Nals     []X264NalT
+	Pts      int64
+	Dts      int64
+	Keyframe bool
+	Type     int /* X264_TYPE_* the frame was coded as */
+
+	/* mb_info flags attached to the input picture, updated by x264 when
+	 * analyse.b_mb_info_update is set; nil if none were attached */
+	MbInfo []byte
+
+	Quality FrameQuality
+
+	HRD HRDTiming /* if i_nal_hrd is set */
+}
+
+// Sink consumes the bitstream produced by an Encoder.
+//
+// WriteHeaders is called once, before the first frame, with the SPS, PPS
+// and SEI returned by x264_encoder_headers.  WriteFrame is called for every
+// picture leaving the encoder, in decoding order.  Close is called once by
+// Encoder.Close after the encoder has been flushed.
+type Sink interface {
+	WriteHeaders(nals []X264NalT) error
+	WriteFrame(f *Frame) error
+	Close() error
+}
+
+// AnnexBSink writes a raw Annex-B H.264 elementary stream, adding start
+// codes itself if x264 was set up with b_annexb off.
+// Parameter sets already written by WriteHeaders are not repeated for the
+// first frame.
+type AnnexBSink struct {
+	w       *bufio.Writer
+	c       io.Closer
+	headers [][]byte
+	dedup   bool
+	buf     []byte
+}
+
+// NewAnnexBSink returns a sink writing to w.  If w is an io.Closer it is
+// closed by Close.
+func NewAnnexBSink(w io.Writer) *AnnexBSink {
+	s := &AnnexBSink{w: bufio.NewWriter(w)}
+	if c, ok := w.(io.Closer); ok {
+		s.c = c
+	}
+	return s
+}
+
+// NewAnnexBFileSink creates (or truncates) the file at path.
+func NewAnnexBFileSink(path string) (*AnnexBSink, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewAnnexBSink(f), nil
+}
+
+func (s *AnnexBSink) WriteHeaders(nals []X264NalT) error {
+	for i := range nals {
+		p := nals[i].AppendAnnexB(nil)
+		s.headers = append(s.headers, p)
+		if _, err := s.w.Write(p); err != nil {
+			return err
+		}
+	}
+	s.dedup = true
+	return nil
+}
+
+func (s *AnnexBSink) WriteFrame(f *Frame) error {
+	for i := range f.Nals {
+		s.buf = f.Nals[i].AppendAnnexB(s.buf[:0])
+		if s.dedup && s.isHeader(s.buf) {
+			continue
+		}
+		if _, err := s.w.Write(s.buf); err != nil {
+			return err
+		}
+	}
+	s.dedup = false
+	s.headers = nil
+	return nil
+}
+
+func (s *AnnexBSink) isHeader(p []byte) bool {
+	for _, h := range s.headers {
+		if bytes.Equal(h, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *AnnexBSink) Close() error {
+	err := s.w.Flush()
+	if s.c != nil {
+		if cerr := s.c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// MemoryFrame is a copied Frame kept by MemorySink.
+type MemoryFrame struct {
+	Data     []byte /* Annex-B NAL units */
+	Pts      int64
+	Dts      int64
+	Keyframe bool
+	Type     int
+}
+
+// MemorySink keeps the whole stream in memory.
+type MemorySink struct {
+	Headers []byte
+	Frames  []MemoryFrame
+	Closed  bool
+}
+
+func (s *MemorySink) WriteHeaders(nals []X264NalT) error {
+	for i := range nals {
+		s.Headers = nals[i].AppendAnnexB(s.Headers)
+	}
+	return nil
+}
+
+func (s *MemorySink) WriteFrame(f *Frame) error {
+	mf := MemoryFrame{Pts: f.Pts, Dts: f.Dts, Keyframe: f.Keyframe, Type: f.Type}
+	for i := range f.Nals {
+		mf.Data = f.Nals[i].AppendAnnexB(mf.Data)
+	}
+	s.Frames = append(s.Frames, mf)
+	return nil
+}
+
+func (s *MemorySink) Close() error {
+	s.Closed = true
+	return nil
+}
+
+// Bytes returns the frames as one Annex-B stream (the headers are repeated
+// in-band by x264 unless b_repeat_headers is off).
+func (s *MemorySink) Bytes() []byte {
+	var b []byte
+	for _, f := range s.Frames {
+		b = append(b, f.Data...)
+	}
+	return b
+}
+
+type teeSink []Sink
+
+// TeeSink returns a sink duplicating everything to sinks.  Writes stop at
+// the first error; Close closes every sink and returns the first error.
+func TeeSink(sinks ...Sink) Sink {
+	return teeSink(sinks)
+}
+
+func (t teeSink) WriteHeaders(nals []X264NalT) error {
+	for _, s := range t {
+		if err := s.WriteHeaders(nals); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t teeSink) WriteFrame(f *Frame) error {
+	for _, s := range t {
+		if err := s.WriteFrame(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t teeSink) Close() error {
+	var first error
+	for _, s := range t {
+		if err := s.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,120 @@
+package libx264
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/moonfdd/ffmpeg-go/ffcommon"
+)
+
+/* encodedNal returns unit as x264 would output it with b_annexb on or off */
+func encodedNal(unit []byte, annexb, long bool) X264NalT {
+	var p []byte
+	switch {
+	case !annexb:
+		p = make([]byte, 4)
+		binary.BigEndian.PutUint32(p, uint32(len(unit)))
+	case long:
+		p = []byte{0, 0, 0, 1}
+	default:
+		p = []byte{0, 0, 1}
+	}
+	p = append(p, unit...)
+	nal := X264NalT{
+		IRefIdc:  ffcommon.FInt(unit[0] >> 5),
+		IType:    ffcommon.FInt(unit[0] & 0x1f),
+		IPayload: ffcommon.FInt(len(p)),
+		PPayload: (*ffcommon.FUint8T)(&p[0]),
+	}
+	if long {
+		nal.BLongStartcode = 1
+	}
+	return nal
+}
+
+var (
+	sinkSPS   = []byte{0x67, 0x42, 0xc0, 0x0d, 0xd9}
+	sinkPPS   = []byte{0x68, 0xce, 0x3c, 0x80}
+	sinkIDR   = []byte{0x65, 0x88, 0x84, 0x00}
+	sinkSlice = []byte{0x41, 0x9a, 0x02}
+)
+
+func TestNalUnit(t *testing.T) {
+	/* its size prefix 00 00 01 01 reads as a short start code and header */
+	ambiguous := append([]byte{0x01}, bytes.Repeat([]byte{0x5a}, 256)...)
+	tests := []struct {
+		name   string
+		unit   []byte
+		annexb bool
+		long   bool
+	}{
+		{"annex-b long start code", sinkSPS, true, true},
+		{"annex-b short start code", sinkSlice, true, false},
+		{"size prefix", sinkIDR, false, true},
+		{"size prefix like a start code", ambiguous, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nal := encodedNal(tt.unit, tt.annexb, tt.long)
+			if got := nal.Unit(); !bytes.Equal(got, tt.unit) {
+				t.Errorf("Unit %x, want %x", got, tt.unit)
+			}
+			want := []byte{0, 0, 1}
+			if tt.long {
+				want = []byte{0, 0, 0, 1}
+			}
+			want = append(append([]byte{0xff}, want...), tt.unit...)
+			if got := nal.AppendAnnexB([]byte{0xff}); !bytes.Equal(got, want) {
+				t.Errorf("AppendAnnexB %x, want %x", got, want)
+			}
+		})
+	}
+}
+
+func TestSinks(t *testing.T) {
+	annexB := func(units ...[]byte) []byte {
+		var b []byte
+		for _, u := range units {
+			b = append(append(b, 0, 0, 0, 1), u...)
+		}
+		return b
+	}
+	for _, annexb := range []bool{true, false} {
+		headers := []X264NalT{encodedNal(sinkSPS, annexb, true), encodedNal(sinkPPS, annexb, true)}
+		frames := []*Frame{
+			{Nals: append(headers[:2:2], encodedNal(sinkIDR, annexb, true)), Keyframe: true, Type: X264_TYPE_IDR},
+			{Nals: []X264NalT{encodedNal(sinkSlice, annexb, true), encodedNal(sinkSlice, annexb, false)}, Pts: 1, Dts: 1, Type: X264_TYPE_P},
+		}
+		var out bytes.Buffer
+		mem := &MemorySink{}
+		sink := TeeSink(NewAnnexBSink(&out), mem)
+		if err := sink.WriteHeaders(headers); err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range frames {
+			if err := sink.WriteFrame(f); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := sink.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		second := append(annexB(sinkSlice), 0, 0, 1)
+		second = append(second, sinkSlice...)
+		/* the headers are not repeated for the first frame */
+		if want := append(annexB(sinkSPS, sinkPPS, sinkIDR), second...); !bytes.Equal(out.Bytes(), want) {
+			t.Errorf("annexb %v: AnnexBSink wrote\n%x\nwant\n%x", annexb, out.Bytes(), want)
+		}
+		if want := annexB(sinkSPS, sinkPPS); !bytes.Equal(mem.Headers, want) {
+			t.Errorf("annexb %v: MemorySink headers %x, want %x", annexb, mem.Headers, want)
+		}
+		if want := append(annexB(sinkSPS, sinkPPS, sinkIDR), second...); !bytes.Equal(mem.Bytes(), want) {
+			t.Errorf("annexb %v: MemorySink stream %x, want %x", annexb, mem.Bytes(), want)
+		}
+		if !mem.Closed || len(mem.Frames) != 2 || !mem.Frames[0].Keyframe || mem.Frames[1].Pts != 1 {
+			t.Errorf("annexb %v: MemorySink frames %+v closed %v", annexb, mem.Frames, mem.Closed)
+		}
+	}
+}
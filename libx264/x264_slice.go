@@ -0,0 +1,259 @@
+package libx264
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/moonfdd/ffmpeg-go/ffcommon"
+)
+
+// SliceConfig is the slicing of an encode.  MaxSize and MaxMBs override
+// Count; CountMax stops both from applying once reached, so the last slice
+// of such a frame may exceed them.
+type SliceConfig struct {
+	MaxSize  int /* i_slice_max_size: bytes per slice NAL, 0 for no limit */
+	MaxMBs   int /* i_slice_max_mbs: macroblocks per slice, 0 for no limit */
+	MinMBs   int /* i_slice_min_mbs */
+	Count    int /* i_slice_count: rectangular slices per frame */
+	CountMax int /* i_slice_count_max: absolute cap on slices per frame */
+}
+
+// Validate checks that c is consistent.
+func (c SliceConfig) Validate() error {
+	if c.MaxSize < 0 || c.MaxMBs < 0 || c.MinMBs < 0 || c.Count < 0 || c.CountMax < 0 {
+		return fmt.Errorf("libx264: negative slice setting in %+v", c)
+	}
+	if c.MaxMBs > 0 && c.MinMBs > c.MaxMBs {
+		return fmt.Errorf("libx264: slice min MBs %d exceeds max MBs %d", c.MinMBs, c.MaxMBs)
+	}
+	if c.Count > 0 && c.CountMax > 0 && c.Count > c.CountMax {
+		return fmt.Errorf("libx264: slice count %d exceeds slice count max %d", c.Count, c.CountMax)
+	}
+	return nil
+}
+
+// Slices returns the slicing settings.
+func (param *X264ParamT) Slices() SliceConfig {
+	return SliceConfig{
+		MaxSize:  int(param.i_slice_max_size),
+		MaxMBs:   int(param.i_slice_max_mbs),
+		MinMBs:   int(param.i_slice_min_mbs),
+		Count:    int(param.i_slice_count),
+		CountMax: int(param.i_slice_count_max),
+	}
+}
+
+// SetSlices validates and applies c.
+func (param *X264ParamT) SetSlices(c SliceConfig) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	param.i_slice_max_size = ffcommon.FInt(c.MaxSize)
+	param.i_slice_max_mbs = ffcommon.FInt(c.MaxMBs)
+	param.i_slice_min_mbs = ffcommon.FInt(c.MinMBs)
+	param.i_slice_count = ffcommon.FInt(c.Count)
+	param.i_slice_count_max = ffcommon.FInt(c.CountMax)
+	return nil
+}
+
+// SetSliceMaxSize limits every slice NAL to size bytes, e.g. the RTP
+// payload left by the MTU, so it travels in one packet.  The count of
+// rectangular slices is cleared; the other settings are kept.
+func (param *X264ParamT) SetSliceMaxSize(size int) error {
+	if size <= 0 {
+		return fmt.Errorf("libx264: invalid slice max size %d", size)
+	}
+	c := param.Slices()
+	c.MaxSize, c.Count = size, 0
+	return param.SetSlices(c)
+}
+
+// SetSliceCount codes every frame as n rectangular slices that can be
+// decoded in parallel, clearing the size and macroblock limits.
+func (param *X264ParamT) SetSliceCount(n int) error {
+	if n <= 0 {
+		return fmt.Errorf("libx264: invalid slice count %d", n)
+	}
+	c := param.Slices()
+	c.Count, c.MaxSize, c.MaxMBs = n, 0, 0
+	return param.SetSlices(c)
+}
+
+// FrameMBs returns the number of macroblocks of a frame.
+func (param *X264ParamT) FrameMBs() int {
+	mbh := (int(param.IHeight) + 15) / 16
+	if mode, _ := param.Scan(); mode != ScanProgressive {
+		mbh = (int(param.IHeight) + 31) / 32 * 2
+	}
+	return (int(param.IWidth) + 15) / 16 * mbh
+}
+
+// Slice is a slice NAL of an output picture.
+type Slice struct {
+	Type    int /* NAL_SLICE or NAL_SLICE_IDR */
+	FirstMb int
+	LastMb  int
+	Size    int /* NAL unit bytes, without start code or padding */
+}
+
+// MBs returns the number of macroblocks of a progressive slice.
+func (s Slice) MBs() int {
+	return s.LastMb - s.FirstMb + 1
+}
+
+// FrameSlices returns the slice NALs among nals ordered by first
+// macroblock; with sliced threads x264 may return them out of order.
+func FrameSlices(nals []X264NalT) []Slice {
+	var slices []Slice
+	for i := range nals {
+		nal := &nals[i]
+		if nal.IType < NAL_SLICE || nal.IType > NAL_SLICE_IDR {
+			continue
+		}
+		slices = append(slices, Slice{
+			Type:    int(nal.IType),
+			FirstMb: int(nal.IFirstMb),
+			LastMb:  int(nal.ILastMb),
+			Size:    len(nal.Unit()) - int(nal.IPadding),
+		})
+	}
+	sort.Slice(slices, func(i, j int) bool { return slices[i].FirstMb < slices[j].FirstMb })
+	return slices
+}
+
+// SliceViolation is a slice breaking the slicing of the encode, or a frame
+// whose slices do not cover it.
+type SliceViolation struct {
+	Frame      int /* in output order */
+	Pts        int64
+	Slice      int /* index in FrameSlices order, -1 for the whole frame */
+	Constraint string
+	Value      int64
+	Limit      int64 /* the expected value for coverage */
+}
+
+func (v *SliceViolation) Error() string {
+	where := fmt.Sprintf("frame %d (pts %d)", v.Frame, v.Pts)
+	if v.Slice >= 0 {
+		where += fmt.Sprintf(" slice %d", v.Slice)
+	}
+	return fmt.Sprintf("libx264: %s: %s %d, limit %d", where, v.Constraint, v.Value, v.Limit)
+}
+
+// SliceChecker verifies the slices of output frames against a SliceConfig.
+// Macroblock counts and coverage are checked for progressive encodes only,
+// as MBAFF addresses macroblock pairs.
+type SliceChecker struct {
+	Config SliceConfig
+	MBs    int /* macroblocks per frame, 0 to skip macroblock checks */
+
+	Frames     int
+	Slices     int
+	MaxSize    int /* largest slice seen */
+	Violations []*SliceViolation
+}
+
+// NewSliceChecker returns a checker for an encoder opened with param.
+func NewSliceChecker(param *X264ParamT) *SliceChecker {
+	c := &SliceChecker{Config: param.Slices()}
+	if mode, _ := param.Scan(); mode == ScanProgressive {
+		c.MBs = param.FrameMBs()
+	}
+	return c
+}
+
+// Add checks the slices of an output frame and returns its violations,
+// which are also recorded.
+func (c *SliceChecker) Add(f *Frame) []*SliceViolation {
+	slices := FrameSlices(f.Nals)
+	frame := c.Frames
+	c.Frames++
+	c.Slices += len(slices)
+
+	var found []*SliceViolation
+	violation := func(slice int, constraint string, value, limit int) {
+		found = append(found, &SliceViolation{frame, f.Pts, slice, constraint, int64(value), int64(limit)})
+	}
+	cfg := c.Config
+	capped := cfg.CountMax > 0 && len(slices) >= cfg.CountMax
+	for i, s := range slices {
+		if s.Size > c.MaxSize {
+			c.MaxSize = s.Size
+		}
+		last := i == len(slices)-1
+		if capped && last {
+			continue
+		}
+		if cfg.MaxSize > 0 && s.Size > cfg.MaxSize {
+			violation(i, "slice size (bytes)", s.Size, cfg.MaxSize)
+		}
+		if c.MBs > 0 && cfg.MaxMBs > 0 && s.MBs() > cfg.MaxMBs {
+			violation(i, "macroblocks per slice", s.MBs(), cfg.MaxMBs)
+		}
+		if c.MBs > 0 && cfg.MinMBs > 0 && !last && s.MBs() < cfg.MinMBs {
+			violation(i, "macroblocks per slice below minimum", s.MBs(), cfg.MinMBs)
+		}
+	}
+	switch {
+	case cfg.CountMax > 0 && len(slices) > cfg.CountMax:
+		violation(-1, "slices per frame", len(slices), cfg.CountMax)
+	case cfg.MaxSize == 0 && cfg.MaxMBs == 0 && cfg.Count > 0 && len(slices) > cfg.Count:
+		violation(-1, "slices per frame", len(slices), cfg.Count)
+	}
+	if c.MBs > 0 && len(slices) > 0 {
+		next := 0
+		for i, s := range slices {
+			if s.FirstMb != next {
+				violation(i, "first macroblock", s.FirstMb, next)
+			}
+			next = s.LastMb + 1
+		}
+		if next != c.MBs {
+			violation(-1, "macroblocks covered", next, c.MBs)
+		}
+	}
+	c.Violations = append(c.Violations, found...)
+	return found
+}
+
+// Err returns the first violation, or nil.
+func (c *SliceChecker) Err() error {
+	if len(c.Violations) == 0 {
+		return nil
+	}
+	return fmt.Errorf("libx264: %d slice violations, first: %v", len(c.Violations), c.Violations[0])
+}
+
+// Report writes a summary and every violation.
+func (c *SliceChecker) Report(w io.Writer) error {
+	perFrame := 0.0
+	if c.Frames > 0 {
+		perFrame = float64(c.Slices) / float64(c.Frames)
+	}
+	if _, err := fmt.Fprintf(w, "slices %+v: %d frames, %.2f slices/frame, largest %d bytes, %d violations\n",
+		c.Config, c.Frames, perFrame, c.MaxSize, len(c.Violations)); err != nil {
+		return err
+	}
+	for _, v := range c.Violations {
+		if _, err := fmt.Fprintln(w, v.Error()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type sliceSink struct {
+	Sink
+	c *SliceChecker
+}
+
+// SliceSink returns sink checking every frame with checker.
+func SliceSink(sink Sink, checker *SliceChecker) Sink {
+	return sliceSink{sink, checker}
+}
+
+func (k sliceSink) WriteFrame(f *Frame) error {
+	k.c.Add(f)
+	return k.Sink.WriteFrame(f)
+}
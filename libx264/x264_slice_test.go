@@ -0,0 +1,165 @@
+package libx264
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/moonfdd/ffmpeg-go/ffcommon"
+)
+
+/* testNal returns an Annex-B NAL of size bytes after the start code */
+func testNal(typ, first, last, size int) X264NalT {
+	refIdc := 2
+	if typ == NAL_SEI {
+		refIdc = 0
+	}
+	p := append([]byte{0, 0, 0, 1, byte(refIdc<<5 | typ)}, bytes.Repeat([]byte{0xa5}, size-1)...)
+	return X264NalT{
+		IRefIdc:  ffcommon.FInt(refIdc),
+		IType:    ffcommon.FInt(typ),
+		IFirstMb: ffcommon.FInt(first),
+		ILastMb:  ffcommon.FInt(last),
+		IPayload: ffcommon.FInt(len(p)),
+		PPayload: (*ffcommon.FUint8T)(&p[0]),
+	}
+}
+
+func TestSliceConfig(t *testing.T) {
+	tests := []struct {
+		c  SliceConfig
+		ok bool
+	}{
+		{SliceConfig{}, true},
+		{SliceConfig{MaxSize: 1200, MaxMBs: 400, MinMBs: 100, CountMax: 8}, true},
+		{SliceConfig{MaxSize: -1}, false},
+		{SliceConfig{MaxMBs: 100, MinMBs: 200}, false},
+		{SliceConfig{Count: 8, CountMax: 4}, false},
+	}
+	for _, tt := range tests {
+		param := new(X264ParamT)
+		err := param.SetSlices(tt.c)
+		if (err == nil) != tt.ok {
+			t.Errorf("SetSlices(%+v): %v", tt.c, err)
+		}
+		if err == nil && param.Slices() != tt.c {
+			t.Errorf("Slices() = %+v, want %+v", param.Slices(), tt.c)
+		}
+	}
+
+	param := new(X264ParamT)
+	if err := param.SetSlices(SliceConfig{Count: 4, MaxMBs: 400, MinMBs: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if err := param.SetSliceMaxSize(1200); err != nil {
+		t.Fatal(err)
+	}
+	if c := param.Slices(); c != (SliceConfig{MaxSize: 1200, MaxMBs: 400, MinMBs: 100}) {
+		t.Errorf("after SetSliceMaxSize: %+v", c)
+	}
+	if err := param.SetSliceCount(4); err != nil {
+		t.Fatal(err)
+	}
+	if c := param.Slices(); c != (SliceConfig{Count: 4, MinMBs: 100}) {
+		t.Errorf("after SetSliceCount: %+v", c)
+	}
+	if param.SetSliceMaxSize(0) == nil || param.SetSliceCount(-1) == nil {
+		t.Error("accepted an invalid slice size or count")
+	}
+}
+
+func TestSliceChecker(t *testing.T) {
+	type v struct {
+		slice      int
+		constraint string
+	}
+	/* 1280x720 is 3600 macroblocks */
+	tests := []struct {
+		name string
+		cfg  SliceConfig
+		nals []X264NalT
+		want []v
+	}{
+		{"count", SliceConfig{Count: 4}, []X264NalT{
+			testNal(NAL_SEI, 0, 0, 20),
+			testNal(NAL_SLICE_IDR, 1800, 2699, 100), testNal(NAL_SLICE_IDR, 0, 899, 100),
+			testNal(NAL_SLICE_IDR, 2700, 3599, 100), testNal(NAL_SLICE_IDR, 900, 1799, 100),
+		}, nil},
+		{"too many slices", SliceConfig{Count: 2}, []X264NalT{
+			testNal(NAL_SLICE, 0, 999, 100), testNal(NAL_SLICE, 1000, 1999, 100), testNal(NAL_SLICE, 2000, 3599, 100),
+		}, []v{{-1, "slices per frame"}}},
+		{"max size", SliceConfig{MaxSize: 1200}, []X264NalT{
+			testNal(NAL_SLICE, 0, 1799, 1200), testNal(NAL_SLICE, 1800, 3599, 1500),
+		}, []v{{1, "slice size (bytes)"}}},
+		{"max and min mbs", SliceConfig{MaxMBs: 1000, MinMBs: 500}, []X264NalT{
+			testNal(NAL_SLICE, 0, 99, 100), testNal(NAL_SLICE, 100, 1299, 100),
+			testNal(NAL_SLICE, 1300, 2299, 100), testNal(NAL_SLICE, 2300, 3299, 100), testNal(NAL_SLICE, 3300, 3599, 100),
+		}, []v{{0, "macroblocks per slice below minimum"}, {1, "macroblocks per slice"}}},
+		/* the last slice of a frame at the cap may exceed the limits */
+		{"count max", SliceConfig{MaxSize: 1200, CountMax: 2}, []X264NalT{
+			testNal(NAL_SLICE, 0, 99, 1200), testNal(NAL_SLICE, 100, 3599, 5000),
+		}, nil},
+		{"over count max", SliceConfig{MaxSize: 1200, CountMax: 2}, []X264NalT{
+			testNal(NAL_SLICE, 0, 99, 1200), testNal(NAL_SLICE, 100, 199, 1300), testNal(NAL_SLICE, 200, 3599, 1200),
+		}, []v{{1, "slice size (bytes)"}, {-1, "slices per frame"}}},
+		{"gap", SliceConfig{}, []X264NalT{
+			testNal(NAL_SLICE, 0, 99, 100), testNal(NAL_SLICE, 200, 3599, 100),
+		}, []v{{1, "first macroblock"}}},
+		{"incomplete", SliceConfig{}, []X264NalT{
+			testNal(NAL_SLICE, 0, 1799, 100),
+		}, []v{{-1, "macroblocks covered"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			param := new(X264ParamT)
+			param.IWidth, param.IHeight = 1280, 720
+			if err := param.SetSlices(tt.cfg); err != nil {
+				t.Fatal(err)
+			}
+			c := NewSliceChecker(param)
+			if c.MBs != 3600 {
+				t.Fatalf("%d macroblocks, want 3600", c.MBs)
+			}
+			c.Add(&Frame{Nals: tt.nals})
+			found := c.Add(&Frame{Nals: tt.nals, Pts: 7})
+			if len(found) != len(tt.want) {
+				t.Fatalf("violations %v, want %v", found, tt.want)
+			}
+			for i, w := range tt.want {
+				if f := found[i]; f.Frame != 1 || f.Pts != 7 || f.Slice != w.slice || f.Constraint != w.constraint {
+					t.Errorf("violation %d: %v, want slice %d %s", i, f, w.slice, w.constraint)
+				}
+			}
+			if (c.Err() == nil) != (len(tt.want) == 0) {
+				t.Errorf("Err: %v", c.Err())
+			}
+			var report bytes.Buffer
+			if err := c.Report(&report); err != nil {
+				t.Fatal(err)
+			}
+			if n := strings.Count(report.String(), "\n"); n != 1+2*len(tt.want) {
+				t.Errorf("report of %d lines:\n%s", n, report.String())
+			}
+		})
+	}
+}
+
+func TestSliceCheckerInterlaced(t *testing.T) {
+	param := new(X264ParamT)
+	param.IWidth, param.IHeight = 1920, 1080
+	param.b_interlaced = 1
+	if n := param.FrameMBs(); n != 120*68 {
+		t.Errorf("FrameMBs %d, want %d", n, 120*68)
+	}
+	if err := param.SetSlices(SliceConfig{MaxMBs: 100}); err != nil {
+		t.Fatal(err)
+	}
+	c := NewSliceChecker(param)
+	/* MBAFF addresses macroblock pairs, so only sizes and counts apply */
+	if found := c.Add(&Frame{Nals: []X264NalT{testNal(NAL_SLICE_IDR, 0, 4079, 100)}}); c.MBs != 0 || len(found) != 0 {
+		t.Errorf("MBs %d, violations %v", c.MBs, found)
+	}
+	if c.Frames != 1 || c.Slices != 1 || c.MaxSize != 100 {
+		t.Errorf("frames %d slices %d max size %d", c.Frames, c.Slices, c.MaxSize)
+	}
+}
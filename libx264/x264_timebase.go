@@ -0,0 +1,140 @@
+package libx264
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/moonfdd/ffmpeg-go/ffcommon"
+)
+
+// FPS returns i_fps_num/i_fps_den.
+func (param *X264ParamT) FPS() (num, den uint32) {
+	return uint32(param.i_fps_num), uint32(param.i_fps_den)
+}
+
+// SetFPS sets the nominal frame rate.  Without VFR input x264 ignores the
+// PTS for ratecontrol and uses a timebase of one frame.
+func (param *X264ParamT) SetFPS(num, den uint32) error {
+	if num == 0 || den == 0 {
+		return fmt.Errorf("libx264: invalid frame rate %d/%d", num, den)
+	}
+	param.i_fps_num = ffcommon.FUint32T(num)
+	param.i_fps_den = ffcommon.FUint32T(den)
+	return nil
+}
+
+// Timebase returns i_timebase_num/i_timebase_den, the unit of PTS and DTS.
+func (param *X264ParamT) Timebase() (num, den uint32) {
+	return uint32(param.i_timebase_num), uint32(param.i_timebase_den)
+}
+
+// VFR reports whether b_vfr_input is set.
+func (param *X264ParamT) VFR() bool {
+	return param.b_vfr_input != 0
+}
+
+// SetVFR sets b_vfr_input and the timebase of the input timestamps, e.g.
+// 1/1000 for millisecond capture clocks or 1/90000.  x264 then uses the
+// timestamps for ratecontrol and keeps the timebase in the output; the fps
+// stays the nominal rate for the VUI and the initial ratecontrol estimate.
+func (param *X264ParamT) SetVFR(timebaseNum, timebaseDen uint32) error {
+	if timebaseNum == 0 || timebaseDen == 0 {
+		return fmt.Errorf("libx264: invalid timebase %d/%d", timebaseNum, timebaseDen)
+	}
+	param.i_timebase_num = ffcommon.FUint32T(timebaseNum)
+	param.i_timebase_den = ffcommon.FUint32T(timebaseDen)
+	param.b_vfr_input = 1
+	return nil
+}
+
+// SetCFR clears b_vfr_input: PTS are frame numbers at num/den fps.
+func (param *X264ParamT) SetCFR(num, den uint32) error {
+	if err := param.SetFPS(num, den); err != nil {
+		return err
+	}
+	param.i_timebase_num = ffcommon.FUint32T(den)
+	param.i_timebase_den = ffcommon.FUint32T(num)
+	param.b_vfr_input = 0
+	return nil
+}
+
+// Timestamper turns capture timestamps into PTS of a timebase: relative to
+// the first timestamp, rounded to the nearest tick and strictly
+// increasing, a timestamp not after the previous one being moved one tick
+// past it.  It maps PTS and DTS of output frames back to durations.
+type Timestamper struct {
+	Num, Den int64 /* timebase */
+
+	Adjusted int /* timestamps moved to keep PTS increasing */
+
+	origin  *big.Rat /* seconds */
+	last    int64
+	started bool
+}
+
+// NewTimestamper returns a Timestamper for the timebase of param.
+func NewTimestamper(param *X264ParamT) (*Timestamper, error) {
+	num, den := param.Timebase()
+	if num == 0 || den == 0 {
+		return nil, fmt.Errorf("libx264: invalid timebase %d/%d", num, den)
+	}
+	return &Timestamper{Num: int64(num), Den: int64(den)}, nil
+}
+
+// PTS returns the PTS of a frame captured at d.
+func (t *Timestamper) PTS(d time.Duration) int64 {
+	return t.pts(big.NewRat(int64(d), int64(time.Second)))
+}
+
+// PTSRational returns the PTS of a frame captured at num/den seconds, e.g.
+// a 90 kHz clock value over 90000.
+func (t *Timestamper) PTSRational(num, den int64) int64 {
+	return t.pts(big.NewRat(num, den))
+}
+
+func (t *Timestamper) pts(s *big.Rat) int64 {
+	if t.origin == nil {
+		t.origin = s
+	}
+	/* (s - origin) * Den / Num, rounded half up */
+	v := new(big.Rat).Sub(s, t.origin)
+	v.Mul(v, big.NewRat(t.Den, t.Num))
+	v.Add(v, big.NewRat(1, 2))
+	q := new(big.Int).Div(v.Num(), v.Denom())
+	pts := q.Int64()
+	if t.started && pts <= t.last {
+		pts = t.last + 1
+		t.Adjusted++
+	}
+	t.last, t.started = pts, true
+	return pts
+}
+
+// Apply sets the PTS of pic for a frame captured at d.
+func (t *Timestamper) Apply(pic *X264PictureT, d time.Duration) {
+	pic.IPts = t.PTS(d)
+}
+
+// Duration returns the capture time corresponding to a PTS or DTS, which
+// may be negative for DTS with B-frames.
+func (t *Timestamper) Duration(ts int64) time.Duration {
+	d := t.Since(ts)
+	if t.origin != nil {
+		o := new(big.Rat).Mul(t.origin, big.NewRat(int64(time.Second), 1))
+		d += time.Duration(new(big.Int).Quo(o.Num(), o.Denom()).Int64())
+	}
+	return d
+}
+
+// Since returns the time of ts relative to the first frame.
+func (t *Timestamper) Since(ts int64) time.Duration {
+	v := new(big.Int).Mul(big.NewInt(ts), big.NewInt(t.Num*int64(time.Second)))
+	return time.Duration(v.Quo(v, big.NewInt(t.Den)).Int64())
+}
+
+// FrameTimes returns the presentation and decoding times of an output
+// frame relative to the first frame, for muxers working in durations.
+func (t *Timestamper) FrameTimes(f *Frame) (pts, dts time.Duration) {
+	return t.Since(f.Pts), t.Since(f.Dts)
+}
@@ -0,0 +1,85 @@
+package libx264
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTimestamper(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		name     string
+		num, den uint32
+		capture  []time.Duration
+		pts      []int64
+		adjusted int
+	}{
+		{"milliseconds", 1, 1000, []time.Duration{5 * time.Second, 5*time.Second + 33400*time.Microsecond, 5*time.Second + 66700*time.Microsecond},
+			[]int64{0, 33, 67}, 0},
+		{"90 kHz", 1, 90000, []time.Duration{time.Second, time.Second + 33333333}, []int64{0, 3000}, 0},
+		{"half rounds up", 1, 1000, []time.Duration{0, 1500 * time.Microsecond, 2499 * time.Microsecond}, []int64{0, 2, 3}, 1},
+		{"jitter", 1, 25, []time.Duration{0, 10 * ms, 20 * ms, 120 * ms}, []int64{0, 1, 2, 3}, 2},
+		{"before the first frame", 1, 1000, []time.Duration{10 * ms, 5 * ms, 30 * ms}, []int64{0, 1, 20}, 1},
+		{"ntsc", 1001, 30000, []time.Duration{0, 33366666, 66733333, 100100000}, []int64{0, 1, 2, 3}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			param := new(X264ParamT)
+			if err := param.SetVFR(tt.num, tt.den); err != nil {
+				t.Fatal(err)
+			}
+			ts, err := NewTimestamper(param)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var pts []int64
+			for _, d := range tt.capture {
+				var pic X264PictureT
+				ts.Apply(&pic, d)
+				pts = append(pts, pic.IPts)
+			}
+			if !reflect.DeepEqual(pts, tt.pts) || ts.Adjusted != tt.adjusted {
+				t.Errorf("pts %v adjusted %d, want %v %d", pts, ts.Adjusted, tt.pts, tt.adjusted)
+			}
+		})
+	}
+
+	if _, err := NewTimestamper(new(X264ParamT)); err == nil {
+		t.Error("zero timebase accepted")
+	}
+	param := new(X264ParamT)
+	if err := param.SetVFR(0, 1000); err == nil || param.VFR() {
+		t.Errorf("SetVFR with a zero numerator: %v", err)
+	}
+}
+
+func TestTimestamperDurations(t *testing.T) {
+	ts := &Timestamper{Num: 1001, Den: 30000}
+	/* a 90 kHz clock of 10 s, then one frame later */
+	if p := ts.PTSRational(900000, 90000); p != 0 {
+		t.Errorf("first PTS %d", p)
+	}
+	if p := ts.PTSRational(903003, 90000); p != 1 {
+		t.Errorf("second PTS %d", p)
+	}
+	tests := []struct {
+		ts       int64
+		since    time.Duration
+		duration time.Duration
+	}{
+		{0, 0, 10 * time.Second},
+		{30, 1001 * time.Millisecond, 11001 * time.Millisecond},
+		{1, 33366666, 10*time.Second + 33366666},
+		/* DTS before the first PTS with B-frames */
+		{-2, -66733333, 10*time.Second - 66733333},
+	}
+	for _, tt := range tests {
+		if s, d := ts.Since(tt.ts), ts.Duration(tt.ts); s != tt.since || d != tt.duration {
+			t.Errorf("%d: Since %v Duration %v, want %v %v", tt.ts, s, d, tt.since, tt.duration)
+		}
+	}
+	if pts, dts := ts.FrameTimes(&Frame{Pts: 30, Dts: -2}); pts != 1001*time.Millisecond || dts != -66733333 {
+		t.Errorf("FrameTimes %v %v", pts, dts)
+	}
+}
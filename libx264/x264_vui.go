@@ -0,0 +1,333 @@
+package libx264
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/moonfdd/ffmpeg-go/ffcommon"
+	"github.com/moonfdd/x264-go/h264"
+)
+
+// ColorPrimaries is vui.i_colorprim (h264 table E-3).
+type ColorPrimaries int
+
+const (
+	ColorPrimariesBT709       ColorPrimaries = 1
+	ColorPrimariesUnspecified ColorPrimaries = 2
+	ColorPrimariesBT470M      ColorPrimaries = 4
+	ColorPrimariesBT470BG     ColorPrimaries = 5
+	ColorPrimariesSMPTE170M   ColorPrimaries = 6
+	ColorPrimariesSMPTE240M   ColorPrimaries = 7
+	ColorPrimariesFilm        ColorPrimaries = 8
+	ColorPrimariesBT2020      ColorPrimaries = 9
+	ColorPrimariesSMPTE428    ColorPrimaries = 10
+	ColorPrimariesSMPTE431    ColorPrimaries = 11
+	ColorPrimariesSMPTE432    ColorPrimaries = 12
+)
+
+// TransferCharacteristics is vui.i_transfer (h264 table E-4).
+type TransferCharacteristics int
+
+const (
+	TransferBT709        TransferCharacteristics = 1
+	TransferUnspecified  TransferCharacteristics = 2
+	TransferBT470M       TransferCharacteristics = 4
+	TransferBT470BG      TransferCharacteristics = 5
+	TransferSMPTE170M    TransferCharacteristics = 6
+	TransferSMPTE240M    TransferCharacteristics = 7
+	TransferLinear       TransferCharacteristics = 8
+	TransferLog100       TransferCharacteristics = 9
+	TransferLog316       TransferCharacteristics = 10
+	TransferIEC61966_2_4 TransferCharacteristics = 11
+	TransferBT1361E      TransferCharacteristics = 12
+	TransferIEC61966_2_1 TransferCharacteristics = 13 /* sRGB */
+	TransferBT2020_10    TransferCharacteristics = 14
+	TransferBT2020_12    TransferCharacteristics = 15
+	TransferSMPTE2084    TransferCharacteristics = 16 /* PQ */
+	TransferSMPTE428     TransferCharacteristics = 17
+	TransferARIBSTDB67   TransferCharacteristics = 18 /* HLG */
+)
+
+// MatrixCoefficients is vui.i_colmatrix (h264 table E-5).
+type MatrixCoefficients int
+
+const (
+	MatrixAuto            MatrixCoefficients = -1 /* x264 picks GBR for RGB input, else unspecified */
+	MatrixGBR             MatrixCoefficients = 0
+	MatrixBT709           MatrixCoefficients = 1
+	MatrixUnspecified     MatrixCoefficients = 2
+	MatrixFCC             MatrixCoefficients = 4
+	MatrixBT470BG         MatrixCoefficients = 5
+	MatrixSMPTE170M       MatrixCoefficients = 6
+	MatrixSMPTE240M       MatrixCoefficients = 7
+	MatrixYCgCo           MatrixCoefficients = 8
+	MatrixBT2020NC        MatrixCoefficients = 9
+	MatrixBT2020C         MatrixCoefficients = 10
+	MatrixSMPTE2085       MatrixCoefficients = 11
+	MatrixChromaDerivedNC MatrixCoefficients = 12
+	MatrixChromaDerivedC  MatrixCoefficients = 13
+	MatrixICtCp           MatrixCoefficients = 14
+)
+
+func (c ColorPrimaries) String() string          { return vuiName(X264ColorprimNames, ffcommon.FInt(c)) }
+func (t TransferCharacteristics) String() string { return vuiName(X264TransferNames, ffcommon.FInt(t)) }
+
+func (m MatrixCoefficients) String() string {
+	if m == MatrixAuto {
+		return "auto"
+	}
+	return vuiName(X264ColmatrixNames, ffcommon.FInt(m))
+}
+
+// ParseColorPrimaries parses an x264 --colorprim name.
+func ParseColorPrimaries(s string) (ColorPrimaries, error) {
+	v, err := parseVUIName("colour primaries", X264ColorprimNames, s)
+	return ColorPrimaries(v), err
+}
+
+// ParseTransferCharacteristics parses an x264 --transfer name.
+func ParseTransferCharacteristics(s string) (TransferCharacteristics, error) {
+	v, err := parseVUIName("transfer characteristics", X264TransferNames, s)
+	return TransferCharacteristics(v), err
+}
+
+// ParseMatrixCoefficients parses an x264 --colormatrix name.
+func ParseMatrixCoefficients(s string) (MatrixCoefficients, error) {
+	if strings.EqualFold(s, "auto") {
+		return MatrixAuto, nil
+	}
+	v, err := parseVUIName("matrix coefficients", X264ColmatrixNames, s)
+	return MatrixCoefficients(v), err
+}
+
+/*
+names are matched case-insensitively like x264 does; the empty entries
+
+	are reserved code points
+*/
+func parseVUIName(what string, names []string, s string) (int, error) {
+	for i, name := range names {
+		if name != "" && strings.EqualFold(name, s) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("libx264: unknown %s %q", what, s)
+}
+
+func vuiName(names []string, v ffcommon.FInt) string {
+	if v >= 0 && int(v) < len(names) && names[v] != "" {
+		return names[v]
+	}
+	return fmt.Sprint(int(v))
+}
+
+// VUI is the video usability information of x264_param_t.
+type VUI struct {
+	SarWidth  int /* 0 for no SAR */
+	SarHeight int
+
+	Overscan    int /* 0 undef, 1 show, 2 crop */
+	VideoFormat int /* index into X264VidformatNames, 5 undef */
+	FullRange   int /* -1 auto, 0 off, 1 on */
+
+	ColorPrimaries ColorPrimaries
+	Transfer       TransferCharacteristics
+	Matrix         MatrixCoefficients
+
+	ChromaLoc int /* 0..5, both fields */
+}
+
+// VUI returns the VUI of param.
+func (param *X264ParamT) VUI() VUI {
+	v := &param.vui
+	return VUI{
+		SarWidth:       int(v.i_sar_width),
+		SarHeight:      int(v.i_sar_height),
+		Overscan:       int(v.i_overscan),
+		VideoFormat:    int(v.i_vidformat),
+		FullRange:      int(v.b_fullrange),
+		ColorPrimaries: ColorPrimaries(v.i_colorprim),
+		Transfer:       TransferCharacteristics(v.i_transfer),
+		Matrix:         MatrixCoefficients(v.i_colmatrix),
+		ChromaLoc:      int(v.i_chroma_loc),
+	}
+}
+
+// Validate checks that every field is a known value.
+func (v *VUI) Validate() error {
+	switch {
+	case v.SarWidth < 0 || v.SarHeight < 0 || (v.SarWidth == 0) != (v.SarHeight == 0):
+		return fmt.Errorf("libx264: invalid SAR %d:%d", v.SarWidth, v.SarHeight)
+	case v.Overscan < 0 || v.Overscan >= len(X264OverscanNames):
+		return fmt.Errorf("libx264: invalid overscan %d", v.Overscan)
+	case v.VideoFormat < 0 || v.VideoFormat >= len(X264VidformatNames):
+		return fmt.Errorf("libx264: invalid video format %d", v.VideoFormat)
+	case v.FullRange < -1 || v.FullRange > 1:
+		return fmt.Errorf("libx264: invalid full range flag %d", v.FullRange)
+	case !validVUIName(X264ColorprimNames, int(v.ColorPrimaries)):
+		return fmt.Errorf("libx264: invalid colour primaries %v", v.ColorPrimaries)
+	case !validVUIName(X264TransferNames, int(v.Transfer)):
+		return fmt.Errorf("libx264: invalid transfer characteristics %v", v.Transfer)
+	case v.Matrix != MatrixAuto && !validVUIName(X264ColmatrixNames, int(v.Matrix)):
+		return fmt.Errorf("libx264: invalid matrix coefficients %v", v.Matrix)
+	case v.ChromaLoc < 0 || v.ChromaLoc > 5:
+		return fmt.Errorf("libx264: invalid chroma location %d", v.ChromaLoc)
+	}
+	return nil
+}
+
+func validVUIName(names []string, v int) bool {
+	return v >= 0 && v < len(names) && names[v] != ""
+}
+
+// SetVUI validates v and stores it in param, the SAR reduced like x264
+// does.
+func (param *X264ParamT) SetVUI(v VUI) error {
+	if err := v.Validate(); err != nil {
+		return err
+	}
+	vui := &param.vui
+	vui.i_overscan = ffcommon.FInt(v.Overscan)
+	vui.i_vidformat = ffcommon.FInt(v.VideoFormat)
+	vui.b_fullrange = ffcommon.FInt(v.FullRange)
+	vui.i_colorprim = ffcommon.FInt(v.ColorPrimaries)
+	vui.i_transfer = ffcommon.FInt(v.Transfer)
+	vui.i_colmatrix = ffcommon.FInt(v.Matrix)
+	vui.i_chroma_loc = ffcommon.FInt(v.ChromaLoc)
+	return param.SetSAR(v.SarWidth, v.SarHeight)
+}
+
+// SetColor sets the colour description of the VUI.
+func (param *X264ParamT) SetColor(prim ColorPrimaries, transfer TransferCharacteristics, matrix MatrixCoefficients) error {
+	v := param.VUI()
+	v.ColorPrimaries, v.Transfer, v.Matrix = prim, transfer, matrix
+	return param.SetVUI(v)
+}
+
+// SAR returns the sample aspect ratio, 0:0 if unset.
+func (param *X264ParamT) SAR() (width, height int) {
+	return int(param.vui.i_sar_width), int(param.vui.i_sar_height)
+}
+
+// SetSAR sets the sample aspect ratio width:height, reduced to lowest
+// terms and, if either term exceeds 65535, approximated the way x264 does.
+// 0:0 removes it.
+func (param *X264ParamT) SetSAR(width, height int) error {
+	if width < 0 || height < 0 || (width == 0) != (height == 0) {
+		return fmt.Errorf("libx264: invalid SAR %d:%d", width, height)
+	}
+	w, h := reduceSAR(int64(width), int64(height))
+	param.vui.i_sar_width, param.vui.i_sar_height = ffcommon.FInt(w), ffcommon.FInt(h)
+	return nil
+}
+
+// SetDisplayAspect sets the SAR making a width x height picture display
+// at dispWidth:dispHeight, e.g. 720x576 at 16:9.
+func (param *X264ParamT) SetDisplayAspect(width, height, dispWidth, dispHeight int) error {
+	if width <= 0 || height <= 0 || dispWidth <= 0 || dispHeight <= 0 {
+		return fmt.Errorf("libx264: invalid display aspect %d:%d for %dx%d", dispWidth, dispHeight, width, height)
+	}
+	return param.SetSAR(dispWidth*height, dispHeight*width)
+}
+
+func gcd(a, b int64) int64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+/* x264_reduce_fraction, halving until both terms fit in 16 bits */
+func reduceSAR(w, h int64) (int64, int64) {
+	if w == 0 || h == 0 {
+		return 0, 0
+	}
+	g := gcd(w, h)
+	w, h = w/g, h/g
+	for w > 65535 || h > 65535 {
+		w, h = w/2, h/2
+	}
+	if w == 0 || h == 0 {
+		return 0, 0
+	}
+	g = gcd(w, h)
+	return w / g, h / g
+}
+
+// SPS returns the sequence parameter set the encoder emits, parsed.
+func (e *Encoder) SPS() (*h264.SPS, error) {
+	var pNals *X264NalT
+	var iNal ffcommon.FInt
+	if ret := e.h.X264EncoderHeaders(&pNals, &iNal); ret < 0 {
+		return nil, fmt.Errorf("libx264: x264_encoder_headers failed (%d)", ret)
+	}
+	nals := X264NalSlice(pNals, iNal)
+	for i := range nals {
+		if int(nals[i].IType) == h264.NalSPS {
+			return h264.ParseSPS(nals[i].Unit())
+		}
+	}
+	return nil, h264.ErrNotSPS
+}
+
+// VerifyVUI checks that the SPS the encoder emits carries the VUI of its
+// parameters.
+func (e *Encoder) VerifyVUI() error {
+	param, err := e.Parameters()
+	if err != nil {
+		return err
+	}
+	sps, err := e.SPS()
+	if err != nil {
+		return err
+	}
+	return param.VUI().Verify(sps)
+}
+
+// Verify compares v, as validated by the encoder, with the VUI of sps.
+// x264 signals the chroma location for 4:2:0 only, so it is not compared
+// for other chroma formats.
+func (v VUI) Verify(sps *h264.SPS) error {
+	s := sps.VUI
+	if s == nil {
+		s = &h264.VUI{VideoFormat: 5, ColourPrimaries: 2, TransferCharacteristics: 2, MatrixCoefficients: 2}
+	}
+	mismatch := func(what string, want, have interface{}) error {
+		return fmt.Errorf("libx264: SPS %s is %v, want %v", what, have, want)
+	}
+	if s.SarWidth != v.SarWidth || s.SarHeight != v.SarHeight {
+		return mismatch("SAR", fmt.Sprintf("%d:%d", v.SarWidth, v.SarHeight), fmt.Sprintf("%d:%d", s.SarWidth, s.SarHeight))
+	}
+	overscan := 0
+	if s.OverscanInfoPresent {
+		overscan = 1
+		if s.OverscanAppropriate {
+			overscan = 2
+		}
+	}
+	if overscan != v.Overscan {
+		return mismatch("overscan", X264OverscanNames[v.Overscan], vuiName(X264OverscanNames, ffcommon.FInt(overscan)))
+	}
+	if s.VideoFormat != v.VideoFormat {
+		return mismatch("video format", vuiName(X264VidformatNames, ffcommon.FInt(v.VideoFormat)), vuiName(X264VidformatNames, ffcommon.FInt(s.VideoFormat)))
+	}
+	if s.FullRange != (v.FullRange == 1) {
+		return mismatch("full range flag", v.FullRange == 1, s.FullRange)
+	}
+	if ColorPrimaries(s.ColourPrimaries) != v.ColorPrimaries {
+		return mismatch("colour primaries", v.ColorPrimaries, ColorPrimaries(s.ColourPrimaries))
+	}
+	if TransferCharacteristics(s.TransferCharacteristics) != v.Transfer {
+		return mismatch("transfer characteristics", v.Transfer, TransferCharacteristics(s.TransferCharacteristics))
+	}
+	if MatrixCoefficients(s.MatrixCoefficients) != v.Matrix {
+		return mismatch("matrix coefficients", v.Matrix, MatrixCoefficients(s.MatrixCoefficients))
+	}
+	if sps.ChromaFormatIdc != 1 {
+		return nil
+	}
+	if s.ChromaSampleLocTop != v.ChromaLoc || s.ChromaSampleLocBottom != v.ChromaLoc {
+		return mismatch("chroma location", v.ChromaLoc, fmt.Sprintf("%d/%d", s.ChromaSampleLocTop, s.ChromaSampleLocBottom))
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package libx264
+
+import (
+	"testing"
+
+	"github.com/moonfdd/x264-go/h264"
+)
+
+func TestVUIVerify(t *testing.T) {
+	bt709 := VUI{SarWidth: 1, SarHeight: 1, VideoFormat: 5, ColorPrimaries: ColorPrimariesBT709,
+		Transfer: TransferBT709, Matrix: MatrixBT709, ChromaLoc: 2}
+	spsVUI := func(chromaLoc bool) *h264.VUI {
+		v := &h264.VUI{AspectRatioIdc: 1, SarWidth: 1, SarHeight: 1, VideoFormat: 5,
+			ColourPrimaries: 1, TransferCharacteristics: 1, MatrixCoefficients: 1}
+		if chromaLoc {
+			v.ChromaLocInfoPresent, v.ChromaSampleLocTop, v.ChromaSampleLocBottom = true, 2, 2
+		}
+		return v
+	}
+	tests := []struct {
+		name   string
+		vui    VUI
+		chroma int
+		sps    *h264.VUI
+		ok     bool
+	}{
+		{"4:2:0", bt709, 1, spsVUI(true), true},
+		{"4:2:0 chroma location missing", bt709, 1, spsVUI(false), false},
+		{"4:2:2 without chroma location", bt709, 2, spsVUI(false), true},
+		{"4:4:4 without chroma location", bt709, 3, spsVUI(false), true},
+		{"SAR mismatch", VUI{SarWidth: 4, SarHeight: 3, VideoFormat: 5, ColorPrimaries: 1, Transfer: 1, Matrix: 1, ChromaLoc: 2},
+			2, spsVUI(false), false},
+		{"no VUI", VUI{VideoFormat: 5, ColorPrimaries: 2, Transfer: 2, Matrix: 2}, 1, nil, true},
+		{"no VUI, colour expected", bt709, 2, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sps := &h264.SPS{ChromaFormatIdc: tt.chroma, VUIPresent: tt.sps != nil, VUI: tt.sps}
+			if err := tt.vui.Verify(sps); (err == nil) != tt.ok {
+				t.Errorf("Verify: %v", err)
+			}
+		})
+	}
+}
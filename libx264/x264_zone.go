@@ -0,0 +1,143 @@
+package libx264
+
+import (
+	"fmt"
+	"sort"
+	"unsafe"
+
+	"github.com/moonfdd/ffmpeg-go/ffcommon"
+)
+
+// Zone overrides rate control for a range of frames (x264 --zones).
+type Zone struct {
+	Start, End int /* frame numbers, inclusive */
+
+	ForceQP       bool
+	QP            int     /* used when ForceQP */
+	BitrateFactor float32 /* used otherwise, e.g. 0.5 halves the bitrate of the range */
+
+	/* optional overrides, typically a modified base.Copy().  Only the
+	 * options x264_encoder_reconfig can change take effect. */
+	Param *X264ParamT
+}
+
+// Validate checks the zone on its own; qpMax is the highest QP allowed by
+// the bit depth (51 for 8-bit).
+func (z *Zone) Validate(qpMax int) error {
+	if z.Start < 0 || z.End < z.Start {
+		return fmt.Errorf("libx264: invalid zone range %d-%d", z.Start, z.End)
+	}
+	if z.ForceQP {
+		if z.QP < 0 || z.QP > qpMax {
+			return fmt.Errorf("libx264: zone %d-%d: QP %d out of range 0-%d", z.Start, z.End, z.QP, qpMax)
+		}
+	} else if !(z.BitrateFactor > 0) {
+		return fmt.Errorf("libx264: zone %d-%d: bitrate factor must be positive", z.Start, z.End)
+	}
+	return nil
+}
+
+// qpBDOffset returns QP_BD_OFFSET, the quantizer range added above 51 (and
+// the rate factor range below 0) by bit depths beyond 8.
+func (param *X264ParamT) qpBDOffset() int {
+	if param.i_bitdepth > 8 {
+		return 6 * int(param.i_bitdepth-8)
+	}
+	return 0
+}
+
+// MaxQP returns the highest quantizer allowed by the bit depth, 51 for
+// 8-bit.
+func (param *X264ParamT) MaxQP() int {
+	return 51 + param.qpBDOffset()
+}
+
+// SetZones validates zones and stores them in rc.zones.  Ranges may not
+// overlap.  The zone array and the zone params live in Go memory kept with
+// param and, once opened, with the encoder.  A nil or empty zones clears
+// them.
+func (param *X264ParamT) SetZones(zones []Zone) error {
+	qpMax := param.MaxQP()
+	sorted := make([]Zone, len(zones))
+	copy(sorted, zones)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+	for i := range sorted {
+		if err := sorted[i].Validate(qpMax); err != nil {
+			return err
+		}
+		if i > 0 && sorted[i].Start <= sorted[i-1].End {
+			return fmt.Errorf("libx264: zones %d-%d and %d-%d overlap",
+				sorted[i-1].Start, sorted[i-1].End, sorted[i].Start, sorted[i].End)
+		}
+	}
+
+	param.rc.psz_zones = 0
+	if len(zones) == 0 {
+		param.rc.zones = nil
+		param.rc.i_zones = 0
+		return nil
+	}
+	cz := make([]X264ZoneT, len(sorted))
+	for i, z := range sorted {
+		cz[i] = X264ZoneT{
+			IStart:         ffcommon.FInt(z.Start),
+			IEnd:           ffcommon.FInt(z.End),
+			BForceQp:       ffcommon.FInt(bool2int(z.ForceQP)),
+			IQp:            ffcommon.FInt(z.QP),
+			FBitrateFactor: ffcommon.FFloat(z.BitrateFactor),
+		}
+		if z.Param != nil {
+			/* x264 frees zone params that have param_free set and must
+			 * not recurse into the zone's own zones */
+			zp := z.Param.Copy()
+			zp.param_free = 0
+			zp.rc.zones = nil
+			zp.rc.i_zones = 0
+			zp.rc.psz_zones = 0
+			cz[i].Param = zp
+			param.keep(zp)
+			for _, v := range zp.take() {
+				param.keep(v)
+			}
+		}
+	}
+	param.keep(cz)
+	param.rc.zones = &cz[0]
+	param.rc.i_zones = ffcommon.FInt(len(cz))
+	return nil
+}
+
+// Zones returns a copy of rc.zones.
+func (param *X264ParamT) Zones() []Zone {
+	if param.rc.zones == nil || param.rc.i_zones <= 0 {
+		return nil
+	}
+	var sh struct {
+		Data *X264ZoneT
+		Len  int
+		Cap  int
+	}
+	sh.Data = param.rc.zones
+	sh.Len = int(param.rc.i_zones)
+	sh.Cap = sh.Len
+	cz := *(*[]X264ZoneT)(unsafe.Pointer(&sh))
+	zones := make([]Zone, len(cz))
+	for i, z := range cz {
+		zones[i] = Zone{
+			Start:         int(z.IStart),
+			End:           int(z.IEnd),
+			ForceQP:       z.BForceQp != 0,
+			QP:            int(z.IQp),
+			BitrateFactor: float32(z.FBitrateFactor),
+			Param:         z.Param,
+		}
+	}
+	return zones
+}
+
+func bool2int(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,46 @@
+package libx264
+
+import (
+	"testing"
+
+	"github.com/moonfdd/ffmpeg-go/ffcommon"
+)
+
+func TestSetZones(t *testing.T) {
+	tests := []struct {
+		name  string
+		depth int
+		zones []Zone
+		ok    bool
+	}{
+		{"empty", 8, nil, true},
+		{"qp and factor", 8, []Zone{{Start: 100, End: 199, BitrateFactor: 0.5}, {Start: 0, End: 99, ForceQP: true, QP: 30}}, true},
+		{"qp above 8-bit range", 8, []Zone{{Start: 0, End: 9, ForceQP: true, QP: 52}}, false},
+		{"qp in 10-bit range", 10, []Zone{{Start: 0, End: 9, ForceQP: true, QP: 63}}, true},
+		{"qp above 10-bit range", 10, []Zone{{Start: 0, End: 9, ForceQP: true, QP: 64}}, false},
+		{"negative qp", 8, []Zone{{Start: 0, End: 9, ForceQP: true, QP: -1}}, false},
+		{"zero factor", 8, []Zone{{Start: 0, End: 9}}, false},
+		{"reversed range", 8, []Zone{{Start: 9, End: 0, BitrateFactor: 1}}, false},
+		{"overlap", 8, []Zone{{Start: 0, End: 10, BitrateFactor: 1}, {Start: 10, End: 20, BitrateFactor: 2}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			param := new(X264ParamT)
+			param.i_bitdepth = ffcommon.FInt(tt.depth)
+			defer param.Release()
+			err := param.SetZones(tt.zones)
+			if (err == nil) != tt.ok {
+				t.Fatalf("SetZones: %v", err)
+			}
+			if err != nil {
+				return
+			}
+			if int(param.rc.i_zones) != len(tt.zones) {
+				t.Fatalf("%d zones stored, want %d", param.rc.i_zones, len(tt.zones))
+			}
+			if len(tt.zones) > 0 && param.rc.zones.IStart != 0 {
+				t.Errorf("zones not sorted: first starts at %d", param.rc.zones.IStart)
+			}
+		})
+	}
+}
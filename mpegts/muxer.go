@@ -0,0 +1,231 @@
+// Package mpegts writes H.264 elementary streams into an MPEG-2 transport
+// stream, as used for HLS segments.
+package mpegts
+
+import (
+	"io"
+)
+
+const (
+	PacketSize = 188
+	syncByte   = 0x47
+
+	PidPAT   = 0x0000
+	PidPMT   = 0x1000
+	PidVideo = 0x0100
+
+	streamTypeH264 = 0x1b
+	streamIdVideo  = 0xe0
+	programNumber  = 1
+
+	/* 33-bit PTS/DTS/PCR base */
+	timestampMask = 1<<33 - 1
+
+	/* ISO 13818-1 requires a PCR at least every 100 ms */
+	PCRInterval = 90000 / 10
+)
+
+// aud is an access unit delimiter (primary_pic_type=7, any slice type).
+var aud = []byte{0, 0, 0, 1, 9, 0xf0}
+
+// Muxer writes a single H.264 video program.  All timestamps are in the
+// 90 kHz MPEG clock.
+type Muxer struct {
+	w  io.Writer
+	cc map[uint16]byte
+
+	/* insert an access unit delimiter before every picture that lacks one (required by HLS) */
+	InsertAUD bool
+
+	pkt     [PacketSize]byte
+	lastPCR int64
+	sentPCR bool
+	lastDts int64
+}
+
+// NewMuxer returns a muxer writing TS packets to w.
+func NewMuxer(w io.Writer) *Muxer {
+	return &Muxer{
+		w:         w,
+		cc:        make(map[uint16]byte),
+		InsertAUD: true,
+	}
+}
+
+// WriteTables writes the PAT and PMT.  They must precede the first picture
+// and should be repeated at the start of every segment.
+func (m *Muxer) WriteTables() error {
+	pat := []byte{
+		0x00,       /* table_id */
+		0xb0, 0x0d, /* section_syntax_indicator, section_length=13 */
+		0x00, 0x01, /* transport_stream_id */
+		0xc1,       /* version 0, current_next */
+		0x00, 0x00, /* section_number, last_section_number */
+		byte(programNumber >> 8), byte(programNumber),
+		0xe0 | byte(PidPMT>>8), byte(PidPMT & 0xff),
+	}
+	if err := m.writeSection(PidPAT, pat); err != nil {
+		return err
+	}
+	pmt := []byte{
+		0x02,       /* table_id */
+		0xb0, 0x12, /* section_syntax_indicator, section_length=18 */
+		byte(programNumber >> 8), byte(programNumber),
+		0xc1,
+		0x00, 0x00,
+		0xe0 | byte(PidVideo>>8), byte(PidVideo & 0xff), /* PCR_PID */
+		0xf0, 0x00, /* program_info_length */
+		streamTypeH264,
+		0xe0 | byte(PidVideo>>8), byte(PidVideo & 0xff),
+		0xf0, 0x00, /* ES_info_length */
+	}
+	return m.writeSection(PidPMT, pmt)
+}
+
+func (m *Muxer) writeSection(pid uint16, section []byte) error {
+	crc := crc32(section)
+	section = append(section, byte(crc>>24), byte(crc>>16), byte(crc>>8), byte(crc))
+
+	p := m.pkt[:]
+	p[0] = syncByte
+	p[1] = 0x40 | byte(pid>>8) /* payload_unit_start_indicator */
+	p[2] = byte(pid)
+	p[3] = 0x10 | m.nextCC(pid)
+	p[4] = 0 /* pointer_field */
+	n := copy(p[5:], section)
+	for i := 5 + n; i < PacketSize; i++ {
+		p[i] = 0xff
+	}
+	_, err := m.w.Write(p)
+	return err
+}
+
+// WriteVideo writes one picture.  data is the Annex-B encoded access unit,
+// pts and dts are in 90 kHz units.  A PCR taken from the DTS is sent with
+// every keyframe and with every picture after which, at the current frame
+// rate, the next one would come more than PCRInterval after the last PCR.
+func (m *Muxer) WriteVideo(data []byte, pts, dts int64, keyframe bool) error {
+	if m.InsertAUD && !startsWithAUD(data) {
+		data = append(append(make([]byte, 0, len(aud)+len(data)), aud...), data...)
+	}
+
+	hdr := make([]byte, 0, 19)
+	hdr = append(hdr, 0, 0, 1, streamIdVideo, 0, 0) /* PES_packet_length=0: unbounded */
+	if pts != dts {
+		hdr = append(hdr, 0x80, 0xc0, 10)
+		hdr = appendTimestamp(hdr, 0x3, pts)
+		hdr = appendTimestamp(hdr, 0x1, dts)
+	} else {
+		hdr = append(hdr, 0x80, 0x80, 5)
+		hdr = appendTimestamp(hdr, 0x2, pts)
+	}
+	pes := append(hdr, data...)
+
+	step := dts - m.lastDts
+	if step < 0 {
+		step = 0
+	}
+	m.lastDts = dts
+	needPCR := keyframe || !m.sentPCR || dts < m.lastPCR || dts+step-m.lastPCR > PCRInterval
+
+	first := true
+	for len(pes) > 0 {
+		p := m.pkt[:]
+		p[0] = syncByte
+		p[1] = byte(PidVideo >> 8)
+		if first {
+			p[1] |= 0x40
+		}
+		p[2] = byte(PidVideo & 0xff)
+
+		var af []byte
+		if first && needPCR {
+			/* PCR_flag, random_access_indicator on keyframes */
+			pcr := dts & timestampMask
+			af = []byte{0x10,
+				byte(pcr >> 25), byte(pcr >> 17), byte(pcr >> 9), byte(pcr >> 1),
+				byte(pcr<<7) | 0x7e, 0x00}
+			if keyframe {
+				af[0] |= 0x40
+			}
+			m.lastPCR, m.sentPCR = dts, true
+		}
+		room := PacketSize - 4
+		if af != nil {
+			room -= 1 + len(af)
+		}
+		if len(pes) < room {
+			/* stuff the last packet through the adaptation field */
+			stuffing := room - len(pes)
+			if af == nil {
+				if stuffing == 1 {
+					af = []byte{}
+				} else {
+					af = []byte{0x00}
+				}
+				stuffing -= 1 + len(af)
+			}
+			for i := 0; i < stuffing; i++ {
+				af = append(af, 0xff)
+			}
+			room = len(pes)
+		}
+
+		i := 4
+		if af != nil {
+			p[3] = 0x30 | m.nextCC(PidVideo)
+			p[4] = byte(len(af))
+			copy(p[5:], af)
+			i = 5 + len(af)
+		} else {
+			p[3] = 0x10 | m.nextCC(PidVideo)
+		}
+		copy(p[i:], pes[:room])
+		pes = pes[room:]
+		first = false
+		if _, err := m.w.Write(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Muxer) nextCC(pid uint16) byte {
+	cc := m.cc[pid]
+	m.cc[pid] = (cc + 1) & 0x0f
+	return cc
+}
+
+func appendTimestamp(b []byte, prefix byte, ts int64) []byte {
+	ts &= timestampMask
+	return append(b,
+		prefix<<4|byte(ts>>29)&0x0e|1,
+		byte(ts>>22),
+		byte(ts>>14)|1,
+		byte(ts>>7),
+		byte(ts<<1)|1)
+}
+
+func startsWithAUD(data []byte) bool {
+	for i := 0; i+3 < len(data) && i < 4; i++ {
+		if data[i] == 0 && data[i+1] == 0 && data[i+2] == 1 {
+			return data[i+3]&0x1f == 9
+		}
+	}
+	return false
+}
+
+func crc32(data []byte) uint32 {
+	crc := uint32(0xffffffff)
+	for _, b := range data {
+		crc ^= uint32(b) << 24
+		for i := 0; i < 8; i++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,238 @@
+package mpegts
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/moonfdd/ffmpeg-go/ffcommon"
+	"github.com/moonfdd/x264-go/libx264"
+)
+
+type tsPacket struct {
+	pid     uint16
+	start   bool
+	cc      byte
+	rai     bool
+	pcr     int64 /* -1 if absent */
+	payload []byte
+}
+
+func parsePackets(t *testing.T, data []byte) []tsPacket {
+	t.Helper()
+	if len(data)%PacketSize != 0 {
+		t.Fatalf("%d bytes is not a multiple of %d", len(data), PacketSize)
+	}
+	var pkts []tsPacket
+	for off := 0; off < len(data); off += PacketSize {
+		p := data[off : off+PacketSize]
+		if p[0] != syncByte {
+			t.Fatalf("packet %d: sync byte %#x", len(pkts), p[0])
+		}
+		pkt := tsPacket{
+			pid:   uint16(p[1]&0x1f)<<8 | uint16(p[2]),
+			start: p[1]&0x40 != 0,
+			cc:    p[3] & 0x0f,
+			pcr:   -1,
+		}
+		i := 4
+		if p[3]&0x20 != 0 {
+			n := int(p[4])
+			if n > 0 {
+				pkt.rai = p[5]&0x40 != 0
+				if p[5]&0x10 != 0 {
+					pkt.pcr = int64(p[6])<<25 | int64(p[7])<<17 | int64(p[8])<<9 | int64(p[9])<<1 | int64(p[10])>>7
+				}
+			}
+			i = 5 + n
+		}
+		if p[3]&0x10 != 0 {
+			pkt.payload = p[i:]
+		}
+		pkts = append(pkts, pkt)
+	}
+	return pkts
+}
+
+func readTimestamp(b []byte) int64 {
+	return int64(b[0]>>1&0x07)<<30 | int64(b[1])<<22 | int64(b[2]>>1)<<15 | int64(b[3])<<7 | int64(b[4]>>1)
+}
+
+func TestTables(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewMuxer(&buf)
+	if err := m.WriteTables(); err != nil {
+		t.Fatal(err)
+	}
+	pkts := parsePackets(t, buf.Bytes())
+	for i, want := range []uint16{PidPAT, PidPMT} {
+		if pkts[i].pid != want || !pkts[i].start {
+			t.Fatalf("packet %d: pid %#x, want %#x", i, pkts[i].pid, want)
+		}
+		section := pkts[i].payload[1:]
+		length := int(section[1]&0x0f)<<8 | int(section[2])
+		if crc := crc32(section[:3+length]); crc != 0 {
+			t.Errorf("pid %#x: CRC residue %#x", want, crc)
+		}
+	}
+}
+
+func TestWriteVideo(t *testing.T) {
+	tests := []struct {
+		name     string
+		frameDur int64 /* 90 kHz */
+		gop      int
+		frames   int
+		bframes  bool
+		size     int
+	}{
+		{"25fps 2s gop", 3600, 50, 120, false, 1000},
+		{"60fps 2s gop b-frames", 1500, 120, 200, true, 300},
+		{"5fps", 18000, 10, 25, false, 5000},
+		{"tiny frames", 3000, 250, 300, false, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			m := NewMuxer(&buf)
+			if err := m.WriteTables(); err != nil {
+				t.Fatal(err)
+			}
+			type frame struct{ pts, dts int64 }
+			var frames []frame
+			for i := 0; i < tt.frames; i++ {
+				dts := int64(i) * tt.frameDur
+				pts := dts
+				if tt.bframes {
+					pts += 2 * tt.frameDur
+				}
+				frames = append(frames, frame{pts, dts})
+				data := append([]byte{0, 0, 0, 1, 0x65}, bytes.Repeat([]byte{0xaa}, tt.size)...)
+				if err := m.WriteVideo(data, pts, dts, i%tt.gop == 0); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			pkts := parsePackets(t, buf.Bytes())
+			cc := map[uint16]byte{}
+			n, lastPCR := 0, int64(-1)
+			for i, p := range pkts {
+				if want, ok := cc[p.pid]; ok && p.cc != want {
+					t.Fatalf("packet %d: continuity counter %d, want %d", i, p.cc, want)
+				}
+				cc[p.pid] = (p.cc + 1) & 0x0f
+				if p.pid != PidVideo {
+					continue
+				}
+				if p.pcr >= 0 {
+					if lastPCR >= 0 && p.pcr-lastPCR > PCRInterval && p.pcr-lastPCR > tt.frameDur {
+						t.Errorf("packet %d: PCR gap %d exceeds %d", i, p.pcr-lastPCR, PCRInterval)
+					}
+					lastPCR = p.pcr
+				}
+				if !p.start {
+					continue
+				}
+				f := frames[n]
+				keyframe := n%tt.gop == 0
+				if p.rai != keyframe {
+					t.Errorf("frame %d: random_access_indicator %v", n, p.rai)
+				}
+				if keyframe && p.pcr != f.dts {
+					t.Errorf("frame %d: keyframe PCR %d, want %d", n, p.pcr, f.dts)
+				}
+				if f.dts-lastPCR > PCRInterval {
+					t.Errorf("frame %d: %d ticks since the last PCR", n, f.dts-lastPCR)
+				}
+				pes := p.payload
+				if !bytes.Equal(pes[:4], []byte{0, 0, 1, streamIdVideo}) {
+					t.Fatalf("frame %d: no PES header", n)
+				}
+				if pts := readTimestamp(pes[9:]); pts != f.pts {
+					t.Errorf("frame %d: PTS %d, want %d", n, pts, f.pts)
+				}
+				if pes[7]&0x40 != 0 {
+					if dts := readTimestamp(pes[14:]); dts != f.dts {
+						t.Errorf("frame %d: DTS %d, want %d", n, dts, f.dts)
+					}
+				} else if f.pts != f.dts {
+					t.Errorf("frame %d: DTS missing", n)
+				}
+				n++
+			}
+			if n != tt.frames {
+				t.Errorf("%d PES packets, want %d", n, tt.frames)
+			}
+		})
+	}
+}
+
+func TestNewSink(t *testing.T) {
+	for _, tt := range []struct {
+		num, den int64
+		ok       bool
+	}{
+		{1, 90000, true},
+		{1001, 30000, true},
+		{1, 0, false},
+		{0, 25, false},
+		{-1, 25, false},
+	} {
+		_, err := NewSink(&bytes.Buffer{}, tt.num, tt.den)
+		if (err == nil) != tt.ok {
+			t.Errorf("timebase %d/%d: %v", tt.num, tt.den, err)
+		}
+	}
+}
+
+/* x264Nal returns unit as x264 outputs it with b_annexb on or off */
+func x264Nal(unit []byte, annexb bool) libx264.X264NalT {
+	p := []byte{0, 0, 0, 1}
+	if !annexb {
+		binary.BigEndian.PutUint32(p, uint32(len(unit)))
+	}
+	p = append(p, unit...)
+	return libx264.X264NalT{
+		IRefIdc:        ffcommon.FInt(unit[0] >> 5),
+		IType:          ffcommon.FInt(unit[0] & 0x1f),
+		BLongStartcode: 1,
+		IPayload:       ffcommon.FInt(len(p)),
+		PPayload:       (*ffcommon.FUint8T)(&p[0]),
+	}
+}
+
+func TestSinkAnnexB(t *testing.T) {
+	sps := []byte{0x67, 0x42, 0xc0, 0x0d, 0xd9}
+	pps := []byte{0x68, 0xce, 0x3c, 0x80}
+	idr := append([]byte{0x65}, bytes.Repeat([]byte{0xab}, 300)...)
+	for _, annexb := range []bool{true, false} {
+		var out bytes.Buffer
+		sink, err := NewSink(&out, 1, 25)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sink.WriteHeaders([]libx264.X264NalT{x264Nal(sps, annexb), x264Nal(pps, annexb)}); err != nil {
+			t.Fatal(err)
+		}
+		/* b_repeat_headers off: the sink prepends the SPS and PPS */
+		if err := sink.WriteFrame(&libx264.Frame{Nals: []libx264.X264NalT{x264Nal(idr, annexb)}, Keyframe: true}); err != nil {
+			t.Fatal(err)
+		}
+		if err := sink.Close(); err != nil {
+			t.Fatal(err)
+		}
+		var pes []byte
+		for _, p := range parsePackets(t, out.Bytes()) {
+			if p.pid == PidVideo {
+				pes = append(pes, p.payload...)
+			}
+		}
+		var want []byte
+		for _, u := range [][]byte{sps, pps, idr} {
+			want = append(append(want, 0, 0, 0, 1), u...)
+		}
+		if es := pes[9+int(pes[8]):]; !bytes.HasSuffix(es, want) || len(es)-len(want) > len(aud) {
+			t.Errorf("annexb %v: elementary stream\n%x\nwant\n%x", annexb, es, want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package mpegts
+
+import (
+	"bufio"
+	"errors"
+	"io"
+
+	"github.com/moonfdd/x264-go/internal/media"
+	"github.com/moonfdd/x264-go/libx264"
+)
+
+var ErrTimebase = errors.New("mpegts: invalid timebase")
+
+type muxerSink struct {
+	m       *Muxer
+	w       *bufio.Writer
+	c       io.Closer
+	num     int64
+	den     int64
+	started bool
+	offset  int64
+	headers []byte
+}
+
+// NewSink returns a libx264.Sink writing a transport stream to w.  pts and
+// dts are converted from the timebase timebaseNum/timebaseDen and shifted so
+// that the first DTS is not negative.  PAT/PMT are repeated before every
+// keyframe.  If w is an io.Closer it is closed by Close.
+func NewSink(w io.Writer, timebaseNum, timebaseDen int64) (libx264.Sink, error) {
+	if timebaseNum <= 0 || timebaseDen <= 0 {
+		return nil, ErrTimebase
+	}
+	bw := bufio.NewWriter(w)
+	s := &muxerSink{m: NewMuxer(bw), w: bw, num: timebaseNum, den: timebaseDen}
+	if c, ok := w.(io.Closer); ok {
+		s.c = c
+	}
+	return s, nil
+}
+
+func (s *muxerSink) WriteHeaders(nals []libx264.X264NalT) error {
+	for i := range nals {
+		switch nals[i].IType {
+		case libx264.NAL_SPS, libx264.NAL_PPS:
+			s.headers = nals[i].AppendAnnexB(s.headers)
+		}
+	}
+	return nil
+}
+
+func (s *muxerSink) WriteFrame(f *libx264.Frame) error {
+	var data []byte
+	hasSPS := false
+	for i := range f.Nals {
+		hasSPS = hasSPS || f.Nals[i].IType == libx264.NAL_SPS
+		data = f.Nals[i].AppendAnnexB(data)
+	}
+	if !s.started {
+		s.started = true
+		if d := s.to90k(f.Dts); d < 0 {
+			s.offset = -d
+		}
+	}
+	if f.Keyframe {
+		if !hasSPS {
+			data = append(append([]byte(nil), s.headers...), data...)
+		}
+		if err := s.m.WriteTables(); err != nil {
+			return err
+		}
+	}
+	return s.m.WriteVideo(data, s.to90k(f.Pts)+s.offset, s.to90k(f.Dts)+s.offset, f.Keyframe)
+}
+
+func (s *muxerSink) Close() error {
+	err := s.w.Flush()
+	if s.c != nil {
+		if cerr := s.c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (s *muxerSink) to90k(ts int64) int64 {
+	return media.Rescale(ts, s.num*90000, s.den)
+}
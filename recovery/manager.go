@@ -0,0 +1,294 @@
+// Package recovery repairs a real-time stream after packet loss reported
+// by the receiver.  A Manager remembers the frames that were sent, maps
+// NACKed packets back to frame PTS and picks the cheapest repair:
+// x264_encoder_invalidate_reference, an intra refresh or a forced IDR.
+package recovery
+
+import (
+	"sync"
+
+	"github.com/moonfdd/x264-go/libx264"
+)
+
+// Encoder is the part of *libx264.Encoder the manager drives.
+type Encoder interface {
+	InvalidateReference(pts int64) error
+	IntraRefresh() error
+}
+
+// Action is the repair chosen for a report.
+type Action int
+
+const (
+	ActionNone Action = iota /* already repaired by a later keyframe or pending repair */
+	ActionInvalidate
+	ActionIntraRefresh
+	ActionKeyframe
+)
+
+func (a Action) String() string {
+	switch a {
+	case ActionInvalidate:
+		return "invalidate"
+	case ActionIntraRefresh:
+		return "intra-refresh"
+	case ActionKeyframe:
+		return "keyframe"
+	}
+	return "none"
+}
+
+// Config tunes the manager.  Zero fields take the defaults noted.
+type Config struct {
+	/* number of sent frames remembered, default 256; losses of older
+	 * frames are repaired with a keyframe */
+	History int
+	/* repair with x264_encoder_intra_refresh (encoder opened with
+	 * b_intra_refresh) instead of invalidating references */
+	UseIntraRefresh bool
+}
+
+// Stats are cumulative counters.
+type Stats struct {
+	Nacks              int /* NACK reports */
+	Plis               int /* PLI reports */
+	LostFrames         int /* distinct frames reported lost */
+	UnknownLosses      int /* lost packets not mapped to a remembered frame */
+	Ignored            int /* losses already repaired */
+	Invalidations      int
+	InvalidateFailures int
+	IntraRefreshes     int
+	Keyframes          int /* IDRs forced by Apply */
+}
+
+type sentFrame struct {
+	pts      int64
+	keyframe bool
+	seq      uint16 /* first RTP sequence number */
+	packets  int
+	hasSeq   bool
+}
+
+// Manager tracks sent frames and turns receiver reports into repairs.
+// Reports may arrive from any goroutine; the repairs themselves are made
+// by Apply, which must be called from the encoding goroutine before each
+// Encode.
+type Manager struct {
+	cfg Config
+	enc Encoder
+
+	mu       sync.Mutex
+	frames   []sentFrame /* ring of the last cfg.History frames, in sending order */
+	next     int
+	lostPts  []int64
+	pli      bool
+	keyframe bool  /* IDR needed, set on the next input picture */
+	pending  bool  /* IDR forced, not yet out of the encoder */
+	forced   int64 /* pts of the picture the pending IDR was forced on */
+	stats    Stats
+}
+
+// NewManager returns a manager repairing through enc.
+func NewManager(enc Encoder, cfg Config) *Manager {
+	if cfg.History <= 0 {
+		cfg.History = 256
+	}
+	return &Manager{cfg: cfg, enc: enc}
+}
+
+// Sent records a frame leaving the encoder.
+func (m *Manager) Sent(pts int64, keyframe bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.add(sentFrame{pts: pts, keyframe: keyframe})
+}
+
+// SentPackets records a frame carried by the RTP packets with sequence
+// numbers first..first+packets-1, so that NACKs can be mapped to it.
+func (m *Manager) SentPackets(pts int64, keyframe bool, first uint16, packets int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.add(sentFrame{pts: pts, keyframe: keyframe, seq: first, packets: packets, hasSeq: true})
+}
+
+func (m *Manager) add(f sentFrame) {
+	if f.keyframe {
+		m.keyframe = false
+		/* keyframes already in the encoder's delay precede the loss, only
+		 * the forced IDR itself ends the wait */
+		if f.pts == m.forced {
+			m.pending = false
+		}
+	}
+	if len(m.frames) < m.cfg.History {
+		m.frames = append(m.frames, f)
+		return
+	}
+	m.frames[m.next] = f
+	m.next = (m.next + 1) % len(m.frames)
+}
+
+// Nack reports lost RTP packets.
+func (m *Manager) Nack(seqs []uint16) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stats.Nacks++
+	for _, seq := range seqs {
+		i := m.findSeq(seq)
+		if i < 0 {
+			m.stats.UnknownLosses++
+			m.keyframe = m.keyframe || !m.pending
+			continue
+		}
+		m.lose(i)
+	}
+}
+
+// NackPts reports lost frames by PTS, for transports without sequence
+// numbers.
+func (m *Manager) NackPts(pts ...int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stats.Nacks++
+	for _, p := range pts {
+		i := m.findPts(p)
+		if i < 0 {
+			m.stats.UnknownLosses++
+			m.keyframe = m.keyframe || !m.pending
+			continue
+		}
+		m.lose(i)
+	}
+}
+
+// Pli reports that the receiver cannot decode anymore and needs a picture
+// it can decode without references.
+func (m *Manager) Pli() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stats.Plis++
+	m.pli = true
+}
+
+// lose queues the frame at ring position i unless a keyframe was sent
+// after it.
+func (m *Manager) lose(i int) {
+	pts := m.frames[i].pts
+	for _, p := range m.lostPts {
+		if p == pts {
+			return
+		}
+	}
+	m.stats.LostFrames++
+	if m.pending {
+		m.stats.Ignored++
+		return
+	}
+	for j := (i + 1) % len(m.frames); j != m.next; j = (j + 1) % len(m.frames) {
+		if m.frames[j].keyframe {
+			m.stats.Ignored++
+			return
+		}
+	}
+	m.lostPts = append(m.lostPts, pts)
+}
+
+func (m *Manager) findSeq(seq uint16) int {
+	for i, f := range m.frames {
+		if f.hasSeq && seq-f.seq < uint16(f.packets) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *Manager) findPts(pts int64) int {
+	for i, f := range m.frames {
+		if f.pts == pts {
+			return i
+		}
+	}
+	return -1
+}
+
+// Apply makes the pending repairs and forces an IDR on the next input
+// picture when one is needed.  Otherwise the picture type is left alone,
+// so types forced elsewhere survive; reused pictures must be reset by the
+// caller.  The pts of pic must already be set, it identifies the forced
+// IDR when it leaves the encoder.  It returns the strongest action taken.
+func (m *Manager) Apply(pic *libx264.X264PictureT) Action {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	act := ActionNone
+	if m.pli && m.pending {
+		m.pli = false
+		m.stats.Ignored++
+	}
+	if m.pli {
+		m.pli = false
+		if m.cfg.UseIntraRefresh && !m.keyframe {
+			if m.enc.IntraRefresh() == nil {
+				m.stats.IntraRefreshes++
+				act = ActionIntraRefresh
+			} else {
+				m.keyframe = true
+			}
+		} else {
+			m.keyframe = true
+		}
+		m.lostPts = m.lostPts[:0]
+	}
+	if len(m.lostPts) > 0 && !m.keyframe {
+		if m.cfg.UseIntraRefresh {
+			if act == ActionNone && m.enc.IntraRefresh() == nil {
+				m.stats.IntraRefreshes++
+				act = ActionIntraRefresh
+			}
+		} else {
+			for _, pts := range m.lostPts {
+				if err := m.enc.InvalidateReference(pts); err != nil {
+					m.stats.InvalidateFailures++
+					m.keyframe = true
+					break
+				}
+				m.stats.Invalidations++
+				act = ActionInvalidate
+			}
+		}
+	}
+	m.lostPts = m.lostPts[:0]
+
+	if !m.keyframe {
+		return act
+	}
+	/* later losses are covered until the IDR is seen by Sent */
+	m.stats.Keyframes++
+	pic.SetType(libx264.X264_TYPE_IDR)
+	m.keyframe = false
+	m.pending = true
+	m.forced = pic.IPts
+	return ActionKeyframe
+}
+
+// Stats returns the counters.
+func (m *Manager) Stats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stats
+}
+
+type managerSink struct {
+	libx264.Sink
+	m *Manager
+}
+
+// Sink returns s recording every frame written to it with Sent.  Use
+// SentPackets instead when NACKs carry RTP sequence numbers.
+func (m *Manager) Sink(s libx264.Sink) libx264.Sink {
+	return managerSink{s, m}
+}
+
+func (k managerSink) WriteFrame(f *libx264.Frame) error {
+	k.m.Sent(f.Pts, f.Keyframe)
+	return k.Sink.WriteFrame(f)
+}
@@ -0,0 +1,141 @@
+package recovery
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/moonfdd/ffmpeg-go/ffcommon"
+	"github.com/moonfdd/x264-go/libx264"
+)
+
+type fakeEncoder struct {
+	invalidated []int64
+	refreshes   int
+	fail        bool
+}
+
+func (e *fakeEncoder) InvalidateReference(pts int64) error {
+	if e.fail {
+		return errors.New("invalidate failed")
+	}
+	e.invalidated = append(e.invalidated, pts)
+	return nil
+}
+
+func (e *fakeEncoder) IntraRefresh() error {
+	e.refreshes++
+	return nil
+}
+
+func TestManager(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         Config
+		keyframes   []int64 /* pts of the keyframes among frames 0-9 */
+		nack        []uint16
+		nackPts     []int64
+		pli         bool
+		fail        bool
+		want        Action
+		invalidated []int64
+		refreshes   int
+	}{
+		{"nack invalidates", Config{}, []int64{0}, []uint16{13, 14, 22}, nil, false, false,
+			ActionInvalidate, []int64{4, 7}, 0},
+		{"nack by pts", Config{}, []int64{0}, nil, []int64{5, 5}, false, false,
+			ActionInvalidate, []int64{5}, 0},
+		{"repaired by a later keyframe", Config{}, []int64{0, 6}, []uint16{10}, nil, false, false,
+			ActionNone, nil, 0},
+		{"unknown packet", Config{}, []int64{0}, []uint16{300}, nil, false, false,
+			ActionKeyframe, nil, 0},
+		{"forgotten frame", Config{History: 4}, []int64{0}, []uint16{1}, nil, false, false,
+			ActionKeyframe, nil, 0},
+		{"invalidate fails", Config{}, []int64{0}, []uint16{20}, nil, false, true,
+			ActionKeyframe, nil, 0},
+		{"pli", Config{}, []int64{0}, []uint16{20}, nil, true, false,
+			ActionKeyframe, nil, 0},
+		{"intra refresh", Config{UseIntraRefresh: true}, []int64{0}, []uint16{20, 25}, nil, false, false,
+			ActionIntraRefresh, nil, 1},
+		{"pli with intra refresh", Config{UseIntraRefresh: true}, []int64{0}, nil, nil, true, false,
+			ActionIntraRefresh, nil, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc := &fakeEncoder{fail: tt.fail}
+			m := NewManager(enc, tt.cfg)
+			/* frames 0-9 of 3 packets each, frame i starting at sequence 3i */
+			for i := int64(0); i < 10; i++ {
+				key := false
+				for _, k := range tt.keyframes {
+					key = key || k == i
+				}
+				m.SentPackets(i, key, uint16(3*i), 3)
+			}
+			if tt.nack != nil {
+				m.Nack(tt.nack)
+			}
+			if tt.nackPts != nil {
+				m.NackPts(tt.nackPts...)
+			}
+			if tt.pli {
+				m.Pli()
+			}
+
+			var pic libx264.X264PictureT
+			pic.SetType(libx264.X264_TYPE_P)
+			if act := m.Apply(&pic); act != tt.want {
+				t.Errorf("Apply: %v, want %v", act, tt.want)
+			}
+			want := ffcommon.FInt(libx264.X264_TYPE_P)
+			if tt.want == ActionKeyframe {
+				want = libx264.X264_TYPE_IDR
+			}
+			if pic.Type() != want {
+				t.Errorf("picture type %d, want %d", pic.Type(), want)
+			}
+			if !reflect.DeepEqual(enc.invalidated, tt.invalidated) || enc.refreshes != tt.refreshes {
+				t.Errorf("invalidated %v, %d refreshes", enc.invalidated, enc.refreshes)
+			}
+
+			/* nothing is repaired twice */
+			pic.SetType(libx264.X264_TYPE_AUTO)
+			if act := m.Apply(&pic); act != ActionNone || pic.Type() != libx264.X264_TYPE_AUTO {
+				t.Errorf("second Apply: %v type %d", act, pic.Type())
+			}
+		})
+	}
+}
+
+func TestManagerPendingKeyframe(t *testing.T) {
+	enc := &fakeEncoder{}
+	m := NewManager(enc, Config{})
+	m.Sent(0, true)
+	m.Sent(1, false)
+	m.Pli()
+	pic := libx264.X264PictureT{IPts: 4}
+	if act := m.Apply(&pic); act != ActionKeyframe {
+		t.Fatalf("Apply: %v", act)
+	}
+
+	/* losses before the forced IDR leaves the encoder are covered by it,
+	 * even once a keyframe that was already in the encoder is out */
+	m.Sent(2, true)
+	m.Sent(3, false)
+	m.NackPts(3)
+	m.Pli()
+	if act := m.Apply(&pic); act != ActionNone || len(enc.invalidated) != 0 {
+		t.Errorf("Apply with an IDR pending: %v, invalidated %v", act, enc.invalidated)
+	}
+
+	m.Sent(4, true)
+	m.Sent(5, false)
+	m.NackPts(5)
+	if act := m.Apply(&pic); act != ActionInvalidate || !reflect.DeepEqual(enc.invalidated, []int64{5}) {
+		t.Errorf("Apply after the IDR: %v, invalidated %v", act, enc.invalidated)
+	}
+	s := m.Stats()
+	if s.Keyframes != 1 || s.Plis != 2 || s.LostFrames != 2 || s.Ignored != 2 || s.Invalidations != 1 {
+		t.Errorf("stats %+v", s)
+	}
+}
@@ -0,0 +1,174 @@
+package rtmp
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+)
+
+/* AMF0 type markers */
+const (
+	amfNumber      = 0x00
+	amfBoolean     = 0x01
+	amfString      = 0x02
+	amfObject      = 0x03
+	amfNull        = 0x05
+	amfUndefined   = 0x06
+	amfECMAArray   = 0x08
+	amfObjectEnd   = 0x09
+	amfStrictArray = 0x0a
+)
+
+var ErrAMF = errors.New("rtmp: malformed AMF0 data")
+
+// Object is an AMF0 object or ECMA array.
+type Object map[string]interface{}
+
+// encodeAMF encodes values as AMF0.  Supported Go types are float64, int,
+// bool, string, nil and Object.
+func encodeAMF(values ...interface{}) []byte {
+	var b []byte
+	for _, v := range values {
+		b = appendAMF(b, v)
+	}
+	return b
+}
+
+func appendAMF(b []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(b, amfNull)
+	case float64:
+		b = append(b, amfNumber, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(b[len(b)-8:], math.Float64bits(v))
+		return b
+	case int:
+		return appendAMF(b, float64(v))
+	case bool:
+		if v {
+			return append(b, amfBoolean, 1)
+		}
+		return append(b, amfBoolean, 0)
+	case string:
+		b = append(b, amfString)
+		return appendAMFString(b, v)
+	case Object:
+		b = append(b, amfObject)
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			b = appendAMFString(b, k)
+			b = appendAMF(b, v[k])
+		}
+		return append(b, 0, 0, amfObjectEnd)
+	}
+	return append(b, amfUndefined)
+}
+
+func appendAMFString(b []byte, s string) []byte {
+	b = append(b, byte(len(s)>>8), byte(len(s)))
+	return append(b, s...)
+}
+
+// decodeAMF decodes all AMF0 values in b.
+func decodeAMF(b []byte) ([]interface{}, error) {
+	var values []interface{}
+	for len(b) > 0 {
+		v, n, err := decodeAMFValue(b)
+		if err != nil {
+			return values, err
+		}
+		values = append(values, v)
+		b = b[n:]
+	}
+	return values, nil
+}
+
+func decodeAMFValue(b []byte) (interface{}, int, error) {
+	if len(b) < 1 {
+		return nil, 0, ErrAMF
+	}
+	switch b[0] {
+	case amfNumber:
+		if len(b) < 9 {
+			return nil, 0, ErrAMF
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b[1:])), 9, nil
+	case amfBoolean:
+		if len(b) < 2 {
+			return nil, 0, ErrAMF
+		}
+		return b[1] != 0, 2, nil
+	case amfString:
+		s, n, err := decodeAMFString(b[1:])
+		return s, n + 1, err
+	case amfNull, amfUndefined:
+		return nil, 1, nil
+	case amfObject:
+		obj, n, err := decodeAMFObject(b[1:])
+		return obj, n + 1, err
+	case amfECMAArray:
+		if len(b) < 5 {
+			return nil, 0, ErrAMF
+		}
+		obj, n, err := decodeAMFObject(b[5:])
+		return obj, n + 5, err
+	case amfStrictArray:
+		if len(b) < 5 {
+			return nil, 0, ErrAMF
+		}
+		/* every element takes at least one byte, which bounds an untrusted count */
+		count := binary.BigEndian.Uint32(b[1:])
+		if uint64(count) > uint64(len(b)-5) {
+			return nil, 0, ErrAMF
+		}
+		off := 5
+		arr := make([]interface{}, 0, count)
+		for i := uint32(0); i < count; i++ {
+			v, n, err := decodeAMFValue(b[off:])
+			if err != nil {
+				return nil, 0, err
+			}
+			arr = append(arr, v)
+			off += n
+		}
+		return arr, off, nil
+	}
+	return nil, 0, ErrAMF
+}
+
+func decodeAMFString(b []byte) (string, int, error) {
+	if len(b) < 2 {
+		return "", 0, ErrAMF
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return "", 0, ErrAMF
+	}
+	return string(b[2 : 2+n]), 2 + n, nil
+}
+
+func decodeAMFObject(b []byte) (Object, int, error) {
+	obj := Object{}
+	off := 0
+	for {
+		if len(b)-off >= 3 && b[off] == 0 && b[off+1] == 0 && b[off+2] == amfObjectEnd {
+			return obj, off + 3, nil
+		}
+		key, n, err := decodeAMFString(b[off:])
+		if err != nil {
+			return nil, 0, err
+		}
+		off += n
+		v, n, err := decodeAMFValue(b[off:])
+		if err != nil {
+			return nil, 0, err
+		}
+		off += n
+		obj[key] = v
+	}
+}
@@ -0,0 +1,262 @@
+package rtmp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+/* message type ids */
+const (
+	MsgSetChunkSize     = 1
+	MsgAbort            = 2
+	MsgAck              = 3
+	MsgUserControl      = 4
+	MsgWindowAckSize    = 5
+	MsgSetPeerBandwidth = 6
+	MsgAudio            = 8
+	MsgVideo            = 9
+	MsgDataAMF0         = 18
+	MsgCommandAMF0      = 20
+)
+
+/* chunk stream ids used for outgoing messages */
+const (
+	csidControl = 2
+	csidCommand = 3
+	csidVideo   = 6
+)
+
+const (
+	defaultChunkSize = 128
+	maxMessageSize   = 16 << 20
+)
+
+var ErrMessageTooLarge = errors.New("rtmp: message too large")
+
+// Message is a complete RTMP message.
+type Message struct {
+	TypeID    byte
+	StreamID  uint32
+	Timestamp uint32 /* milliseconds */
+	Payload   []byte
+}
+
+type chunkHeader struct {
+	timestamp uint32
+	delta     uint32
+	length    uint32
+	typeID    byte
+	streamID  uint32
+	extended  bool
+}
+
+// chunkReader reassembles messages from chunk streams.
+type chunkReader struct {
+	r         *bufio.Reader
+	chunkSize uint32
+	headers   map[uint32]*chunkHeader
+	partial   map[uint32][]byte
+}
+
+func newChunkReader(r io.Reader) *chunkReader {
+	return &chunkReader{
+		r:         bufio.NewReader(r),
+		chunkSize: defaultChunkSize,
+		headers:   make(map[uint32]*chunkHeader),
+		partial:   make(map[uint32][]byte),
+	}
+}
+
+// readMessage returns the next complete message.  Set Chunk Size and Abort
+// messages are applied here and also returned.
+func (c *chunkReader) readMessage() (*Message, error) {
+	for {
+		msg, err := c.readChunk()
+		if err != nil {
+			return nil, err
+		}
+		if msg == nil {
+			continue
+		}
+		switch msg.TypeID {
+		case MsgSetChunkSize:
+			if len(msg.Payload) >= 4 {
+				c.chunkSize = binary.BigEndian.Uint32(msg.Payload) & 0x7fffffff
+			}
+		case MsgAbort:
+			if len(msg.Payload) >= 4 {
+				delete(c.partial, binary.BigEndian.Uint32(msg.Payload))
+			}
+		}
+		return msg, nil
+	}
+}
+
+func (c *chunkReader) readChunk() (*Message, error) {
+	b0, err := c.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	format := b0 >> 6
+	csid := uint32(b0 & 0x3f)
+	switch csid {
+	case 0:
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		csid = 64 + uint32(b)
+	case 1:
+		var b [2]byte
+		if _, err := io.ReadFull(c.r, b[:]); err != nil {
+			return nil, err
+		}
+		csid = 64 + uint32(b[0]) + uint32(b[1])<<8
+	}
+
+	h := c.headers[csid]
+	if h == nil {
+		h = &chunkHeader{}
+		c.headers[csid] = h
+	}
+	var hdr [11]byte
+	switch format {
+	case 0:
+		if _, err := io.ReadFull(c.r, hdr[:11]); err != nil {
+			return nil, err
+		}
+		h.timestamp = uint24(hdr[0:])
+		h.length = uint24(hdr[3:])
+		h.typeID = hdr[6]
+		h.streamID = binary.LittleEndian.Uint32(hdr[7:])
+		h.delta = 0
+		h.extended = h.timestamp == 0xffffff
+	case 1:
+		if _, err := io.ReadFull(c.r, hdr[:7]); err != nil {
+			return nil, err
+		}
+		h.delta = uint24(hdr[0:])
+		h.length = uint24(hdr[3:])
+		h.typeID = hdr[6]
+		h.extended = h.delta == 0xffffff
+	case 2:
+		if _, err := io.ReadFull(c.r, hdr[:3]); err != nil {
+			return nil, err
+		}
+		h.delta = uint24(hdr[0:])
+		h.extended = h.delta == 0xffffff
+	}
+	if h.extended {
+		var ext [4]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return nil, err
+		}
+		if format == 0 {
+			h.timestamp = binary.BigEndian.Uint32(ext[:])
+		} else if format != 3 {
+			h.delta = binary.BigEndian.Uint32(ext[:])
+		}
+	}
+	buf, inProgress := c.partial[csid]
+	if format != 3 {
+		buf, inProgress = nil, false
+	}
+	if !inProgress && format != 0 {
+		/* a new message on this chunk stream */
+		h.timestamp += h.delta
+	}
+	if h.length > maxMessageSize {
+		return nil, ErrMessageTooLarge
+	}
+
+	n := h.length - uint32(len(buf))
+	if n > c.chunkSize {
+		n = c.chunkSize
+	}
+	start := len(buf)
+	buf = append(buf, make([]byte, n)...)
+	if _, err := io.ReadFull(c.r, buf[start:]); err != nil {
+		return nil, err
+	}
+	if uint32(len(buf)) < h.length {
+		c.partial[csid] = buf
+		return nil, nil
+	}
+	delete(c.partial, csid)
+	return &Message{
+		TypeID:    h.typeID,
+		StreamID:  h.streamID,
+		Timestamp: h.timestamp,
+		Payload:   buf,
+	}, nil
+}
+
+// chunkWriter splits messages into chunks.  Every message starts with a
+// type 0 header, so no per-stream state is needed.
+type chunkWriter struct {
+	w         *bufio.Writer
+	chunkSize uint32
+}
+
+func newChunkWriter(w io.Writer) *chunkWriter {
+	return &chunkWriter{w: bufio.NewWriter(w), chunkSize: defaultChunkSize}
+}
+
+func (c *chunkWriter) writeMessage(csid uint32, msg *Message) error {
+	ts := msg.Timestamp
+	extended := ts >= 0xffffff
+	hdr := make([]byte, 0, 18)
+	hdr = appendBasicHeader(hdr, 0, csid)
+	if extended {
+		hdr = append(hdr, 0xff, 0xff, 0xff)
+	} else {
+		hdr = append(hdr, byte(ts>>16), byte(ts>>8), byte(ts))
+	}
+	n := len(msg.Payload)
+	hdr = append(hdr, byte(n>>16), byte(n>>8), byte(n), msg.TypeID)
+	hdr = append(hdr, byte(msg.StreamID), byte(msg.StreamID>>8), byte(msg.StreamID>>16), byte(msg.StreamID>>24))
+	if extended {
+		hdr = append(hdr, byte(ts>>24), byte(ts>>16), byte(ts>>8), byte(ts))
+	}
+	if _, err := c.w.Write(hdr); err != nil {
+		return err
+	}
+
+	payload := msg.Payload
+	for first := true; first || len(payload) > 0; first = false {
+		if !first {
+			cont := appendBasicHeader(hdr[:0], 3, csid)
+			if extended {
+				cont = append(cont, byte(ts>>24), byte(ts>>16), byte(ts>>8), byte(ts))
+			}
+			if _, err := c.w.Write(cont); err != nil {
+				return err
+			}
+		}
+		size := len(payload)
+		if size > int(c.chunkSize) {
+			size = int(c.chunkSize)
+		}
+		if _, err := c.w.Write(payload[:size]); err != nil {
+			return err
+		}
+		payload = payload[size:]
+	}
+	return c.w.Flush()
+}
+
+func appendBasicHeader(b []byte, format byte, csid uint32) []byte {
+	switch {
+	case csid < 64:
+		return append(b, format<<6|byte(csid))
+	case csid < 320:
+		return append(b, format<<6, byte(csid-64))
+	}
+	return append(b, format<<6|1, byte(csid-64), byte((csid-64)>>8))
+}
+
+func uint24(b []byte) uint32 {
+	return uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+}
@@ -0,0 +1,323 @@
+// Package rtmp publishes encoder output to an RTMP ingest server.  It
+// implements the plain handshake, chunking, the connect/createStream/publish
+// command sequence and FLV-style AVC video messages, plus a minimal
+// in-process Server for loopback tests.
+package rtmp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/moonfdd/x264-go/h264"
+	"github.com/moonfdd/x264-go/internal/media"
+	"github.com/moonfdd/x264-go/libx264"
+)
+
+const (
+	DefaultPort      = "1935"
+	outChunkSize     = 4096
+	defaultTimeout   = 10 * time.Second
+	publishStartCode = "NetStream.Publish.Start"
+)
+
+var ErrNoHeaders = errors.New("rtmp: no SPS/PPS before the first keyframe")
+
+// CommandError is returned when the server answers a command with _error
+// or an error level onStatus.
+type CommandError struct {
+	Command string
+	Info    Object
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("rtmp: %s failed: %v %v", e.Command, e.Info["code"], e.Info["description"])
+}
+
+// Client is a publishing RTMP connection.
+type Client struct {
+	conn     net.Conn
+	cr       *chunkReader
+	cw       *chunkWriter
+	txID     float64
+	streamID uint32
+
+	/* timebase of the PTS/DTS passed to WriteFrame, i.e. i_timebase_num/i_timebase_den */
+	TimebaseNum int64
+	TimebaseDen int64
+
+	Timeout time.Duration
+
+	sentHeader bool
+	started    bool
+	offset     int64 /* ms shift keeping DTS non-negative */
+}
+
+// Dial connects to host[:port] and performs the handshake.
+func Dial(host string) (*Client, error) {
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, DefaultPort)
+	}
+	conn, err := net.DialTimeout("tcp", host, defaultTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c, err := NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// NewClient performs the handshake over an established connection.
+func NewClient(conn net.Conn) (*Client, error) {
+	c := &Client{
+		conn:        conn,
+		TimebaseNum: 1,
+		TimebaseDen: 1000,
+		Timeout:     defaultTimeout,
+	}
+	conn.SetDeadline(time.Now().Add(c.Timeout))
+	defer conn.SetDeadline(time.Time{})
+	if err := clientHandshake(conn); err != nil {
+		return nil, err
+	}
+	c.cr = newChunkReader(conn)
+	c.cw = newChunkWriter(conn)
+	return c, nil
+}
+
+// Publish dials rawurl (rtmp://host[:port]/app/stream) and starts
+// publishing the stream.
+func Publish(rawurl string) (*Client, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "rtmp" {
+		return nil, fmt.Errorf("rtmp: unsupported scheme %q", u.Scheme)
+	}
+	path := strings.TrimPrefix(u.Path, "/")
+	i := strings.LastIndex(path, "/")
+	if i <= 0 {
+		return nil, fmt.Errorf("rtmp: url %q has no app/stream path", rawurl)
+	}
+	app, stream := path[:i], path[i+1:]
+	if u.RawQuery != "" {
+		stream += "?" + u.RawQuery
+	}
+	c, err := Dial(u.Host)
+	if err != nil {
+		return nil, err
+	}
+	tcURL := fmt.Sprintf("rtmp://%s/%s", u.Host, app)
+	if err = c.Connect(app, tcURL); err == nil {
+		if err = c.CreateStream(); err == nil {
+			err = c.Publish(stream)
+		}
+	}
+	if err != nil {
+		c.conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Connect sends the connect command for app.
+func (c *Client) Connect(app, tcURL string) error {
+	if err := c.writeControl(MsgSetChunkSize, outChunkSize); err != nil {
+		return err
+	}
+	c.cw.chunkSize = outChunkSize
+	_, err := c.call("connect", Object{
+		"app":      app,
+		"type":     "nonprivate",
+		"flashVer": "FMLE/3.0 (compatible; x264-go)",
+		"tcUrl":    tcURL,
+	})
+	return err
+}
+
+// CreateStream creates the message stream used for publishing.
+func (c *Client) CreateStream() error {
+	res, err := c.call("createStream", nil)
+	if err != nil {
+		return err
+	}
+	if len(res) < 2 {
+		return &CommandError{Command: "createStream"}
+	}
+	id, ok := res[1].(float64)
+	if !ok {
+		return &CommandError{Command: "createStream"}
+	}
+	c.streamID = uint32(id)
+	return nil
+}
+
+// Publish starts publishing name on the created stream and waits for
+// NetStream.Publish.Start.
+func (c *Client) Publish(name string) error {
+	c.txID++
+	cmd := encodeAMF("publish", c.txID, nil, name, "live")
+	if err := c.writeMessage(csidCommand, MsgCommandAMF0, c.streamID, 0, cmd); err != nil {
+		return err
+	}
+	c.conn.SetDeadline(time.Now().Add(c.Timeout))
+	defer c.conn.SetDeadline(time.Time{})
+	for {
+		msg, err := c.cr.readMessage()
+		if err != nil {
+			return err
+		}
+		if msg.TypeID != MsgCommandAMF0 {
+			continue
+		}
+		values, err := decodeAMF(msg.Payload)
+		if err != nil || len(values) < 4 {
+			continue
+		}
+		if name, _ := values[0].(string); name != "onStatus" {
+			continue
+		}
+		info, _ := values[3].(Object)
+		if info["level"] == "error" {
+			return &CommandError{Command: "publish", Info: info}
+		}
+		if info["code"] == publishStartCode {
+			return nil
+		}
+	}
+}
+
+// WriteSequenceHeader sends the AVC sequence header.  It must precede the
+// first picture.
+func (c *Client) WriteSequenceHeader(sps, pps [][]byte) error {
+	payload, err := SequenceHeader(sps, pps)
+	if err != nil {
+		return err
+	}
+	c.sentHeader = true
+	return c.writeMessage(csidVideo, MsgVideo, c.streamID, 0, payload)
+}
+
+// WriteVideo sends one picture.  dts and cts (pts-dts) are in milliseconds.
+func (c *Client) WriteVideo(units [][]byte, dts uint32, cts int32, keyframe bool) error {
+	return c.writeMessage(csidVideo, MsgVideo, c.streamID, dts, VideoPayload(units, cts, keyframe))
+}
+
+// WriteNals sends one encoded picture as returned by X264EncoderEncode.
+func (c *Client) WriteNals(nals []libx264.X264NalT, pic_out *libx264.X264PictureT) error {
+	units := make([][]byte, 0, len(nals))
+	for i := range nals {
+		units = append(units, nals[i].Unit())
+	}
+	return c.writeUnits(units, pic_out.IPts, pic_out.Dts(), pic_out.IsKeyframe())
+}
+
+// WriteFrame sends one Annex-B access unit with timestamps in the client
+// timebase.  The sequence header is sent from the SPS/PPS of the first
+// keyframe unless WriteSequenceHeader was called.
+func (c *Client) WriteFrame(data []byte, pts, dts int64, keyframe bool) error {
+	return c.writeUnits(h264.SplitAnnexB(data), pts, dts, keyframe)
+}
+
+func (c *Client) writeUnits(units [][]byte, pts, dts int64, keyframe bool) error {
+	if !c.started {
+		if !keyframe {
+			return nil
+		}
+		c.started = true
+		if d := c.toMs(dts); d < 0 {
+			c.offset = -d
+		}
+	}
+	if !c.sentHeader {
+		sps, pps := h264.ParameterSets(units)
+		if len(sps) == 0 || len(pps) == 0 {
+			return ErrNoHeaders
+		}
+		if err := c.WriteSequenceHeader(sps, pps); err != nil {
+			return err
+		}
+	}
+	kept := units[:0:0]
+	for _, u := range units {
+		switch h264.NalType(u) {
+		case h264.NalSPS, h264.NalPPS, h264.NalAUD:
+		default:
+			kept = append(kept, u)
+		}
+	}
+	dtsMs := c.toMs(dts) + c.offset
+	ptsMs := c.toMs(pts) + c.offset
+	return c.WriteVideo(kept, uint32(dtsMs), int32(ptsMs-dtsMs), keyframe)
+}
+
+// Close ends the stream and closes the connection.
+func (c *Client) Close() error {
+	if c.streamID != 0 {
+		c.txID++
+		c.writeMessage(csidCommand, MsgCommandAMF0, 0, 0, encodeAMF("deleteStream", c.txID, nil, float64(c.streamID)))
+	}
+	return c.conn.Close()
+}
+
+// call sends a command on stream 0 and waits for its _result.
+func (c *Client) call(name string, args ...interface{}) ([]interface{}, error) {
+	c.txID++
+	tx := c.txID
+	values := append([]interface{}{name, tx}, args...)
+	if err := c.writeMessage(csidCommand, MsgCommandAMF0, 0, 0, encodeAMF(values...)); err != nil {
+		return nil, err
+	}
+	c.conn.SetDeadline(time.Now().Add(c.Timeout))
+	defer c.conn.SetDeadline(time.Time{})
+	for {
+		msg, err := c.cr.readMessage()
+		if err != nil {
+			return nil, err
+		}
+		if msg.TypeID != MsgCommandAMF0 {
+			continue
+		}
+		res, err := decodeAMF(msg.Payload)
+		if err != nil || len(res) < 2 {
+			continue
+		}
+		if id, _ := res[1].(float64); id != tx {
+			continue
+		}
+		switch res[0] {
+		case "_result":
+			return res[2:], nil
+		case "_error":
+			info, _ := res[len(res)-1].(Object)
+			return nil, &CommandError{Command: name, Info: info}
+		}
+	}
+}
+
+func (c *Client) writeControl(typeID byte, value uint32) error {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], value)
+	return c.writeMessage(csidControl, typeID, 0, 0, b[:])
+}
+
+func (c *Client) writeMessage(csid uint32, typeID byte, streamID, ts uint32, payload []byte) error {
+	return c.cw.writeMessage(csid, &Message{
+		TypeID:    typeID,
+		StreamID:  streamID,
+		Timestamp: ts,
+		Payload:   payload,
+	})
+}
+
+func (c *Client) toMs(ts int64) int64 {
+	return media.Rescale(ts, c.TimebaseNum*1000, c.TimebaseDen)
+}
@@ -0,0 +1,182 @@
+package rtmp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/moonfdd/x264-go/h264"
+)
+
+/* 1280x720 High level 3.1 */
+var testSPS, _ = hex.DecodeString("6764001facd9405005bb011000000300100000030300f1831960")
+var testPPS = []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0}
+
+func annexB(units ...[]byte) []byte {
+	var b []byte
+	for _, u := range units {
+		b = append(b, 0, 0, 0, 1)
+		b = append(b, u...)
+	}
+	return b
+}
+
+func TestAMF(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []interface{}
+	}{
+		{"command", []interface{}{"connect", float64(1), Object{"app": "live", "capabilities": float64(31)}}},
+		{"null and bool", []interface{}{"onStatus", float64(0), nil, true, false}},
+		{"empty object", []interface{}{Object{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeAMF(encodeAMF(tt.values...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.values) {
+				t.Errorf("got %#v, want %#v", got, tt.values)
+			}
+		})
+	}
+	got, err := decodeAMF([]byte{amfStrictArray, 0, 0, 0, 2, amfNull, amfBoolean, 1})
+	if want := []interface{}{[]interface{}{nil, true}}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("strict array: %#v %v", got, err)
+	}
+	for _, bad := range [][]byte{
+		{amfString, 0, 5, 'a'},
+		{amfStrictArray, 0xff, 0xff, 0xff, 0xff},
+		{amfStrictArray, 0, 0, 0, 2, amfNull},
+	} {
+		if _, err := decodeAMF(bad); err != ErrAMF {
+			t.Errorf("decodeAMF(%x): %v", bad, err)
+		}
+	}
+}
+
+func TestPublish(t *testing.T) {
+	type frame struct {
+		pts, dts int64
+		keyframe bool
+		size     int
+	}
+	tests := []struct {
+		name   string
+		frames []frame
+		/* expected message timestamps and composition offsets in ms */
+		wantDts []uint32
+		wantCts []int32
+	}{
+		/* larger than the chunk size to exercise continuation chunks */
+		{"chunked keyframe", []frame{{0, 0, true, 10000}, {1, 1, false, 100}, {2, 2, false, 100}},
+			[]uint32{0, 40, 80}, []int32{0, 0, 0}},
+		/* b-frames start at a negative dts, shifted to zero */
+		{"b-frames", []frame{{0, -2, true, 500}, {3, -1, false, 100}, {1, 0, false, 50}, {2, 1, false, 50}},
+			[]uint32{0, 40, 80, 120}, []int32{80, 160, 40, 40}},
+		/* pictures before the first keyframe are dropped */
+		{"leading inter frames", []frame{{0, 0, false, 100}, {1, 1, true, 500}, {2, 2, false, 100}},
+			[]uint32{40, 80}, []int32{0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Skip(err)
+			}
+			type received struct {
+				stream string
+				msg    *Message
+			}
+			ch := make(chan received, 16)
+			srv := NewServer(ln, func(stream string, msg *Message) {
+				ch <- received{stream, msg}
+			})
+			go srv.Serve()
+			defer srv.Close()
+
+			c, err := Publish("rtmp://" + srv.Addr().String() + "/live/test?key=1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.TimebaseNum, c.TimebaseDen = 1, 25
+			var sent [][]byte
+			for i, f := range tt.frames {
+				slice := append([]byte{0x41}, bytes.Repeat([]byte{0xa0 + byte(i)}, f.size)...)
+				data := annexB([]byte{9, 0xf0}, slice)
+				if f.keyframe {
+					slice[0] = 0x65
+					data = annexB([]byte{9, 0x10}, testSPS, testPPS, slice)
+				}
+				if err := c.WriteFrame(data, f.pts, f.dts, f.keyframe); err != nil {
+					t.Fatal(err)
+				}
+				if f.keyframe || len(sent) > 0 {
+					sent = append(sent, slice)
+				}
+			}
+
+			next := func() received {
+				select {
+				case r := <-ch:
+					if r.stream != "test?key=1" || r.msg.TypeID != MsgVideo || r.msg.StreamID != c.streamID {
+						t.Fatalf("stream %q type %d id %d", r.stream, r.msg.TypeID, r.msg.StreamID)
+					}
+					return r
+				case <-time.After(5 * time.Second):
+					t.Fatal("timed out waiting for a message")
+				}
+				return received{}
+			}
+
+			hdr := next().msg.Payload
+			wantRec, _ := h264.DecoderConfigurationRecord([][]byte{testSPS}, [][]byte{testPPS})
+			if !bytes.Equal(hdr[:5], []byte{flvFrameKey | flvCodecAVC, avcSequenceHeader, 0, 0, 0}) || !bytes.Equal(hdr[5:], wantRec) {
+				t.Errorf("sequence header %x", hdr)
+			}
+			for i, slice := range sent {
+				msg := next().msg
+				p := msg.Payload
+				keyframe := p[0]>>4 == 1
+				cts := int32(uint32(p[2])<<16|uint32(p[3])<<8|uint32(p[4])) << 8 >> 8
+				if p[0]&0x0f != flvCodecAVC || p[1] != avcNALU || keyframe != (i == 0) {
+					t.Errorf("picture %d: header %x", i, p[:5])
+				}
+				if msg.Timestamp != tt.wantDts[i] || cts != tt.wantCts[i] {
+					t.Errorf("picture %d: dts %d cts %d, want %d %d", i, msg.Timestamp, cts, tt.wantDts[i], tt.wantCts[i])
+				}
+				/* the delimiter and parameter sets are stripped, one length-prefixed slice remains */
+				if n := binary.BigEndian.Uint32(p[5:]); int(n) != len(slice) || !bytes.Equal(p[9:], slice) {
+					t.Errorf("picture %d: %d byte NALU of %d, want %d", i, n, len(p)-9, len(slice))
+				}
+			}
+			if err := c.Close(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestPublishNoHeaders(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	srv := NewServer(ln, nil)
+	go srv.Serve()
+	defer srv.Close()
+
+	c, err := Publish("rtmp://" + srv.Addr().String() + "/live/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.WriteFrame(annexB([]byte{0x65, 0x88}), 0, 0, true); err != ErrNoHeaders {
+		t.Errorf("keyframe without SPS/PPS: %v", err)
+	}
+}
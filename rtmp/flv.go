@@ -0,0 +1,43 @@
+package rtmp
+
+import (
+	"github.com/moonfdd/x264-go/h264"
+)
+
+/* FLV VIDEODATA header */
+const (
+	flvFrameKey       = 1 << 4
+	flvFrameInter     = 2 << 4
+	flvCodecAVC       = 7
+	avcSequenceHeader = 0
+	avcNALU           = 1
+	avcEndOfSequence  = 2
+)
+
+// SequenceHeader returns the video message payload carrying the
+// AVCDecoderConfigurationRecord.
+func SequenceHeader(sps, pps [][]byte) ([]byte, error) {
+	rec, err := h264.DecoderConfigurationRecord(sps, pps)
+	if err != nil {
+		return nil, err
+	}
+	b := []byte{flvFrameKey | flvCodecAVC, avcSequenceHeader, 0, 0, 0}
+	return append(b, rec...), nil
+}
+
+// VideoPayload returns the video message payload for one picture.  units
+// are NAL units without start codes, cts is pts-dts in milliseconds.
+func VideoPayload(units [][]byte, cts int32, keyframe bool) []byte {
+	frameType := byte(flvFrameInter)
+	if keyframe {
+		frameType = flvFrameKey
+	}
+	b := []byte{frameType | flvCodecAVC, avcNALU, byte(cts >> 16), byte(cts >> 8), byte(cts)}
+	return append(b, h264.AVCC(units)...)
+}
+
+// EndOfSequence returns the video message payload signalling the end of
+// the AVC stream.
+func EndOfSequence() []byte {
+	return []byte{flvFrameKey | flvCodecAVC, avcEndOfSequence, 0, 0, 0}
+}
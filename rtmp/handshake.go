@@ -0,0 +1,61 @@
+package rtmp
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+)
+
+const handshakeSize = 1536
+
+var ErrHandshake = errors.New("rtmp: handshake failed")
+
+// clientHandshake performs the plain (unsigned) RTMP handshake.
+func clientHandshake(rw io.ReadWriter) error {
+	c0c1 := make([]byte, 1+handshakeSize)
+	c0c1[0] = 3
+	if _, err := rand.Read(c0c1[9:]); err != nil {
+		return err
+	}
+	if _, err := rw.Write(c0c1); err != nil {
+		return err
+	}
+	s0s1 := make([]byte, 1+handshakeSize)
+	if _, err := io.ReadFull(rw, s0s1); err != nil {
+		return err
+	}
+	if s0s1[0] != 3 {
+		return ErrHandshake
+	}
+	/* C2 echoes S1 */
+	if _, err := rw.Write(s0s1[1:]); err != nil {
+		return err
+	}
+	s2 := make([]byte, handshakeSize)
+	_, err := io.ReadFull(rw, s2)
+	return err
+}
+
+// serverHandshake is the server side of clientHandshake.
+func serverHandshake(rw io.ReadWriter) error {
+	c0c1 := make([]byte, 1+handshakeSize)
+	if _, err := io.ReadFull(rw, c0c1); err != nil {
+		return err
+	}
+	if c0c1[0] != 3 {
+		return ErrHandshake
+	}
+	s := make([]byte, 1+2*handshakeSize)
+	s[0] = 3
+	if _, err := rand.Read(s[9 : 1+handshakeSize]); err != nil {
+		return err
+	}
+	/* S2 echoes C1 */
+	copy(s[1+handshakeSize:], c0c1[1:])
+	if _, err := rw.Write(s); err != nil {
+		return err
+	}
+	c2 := make([]byte, handshakeSize)
+	_, err := io.ReadFull(rw, c2)
+	return err
+}
@@ -0,0 +1,141 @@
+package rtmp
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+)
+
+// Server is a minimal in-process RTMP ingest standing in for a real media
+// server in tests.  It accepts publishers, answers connect, createStream
+// and publish, and hands every audio, video and data message to Handler.
+type Server struct {
+	/* called for every media or data message of a published stream */
+	Handler func(stream string, msg *Message)
+
+	ln    net.Listener
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+	wg    sync.WaitGroup
+}
+
+// NewServer returns a server for ln; call Serve to start accepting.
+func NewServer(ln net.Listener, handler func(stream string, msg *Message)) *Server {
+	return &Server{
+		Handler: handler,
+		ln:      ln,
+		conns:   make(map[net.Conn]struct{}),
+	}
+}
+
+// Addr returns the listening address.
+func (s *Server) Addr() net.Addr {
+	return s.ln.Addr()
+}
+
+// Serve accepts connections until the listener is closed.
+func (s *Server) Serve() error {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return err
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.serveConn(conn)
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+// Close stops the listener, closes all connections and waits for them.
+func (s *Server) Close() error {
+	err := s.ln.Close()
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	if err := serverHandshake(conn); err != nil {
+		return
+	}
+	cr := newChunkReader(conn)
+	cw := newChunkWriter(conn)
+	send := func(csid uint32, typeID byte, streamID uint32, payload []byte) error {
+		return cw.writeMessage(csid, &Message{TypeID: typeID, StreamID: streamID, Payload: payload})
+	}
+	control := func(typeID byte, value uint32, extra ...byte) error {
+		b := make([]byte, 4, 5)
+		binary.BigEndian.PutUint32(b, value)
+		return send(csidControl, typeID, 0, append(b, extra...))
+	}
+
+	streams := make(map[uint32]string)
+	var nextStream uint32 = 1
+	for {
+		msg, err := cr.readMessage()
+		if err != nil {
+			return
+		}
+		switch msg.TypeID {
+		case MsgAudio, MsgVideo, MsgDataAMF0:
+			if name, ok := streams[msg.StreamID]; ok && s.Handler != nil {
+				s.Handler(name, msg)
+			}
+			continue
+		case MsgCommandAMF0:
+		default:
+			continue
+		}
+
+		values, err := decodeAMF(msg.Payload)
+		if err != nil || len(values) < 2 {
+			continue
+		}
+		name, _ := values[0].(string)
+		tx := values[1]
+		switch name {
+		case "connect":
+			control(MsgWindowAckSize, 2500000)
+			control(MsgSetPeerBandwidth, 2500000, 2)
+			control(MsgSetChunkSize, outChunkSize)
+			cw.chunkSize = outChunkSize
+			send(csidCommand, MsgCommandAMF0, 0, encodeAMF("_result", tx,
+				Object{"fmsVer": "FMS/3,0,1,123", "capabilities": 31},
+				Object{"level": "status", "code": "NetConnection.Connect.Success", "description": "Connection succeeded."}))
+		case "createStream":
+			id := nextStream
+			nextStream++
+			streams[id] = ""
+			send(csidCommand, MsgCommandAMF0, 0, encodeAMF("_result", tx, nil, float64(id)))
+		case "publish":
+			if len(values) < 4 {
+				continue
+			}
+			stream, _ := values[3].(string)
+			streams[msg.StreamID] = stream
+			send(csidCommand, MsgCommandAMF0, msg.StreamID, encodeAMF("onStatus", 0, nil,
+				Object{"level": "status", "code": publishStartCode, "description": "Publishing " + stream}))
+		case "deleteStream":
+			if len(values) >= 4 {
+				if id, ok := values[3].(float64); ok {
+					delete(streams, uint32(id))
+				}
+			}
+		case "releaseStream", "FCPublish", "FCUnpublish":
+			send(csidCommand, MsgCommandAMF0, 0, encodeAMF("_result", tx, nil))
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package rtmp
+
+import (
+	"github.com/moonfdd/x264-go/h264"
+	"github.com/moonfdd/x264-go/libx264"
+)
+
+type clientSink struct {
+	c *Client
+}
+
+// Sink returns the publishing client as a libx264.Sink.  WriteHeaders
+// sends the AVC sequence header; Close ends the stream.
+func (c *Client) Sink() libx264.Sink {
+	return clientSink{c}
+}
+
+func (k clientSink) WriteHeaders(nals []libx264.X264NalT) error {
+	units := make([][]byte, 0, len(nals))
+	for i := range nals {
+		units = append(units, nals[i].Unit())
+	}
+	sps, pps := h264.ParameterSets(units)
+	return k.c.WriteSequenceHeader(sps, pps)
+}
+
+func (k clientSink) WriteFrame(f *libx264.Frame) error {
+	units := make([][]byte, 0, len(f.Nals))
+	for i := range f.Nals {
+		units = append(units, f.Nals[i].Unit())
+	}
+	return k.c.writeUnits(units, f.Pts, f.Dts, f.Keyframe)
+}
+
+func (k clientSink) Close() error {
+	return k.c.Close()
+}
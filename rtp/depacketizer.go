@@ -0,0 +1,108 @@
+package rtp
+
+import (
+	"errors"
+)
+
+var ErrInvalidPayload = errors.New("rtp: invalid H.264 payload")
+var ErrUnsupportedNalu = errors.New("rtp: unsupported H.264 payload type")
+
+// Depacketizer reassembles NAL units from RTP packets produced by a
+// Packetizer (or any RFC 6184 packetization-mode=1 sender).
+// Packets must be pushed in sequence order; a gap in sequence numbers
+// discards the fragmented NAL unit in progress.
+type Depacketizer struct {
+	fu      []byte
+	started bool
+	lastSeq uint16
+	au      [][]byte
+
+	/* number of NAL units dropped because of loss */
+	Dropped int
+}
+
+// Push consumes one packet and returns the NAL units it completed.
+func (d *Depacketizer) Push(pkt *Packet) ([][]byte, error) {
+	if d.started && pkt.SequenceNumber != d.lastSeq+1 && d.fu != nil {
+		d.fu = nil
+		d.Dropped++
+	}
+	d.started = true
+	d.lastSeq = pkt.SequenceNumber
+
+	payload := pkt.Payload
+	if len(payload) < 1 {
+		return nil, ErrInvalidPayload
+	}
+	switch t := payload[0] & naluTypeMask; {
+	case t >= 1 && t <= 23:
+		return [][]byte{append([]byte(nil), payload...)}, nil
+
+	case t == naluStapA:
+		var units [][]byte
+		for rest := payload[1:]; len(rest) > 0; {
+			if len(rest) < 2 {
+				return units, ErrInvalidPayload
+			}
+			size := int(rest[0])<<8 | int(rest[1])
+			rest = rest[2:]
+			if size == 0 || size > len(rest) {
+				return units, ErrInvalidPayload
+			}
+			units = append(units, append([]byte(nil), rest[:size]...))
+			rest = rest[size:]
+		}
+		return units, nil
+
+	case t == naluFuA:
+		if len(payload) < 2 {
+			return nil, ErrInvalidPayload
+		}
+		start := payload[1]&0x80 != 0
+		end := payload[1]&0x40 != 0
+		if start {
+			if d.fu != nil {
+				d.Dropped++
+			}
+			d.fu = []byte{payload[0]&0xe0 | payload[1]&naluTypeMask}
+		} else if d.fu == nil {
+			/* middle of a NAL unit whose start was lost */
+			return nil, nil
+		}
+		d.fu = append(d.fu, payload[2:]...)
+		if !end {
+			return nil, nil
+		}
+		unit := d.fu
+		d.fu = nil
+		return [][]byte{unit}, nil
+	}
+	return nil, ErrUnsupportedNalu
+}
+
+// PushAccessUnit consumes one packet and returns the complete access unit
+// once the packet carrying the marker bit is seen.
+func (d *Depacketizer) PushAccessUnit(pkt *Packet) ([][]byte, error) {
+	units, err := d.Push(pkt)
+	d.au = append(d.au, units...)
+	if err != nil || !pkt.Marker {
+		return nil, err
+	}
+	au := d.au
+	d.au = nil
+	return au, nil
+}
+
+// AnnexB joins NAL units into an Annex-B byte stream with 4-byte start codes.
+func AnnexB(units [][]byte) []byte {
+	size := 0
+	for _, u := range units {
+		size += 4 + len(u)
+	}
+	out := make([]byte, 0, size)
+	for _, u := range units {
+		out = append(out, 0, 0, 0, 1)
+		out = append(out, u...)
+	}
+	return out
+}
@@ -0,0 +1,188 @@
+package rtp
+
+import (
+	"fmt"
+
+	"github.com/moonfdd/x264-go/internal/media"
+	"github.com/moonfdd/x264-go/libx264"
+)
+
+// Packetizer splits the NAL units of one access unit into RTP packets.
+//
+// NAL units that fit into MTU-HeaderSize bytes are sent as single NAL unit
+// packets, consecutive SPS/PPS are aggregated into one STAP-A packet and
+// larger NAL units are fragmented with FU-A.  ConfigureSlices keeps every
+// slice in a single packet.
+type Packetizer struct {
+	MTU         int /* maximum RTP packet size, header included; more than HeaderSize+2 */
+	PayloadType uint8
+	SSRC        uint32
+
+	/* timebase of the PTS passed to Packetize, i.e. i_timebase_num/i_timebase_den */
+	TimebaseNum int64
+	TimebaseDen int64
+
+	/* added to every timestamp, RFC 3550 recommends a random value */
+	TimestampOffset uint32
+
+	seq uint16
+}
+
+// NewPacketizer returns a packetizer using the given MTU and PTS timebase.
+// A non-positive mtu selects DefaultMTU; an MTU leaving no room for an
+// FU-A fragment after the RTP and FU headers is rejected.
+func NewPacketizer(mtu int, payloadType uint8, ssrc uint32, timebaseNum, timebaseDen int64) (*Packetizer, error) {
+	if mtu <= 0 {
+		mtu = DefaultMTU
+	}
+	if mtu <= HeaderSize+2 {
+		return nil, fmt.Errorf("rtp: MTU %d too small, need more than %d", mtu, HeaderSize+2)
+	}
+	return &Packetizer{
+		MTU:         mtu,
+		PayloadType: payloadType,
+		SSRC:        ssrc,
+		TimebaseNum: timebaseNum,
+		TimebaseDen: timebaseDen,
+	}, nil
+}
+
+// MaxPayloadSize is the largest NAL unit that is sent without fragmentation.
+func (p *Packetizer) MaxPayloadSize() int {
+	return p.MTU - HeaderSize
+}
+
+// ConfigureSlices sets the slice max size of param to MaxPayloadSize(), so
+// no slice needs FU-A fragmentation.
+func (p *Packetizer) ConfigureSlices(param *libx264.X264ParamT) error {
+	return param.SetSliceMaxSize(p.MaxPayloadSize())
+}
+
+// SequenceNumber returns the sequence number of the next packet.
+func (p *Packetizer) SequenceNumber() uint16 {
+	return p.seq
+}
+
+// SetSequenceNumber sets the sequence number of the next packet.
+func (p *Packetizer) SetSequenceNumber(seq uint16) {
+	p.seq = seq
+}
+
+// Timestamp converts a PTS in the packetizer timebase to a 90 kHz RTP timestamp.
+func (p *Packetizer) Timestamp(pts int64) uint32 {
+	num, den := p.TimebaseNum, p.TimebaseDen
+	if num <= 0 || den <= 0 {
+		num, den = 1, ClockRate
+	}
+	return uint32(media.Rescale(pts, num*ClockRate, den)) + p.TimestampOffset
+}
+
+// PacketizeNals packetizes one picture worth of x264 output.
+func (p *Packetizer) PacketizeNals(nals []libx264.X264NalT, pts int64) []*Packet {
+	units := make([][]byte, 0, len(nals))
+	for i := range nals {
+		units = append(units, nals[i].Unit())
+	}
+	return p.Packetize(units, pts)
+}
+
+// Packetize packetizes the NAL units (without start codes) of one access
+// unit. The marker bit is set on the last packet.
+// Packet payloads are freshly allocated and do not alias units.
+func (p *Packetizer) Packetize(units [][]byte, pts int64) []*Packet {
+	ts := p.Timestamp(pts)
+	max := p.MaxPayloadSize()
+	var pkts []*Packet
+
+	for i := 0; i < len(units); {
+		unit := units[i]
+		if len(unit) == 0 {
+			i++
+			continue
+		}
+
+		/* aggregate runs of parameter sets */
+		if isParameterSet(unit) {
+			j, size := i, 1
+			for j < len(units) && len(units[j]) > 0 && isParameterSet(units[j]) && size+2+len(units[j]) <= max {
+				size += 2 + len(units[j])
+				j++
+			}
+			if j-i > 1 {
+				pkts = append(pkts, p.packet(stapA(units[i:j], size), ts))
+				i = j
+				continue
+			}
+		}
+
+		if len(unit) <= max {
+			pkts = append(pkts, p.packet(append([]byte(nil), unit...), ts))
+		} else {
+			pkts = append(pkts, p.fuA(unit, max, ts)...)
+		}
+		i++
+	}
+
+	if len(pkts) > 0 {
+		pkts[len(pkts)-1].Marker = true
+	}
+	return pkts
+}
+
+func (p *Packetizer) packet(payload []byte, ts uint32) *Packet {
+	pkt := &Packet{
+		PayloadType:    p.PayloadType,
+		SequenceNumber: p.seq,
+		Timestamp:      ts,
+		SSRC:           p.SSRC,
+		Payload:        payload,
+	}
+	p.seq++
+	return pkt
+}
+
+func (p *Packetizer) fuA(unit []byte, max int, ts uint32) []*Packet {
+	hdr := unit[0]
+	body := unit[1:]
+	chunk := max - 2
+	var pkts []*Packet
+	for start := 0; start < len(body); start += chunk {
+		end := start + chunk
+		if end > len(body) {
+			end = len(body)
+		}
+		payload := make([]byte, 2+end-start)
+		payload[0] = hdr&0xe0 | naluFuA
+		payload[1] = hdr & naluTypeMask
+		if start == 0 {
+			payload[1] |= 0x80
+		}
+		if end == len(body) {
+			payload[1] |= 0x40
+		}
+		copy(payload[2:], body[start:end])
+		pkts = append(pkts, p.packet(payload, ts))
+	}
+	return pkts
+}
+
+func stapA(units [][]byte, size int) []byte {
+	payload := make([]byte, 1, size)
+	var nri byte
+	for _, u := range units {
+		if u[0]&0x60 > nri {
+			nri = u[0] & 0x60
+		}
+	}
+	payload[0] = nri | naluStapA
+	for _, u := range units {
+		payload = append(payload, byte(len(u)>>8), byte(len(u)))
+		payload = append(payload, u...)
+	}
+	return payload
+}
+
+func isParameterSet(unit []byte) bool {
+	t := unit[0] & naluTypeMask
+	return t == libx264.NAL_SPS || t == libx264.NAL_PPS
+}
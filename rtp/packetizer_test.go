@@ -0,0 +1,140 @@
+package rtp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func unit(hdr byte, size int) []byte {
+	u := make([]byte, size)
+	u[0] = hdr
+	for i := 1; i < size; i++ {
+		u[i] = byte(i * 7)
+	}
+	return u
+}
+
+func TestNewPacketizerMTU(t *testing.T) {
+	tests := []struct {
+		mtu     int
+		want    int
+		wantErr bool
+	}{
+		{0, DefaultMTU, false},
+		{-1, DefaultMTU, false},
+		{1500, 1500, false},
+		{HeaderSize + 3, HeaderSize + 3, false},
+		{HeaderSize + 2, 0, true},
+		{HeaderSize, 0, true},
+		{1, 0, true},
+	}
+	for _, tt := range tests {
+		p, err := NewPacketizer(tt.mtu, 96, 1, 1, ClockRate)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("NewPacketizer(%d): no error", tt.mtu)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("NewPacketizer(%d): %v", tt.mtu, err)
+			continue
+		}
+		if p.MTU != tt.want {
+			t.Errorf("NewPacketizer(%d).MTU = %d, want %d", tt.mtu, p.MTU, tt.want)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	sps, pps := unit(0x67, 20), unit(0x68, 6)
+	tests := []struct {
+		name  string
+		mtu   int
+		units [][]byte
+		types []byte /* NAL type of every packet */
+	}{
+		{"single", 200, [][]byte{unit(0x65, 100)}, []byte{5}},
+		{"stap-a", 200, [][]byte{sps, pps, unit(0x65, 100)}, []byte{naluStapA, 5}},
+		{"stap-a does not fit", HeaderSize + 20, [][]byte{sps, pps}, []byte{7, 8}},
+		{"fu-a", 100, [][]byte{unit(0x65, 250)}, []byte{naluFuA, naluFuA, naluFuA}},
+		{"fu-a smallest mtu", HeaderSize + 3, [][]byte{unit(0x41, 4)}, []byte{naluFuA, naluFuA, naluFuA}},
+		{"mixed", 100, [][]byte{sps, pps, unit(0x06, 10), unit(0x65, 200), unit(0x65, 50)},
+			[]byte{naluStapA, 6, naluFuA, naluFuA, naluFuA, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewPacketizer(tt.mtu, 96, 0x1234, 1, 25)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p.SetSequenceNumber(0xfffe)
+			pkts := p.Packetize(tt.units, 3)
+			if len(pkts) != len(tt.types) {
+				t.Fatalf("%d packets, want %d", len(pkts), len(tt.types))
+			}
+			var d Depacketizer
+			var au [][]byte
+			for i, pkt := range pkts {
+				if typ := pkt.Payload[0] & naluTypeMask; typ != tt.types[i] {
+					t.Errorf("packet %d: type %d, want %d", i, typ, tt.types[i])
+				}
+				if pkt.Timestamp != 3*ClockRate/25 {
+					t.Errorf("packet %d: timestamp %d, want %d", i, pkt.Timestamp, 3*ClockRate/25)
+				}
+				if pkt.Marker != (i == len(pkts)-1) {
+					t.Errorf("packet %d: marker %v", i, pkt.Marker)
+				}
+				buf := pkt.Marshal()
+				if len(buf) > tt.mtu {
+					t.Errorf("packet %d: %d bytes exceeds MTU %d", i, len(buf), tt.mtu)
+				}
+				var got Packet
+				if err := got.Unmarshal(buf); err != nil {
+					t.Fatalf("packet %d: %v", i, err)
+				}
+				if au, err = d.PushAccessUnit(&got); err != nil {
+					t.Fatalf("packet %d: %v", i, err)
+				}
+			}
+			if len(au) != len(tt.units) {
+				t.Fatalf("%d units, want %d", len(au), len(tt.units))
+			}
+			for i := range au {
+				if !bytes.Equal(au[i], tt.units[i]) {
+					t.Errorf("unit %d differs", i)
+				}
+			}
+			if d.Dropped != 0 {
+				t.Errorf("Dropped = %d", d.Dropped)
+			}
+		})
+	}
+}
+
+func TestDepacketizerLoss(t *testing.T) {
+	p, err := NewPacketizer(100, 96, 1, 1, ClockRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lost, kept := unit(0x65, 250), unit(0x41, 50)
+	pkts := append(p.Packetize([][]byte{lost}, 0), p.Packetize([][]byte{kept}, 1)...)
+	var d Depacketizer
+	var units [][]byte
+	for i, pkt := range pkts {
+		if i == 1 {
+			continue /* middle FU-A fragment */
+		}
+		u, err := d.Push(pkt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		units = append(units, u...)
+	}
+	if len(units) != 1 || !bytes.Equal(units[0], kept) {
+		t.Errorf("got %d units, want only the unfragmented one", len(units))
+	}
+	if d.Dropped != 1 {
+		t.Errorf("Dropped = %d, want 1", d.Dropped)
+	}
+}
@@ -0,0 +1,88 @@
+// Package rtp carries x264 output over RTP using the H.264 payload format
+// of RFC 6184 (packetization-mode=1: single NAL unit, STAP-A and FU-A).
+package rtp
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	rtpVersion   = 2
+	HeaderSize   = 12 /* fixed RTP header, no CSRCs or extensions */
+	ClockRate    = 90000
+	DefaultMTU   = 1200
+	naluTypeMask = 0x1f
+	naluStapA    = 24
+	naluFuA      = 28
+)
+
+var ErrShortPacket = errors.New("rtp: packet too short")
+var ErrVersion = errors.New("rtp: unsupported version")
+
+// Packet is a single RTP packet.
+type Packet struct {
+	Marker         bool
+	PayloadType    uint8
+	SequenceNumber uint16
+	Timestamp      uint32
+	SSRC           uint32
+	Payload        []byte
+}
+
+// Marshal serializes the packet into a newly allocated buffer.
+func (p *Packet) Marshal() []byte {
+	buf := make([]byte, HeaderSize+len(p.Payload))
+	buf[0] = rtpVersion << 6
+	buf[1] = p.PayloadType & 0x7f
+	if p.Marker {
+		buf[1] |= 0x80
+	}
+	binary.BigEndian.PutUint16(buf[2:], p.SequenceNumber)
+	binary.BigEndian.PutUint32(buf[4:], p.Timestamp)
+	binary.BigEndian.PutUint32(buf[8:], p.SSRC)
+	copy(buf[HeaderSize:], p.Payload)
+	return buf
+}
+
+// Unmarshal parses buf into p. Payload aliases buf.
+// CSRCs, header extensions and padding are skipped.
+func (p *Packet) Unmarshal(buf []byte) error {
+	if len(buf) < HeaderSize {
+		return ErrShortPacket
+	}
+	if buf[0]>>6 != rtpVersion {
+		return ErrVersion
+	}
+	padding := buf[0]&0x20 != 0
+	extension := buf[0]&0x10 != 0
+	csrcCount := int(buf[0] & 0x0f)
+	p.Marker = buf[1]&0x80 != 0
+	p.PayloadType = buf[1] & 0x7f
+	p.SequenceNumber = binary.BigEndian.Uint16(buf[2:])
+	p.Timestamp = binary.BigEndian.Uint32(buf[4:])
+	p.SSRC = binary.BigEndian.Uint32(buf[8:])
+
+	offset := HeaderSize + 4*csrcCount
+	if len(buf) < offset {
+		return ErrShortPacket
+	}
+	if extension {
+		if len(buf) < offset+4 {
+			return ErrShortPacket
+		}
+		offset += 4 + 4*int(binary.BigEndian.Uint16(buf[offset+2:]))
+		if len(buf) < offset {
+			return ErrShortPacket
+		}
+	}
+	end := len(buf)
+	if padding {
+		end -= int(buf[end-1])
+		if end < offset {
+			return ErrShortPacket
+		}
+	}
+	p.Payload = buf[offset:end]
+	return nil
+}
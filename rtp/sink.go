@@ -0,0 +1,51 @@
+package rtp
+
+import (
+	"github.com/moonfdd/x264-go/libx264"
+)
+
+type packetizerSink struct {
+	p       *Packetizer
+	send    func(*Packet) error
+	headers [][]byte
+}
+
+// NewSink returns a libx264.Sink packetizing every frame with p and
+// handing the packets to send.  The SPS/PPS from WriteHeaders are
+// aggregated in front of keyframes that do not carry them.
+func NewSink(p *Packetizer, send func(*Packet) error) libx264.Sink {
+	return &packetizerSink{p: p, send: send}
+}
+
+func (k *packetizerSink) WriteHeaders(nals []libx264.X264NalT) error {
+	for i := range nals {
+		if u := nals[i].Unit(); len(u) > 0 && isParameterSet(u) {
+			k.headers = append(k.headers, append([]byte(nil), u...))
+		}
+	}
+	return nil
+}
+
+func (k *packetizerSink) WriteFrame(f *libx264.Frame) error {
+	units := make([][]byte, 0, len(f.Nals)+len(k.headers))
+	hasSPS := false
+	for i := range f.Nals {
+		hasSPS = hasSPS || f.Nals[i].IType == libx264.NAL_SPS
+	}
+	if f.Keyframe && !hasSPS {
+		units = append(units, k.headers...)
+	}
+	for i := range f.Nals {
+		units = append(units, f.Nals[i].Unit())
+	}
+	for _, pkt := range k.p.Packetize(units, f.Pts) {
+		if err := k.send(pkt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (k *packetizerSink) Close() error {
+	return nil
+}